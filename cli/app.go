@@ -11,9 +11,15 @@ import (
 	"github.com/huairu-tech-com/xiaozhi-gogo/webui"
 
 	"github.com/cloudwego/hertz/pkg/app/server"
+	hertzconfig "github.com/cloudwego/hertz/pkg/common/config"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	defaultMaxRequestBodySize = 4 << 20  // default limit of hertz
+	visionBodyOverhead        = 64 << 10 // question and multipart headers along with the photo
+)
+
 type runnable any
 type shutdownable any
 
@@ -22,10 +28,15 @@ func runServers(ctx context.Context, cfg *config.Config) error {
 	log.Info().Msgf("launching WebUI %s", cfg.WebUIAddr)
 	log.Info().Msg("launching OTA service")
 
-	hertzForDevice := server.Default(
+	deviceOpts := []hertzconfig.Option{
 		server.WithHostPorts(cfg.Addr),
-	)
-	deviceHubSrv, err := src.New(cfg.Ota, cfg.Asr, cfg.Llm, cfg.Tts)
+	}
+	// photos of the vision endpoint may exceed the default limit of the body
+	if cfg.Vision != nil && cfg.Vision.Enable && cfg.Vision.MaxImageSize+visionBodyOverhead > defaultMaxRequestBodySize {
+		deviceOpts = append(deviceOpts, server.WithMaxRequestBodySize(int(cfg.Vision.MaxImageSize+visionBodyOverhead)))
+	}
+	hertzForDevice := server.Default(deviceOpts...)
+	deviceHubSrv, err := src.New(cfg)
 	if err != nil {
 		return err
 	}
@@ -35,7 +46,7 @@ func runServers(ctx context.Context, cfg *config.Config) error {
 	hertzForInternal := server.Default(
 		server.WithHostPorts(cfg.WebUIAddr),
 	)
-	webUISrv := webui.New()
+	webUISrv := webui.New(deviceHubSrv)
 	webUISrv.Hook(hertzForInternal)
 
 	errCh := make(chan error, 1)
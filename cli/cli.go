@@ -11,6 +11,7 @@ import (
 	"syscall"
 
 	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/src"
 
 	"github.com/go-yaml/yaml"
 	"github.com/rs/zerolog"
@@ -25,6 +26,7 @@ const (
 var (
 	configPath = flag.String("config-path", "config.yaml", "where config file is located, default is config.yaml")
 	dump       = flag.Bool("dump", false, "output default config and exit, useful for generating a new config file")
+	prewarm    = flag.String("prewarm", "", "synthesize the phrases of the file, one per line, into the TTS cache and exit")
 )
 
 func Run() int {
@@ -68,6 +70,14 @@ func Run() int {
 		syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
 
+	if len(*prewarm) != 0 {
+		if err := prewarmTtsCache(ctx, cfg, *prewarm); err != nil {
+			log.Error().Err(err).Msg("prewarm TTS cache failed")
+			return ExitCodeFail
+		}
+		return ExitCodeOK
+	}
+
 	if err := runServers(ctx, cfg); err != nil {
 		log.Error().Err(err).Msg("run server failed")
 		return ExitCodeFail
@@ -111,3 +121,30 @@ func setupLogger(logCfg *config.LogConfig) error {
 
 	return nil
 }
+
+// prewarmTtsCache fills the TTS cache with the phrases of path, empty lines and
+// lines starting with # are skipped
+func prewarmTtsCache(ctx context.Context, cfg *config.Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	phrases := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) != 0 && !strings.HasPrefix(line, "#") {
+			phrases = append(phrases, line)
+		}
+	}
+
+	hub, err := src.New(cfg)
+	if err != nil {
+		return err
+	}
+	defer hub.Shutdown(ctx)
+
+	warmed, err := hub.PrewarmTtsCache(ctx, phrases)
+	log.Info().Msgf("%d phrases synthesized into the TTS cache", warmed)
+	return err
+}
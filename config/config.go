@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/go-yaml/yaml"
 )
@@ -35,8 +36,79 @@ type DeepseekConfig struct {
 	ApiKey  string `yaml:"api_key"`  // API key for DeepSeek, optional
 }
 
+type OllamaConfig struct {
+	BaseUrl   string         `yaml:"base_url"`   // Base URL of Ollama, e.g., "http://192.168.1.10:11434"
+	Model     string         `yaml:"model"`      // Ollama model name, e.g., "qwen2.5:7b"
+	KeepAlive string         `yaml:"keep_alive"` // how long the model stays loaded after a request, e.g., "5m"
+	Options   map[string]any `yaml:"options"`    // model options, e.g., temperature, num_ctx
+}
+
+type AnthropicConfig struct {
+	BaseUrl   string `yaml:"base_url"`   // Base URL for Anthropic API, e.g., "https://api.anthropic.com"
+	ApiKey    string `yaml:"api_key"`    // API key for Anthropic
+	Model     string `yaml:"model"`      // Anthropic model name, e.g., "claude-3-5-haiku-latest"
+	MaxTokens int    `yaml:"max_tokens"` // max tokens of the answer, required by the Messages API
+	Version   string `yaml:"version"`    // anthropic-version header, e.g., "2023-06-01"
+}
+
+type DifyConfig struct {
+	BaseUrl string         `yaml:"base_url"` // Base URL of the chat-messages API, e.g., "https://api.dify.ai/v1"
+	ApiKey  string         `yaml:"api_key"`  // API key of the agent app
+	Inputs  map[string]any `yaml:"inputs"`   // app variables sent with every question
+}
+
+type LlmFailoverConfig struct {
+	Providers        []string      `yaml:"providers"`         // profiles or providers tried in order, e.g., [ollama, deepseek]
+	MaxRetries       int           `yaml:"max_retries"`       // retries of a provider on transient errors
+	Backoff          time.Duration `yaml:"backoff"`           // wait before the first retry, doubled on every retry
+	MaxBackoff       time.Duration `yaml:"max_backoff"`       // upper bound of the wait between retries
+	AttemptTimeout   time.Duration `yaml:"attempt_timeout"`   // timeout of a single request, 0 means bounded by the deadline only
+	Deadline         time.Duration `yaml:"deadline"`          // deadline of a whole turn across all providers
+	BreakerThreshold int           `yaml:"breaker_threshold"` // consecutive failures opening the circuit breaker of a provider
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // how long a provider with open breaker is skipped
+}
+
+type LlmContextConfig struct {
+	MaxTokens        int  `yaml:"max_tokens"`         // token budget of the dialogues sent to LLM, 0 means unlimited
+	KeepTurns        int  `yaml:"keep_turns"`         // most recent turns which are never trimmed
+	Summarize        bool `yaml:"summarize"`          // compress trimmed turns into a rolling summary by LLM
+	SummaryMaxTokens int  `yaml:"summary_max_tokens"` // token budget of the rolling summary
+}
+
+type LlmEmotionConfig struct {
+	Enable   bool   `yaml:"enable"`   // ask LLM to lead answers with an emotion tag shown by the device
+	Fallback string `yaml:"fallback"` // emotion of answers without a tag, e.g. neutral
+}
+
+// LlmProfileConfig is a named LLM with its generation parameters, e.g. a voice
+// profile with short answers and a story profile with long ones
+type LlmProfileConfig struct {
+	Provider    string            `yaml:"provider"`    // one of deepseek, openai, ollama, anthropic, dify, failover
+	BaseUrl     string            `yaml:"base_url"`    // API endpoint, empty uses the default of the provider
+	ApiKey      string            `yaml:"api_key"`     // API key of the provider
+	Model       string            `yaml:"model"`       // model name
+	Temperature *float32          `yaml:"temperature"` // empty keeps the default of the model
+	TopP        *float32          `yaml:"top_p"`       // empty keeps the default of the model
+	MaxTokens   int               `yaml:"max_tokens"`  // upper bound of an answer, keep it short for voice
+	Stop        []string          `yaml:"stop"`        // sequences ending an answer
+	Timeout     time.Duration     `yaml:"timeout"`     // timeout of a request, e.g. 20s
+	Headers     map[string]string `yaml:"headers"`     // extra headers of every request
+	Options     map[string]any    `yaml:"options"`     // provider specific options, e.g. ollama num_ctx or dify inputs
+}
+
 type LlmConfig struct {
-	Deepseek *DeepseekConfig `yaml:"deepseek"` // DeepSeek LLM configuration
+	Provider       string                       `yaml:"provider"`        // LLM provider, one of deepseek, openai, ollama, anthropic, dify, failover
+	Profile        string                       `yaml:"profile"`         // default profile, empty uses provider
+	Profiles       map[string]*LlmProfileConfig `yaml:"profiles"`        // named profiles referenced by personas, devices and failover
+	SystemPrompt   string                       `yaml:"system_prompt"`   // system prompt sent as the first dialogue
+	Context        *LlmContextConfig            `yaml:"context"`         // conversation memory limits
+	Deepseek       *DeepseekConfig              `yaml:"deepseek"`        // DeepSeek or any OpenAI compatible LLM configuration
+	Ollama         *OllamaConfig                `yaml:"ollama"`          // Ollama native API configuration
+	Anthropic      *AnthropicConfig             `yaml:"anthropic"`       // Anthropic Messages API configuration
+	Dify           *DifyConfig                  `yaml:"dify"`            // Dify style agent platform configuration
+	Failover       *LlmFailoverConfig           `yaml:"failover"`        // providers tried in order when provider is failover
+	FallbackAnswer string                       `yaml:"fallback_answer"` // spoken when no provider answers, empty keeps silent
+	Emotion        *LlmEmotionConfig            `yaml:"emotion"`         // emotion tags in answers
 }
 
 type CosyVoiceConfig struct {
@@ -45,19 +117,183 @@ type CosyVoiceConfig struct {
 	ApiKey  string `yaml:"api_key"`  // API key for CosyVoice TTS
 }
 
+type OpenAITtsConfig struct {
+	BaseUrl    string        `yaml:"base_url"`    // ends before /audio/speech, e.g. https://api.openai.com/v1
+	ApiKey     string        `yaml:"api_key"`     // API key, optional for local servers
+	Model      string        `yaml:"model"`       // e.g. tts-1
+	Voice      string        `yaml:"voice"`       // e.g. alloy
+	SampleRate int           `yaml:"sample_rate"` // sample rate of the returned pcm, 24000 for OpenAI
+	Timeout    time.Duration `yaml:"timeout"`     // timeout of a sentence, e.g. 30s
+}
+
+type DoubaoTtsConfig struct {
+	Endpoint   string `yaml:"endpoint"`    // bidirectional websocket endpoint
+	AppId      string `yaml:"app_id"`      // app id of the console
+	AccessKey  string `yaml:"access_key"`  // access token of the console
+	ResourceId string `yaml:"resource_id"` // e.g. volc.service_type.10029
+	Speaker    string `yaml:"speaker"`     // voice, e.g. zh_female_shuangkuaisisi_moon_bigtts
+}
+
+// LocalTtsConfig is an offline engine run as a subprocess, e.g. piper with
+// args [--model, zh_CN-huayan-medium.onnx, --output-raw] and sample rate 22050
+type LocalTtsConfig struct {
+	Command    string        `yaml:"command"`     // executable reading text from stdin
+	Args       []string      `yaml:"args"`        // arguments of the command
+	Env        []string      `yaml:"env"`         // extra environment, e.g. ESPEAK_DATA_PATH=/usr/share
+	Format     string        `yaml:"format"`      // pcm or wav written to stdout
+	SampleRate int           `yaml:"sample_rate"` // sample rate of pcm, the header of wav wins
+	Workers    int           `yaml:"workers"`     // processes started ahead to hide model loading
+	Timeout    time.Duration `yaml:"timeout"`     // timeout of a sentence, e.g. 10s
+}
+
+// TtsCacheConfig keeps the audio of synthesized sentences, so greetings and
+// common answers are not synthesized again
+type TtsCacheConfig struct {
+	Enable    bool          `yaml:"enable"`     // cache the audio of sentences
+	Dir       string        `yaml:"dir"`        // directory of the audio, kept in memory only if empty
+	MaxMemory int64         `yaml:"max_memory"` // bytes of audio kept in memory, 0 is unlimited
+	MaxDisk   int64         `yaml:"max_disk"`   // bytes of audio kept on disk, 0 is unlimited
+	TTL       time.Duration `yaml:"ttl"`        // audio older than it is synthesized again, 0 keeps it forever
+}
+
 type TtsConfig struct {
+	Provider  string           `yaml:"provider"`   // default provider, one of cosyvoice, openai, doubao, local
 	CosyVoice *CosyVoiceConfig `yaml:"cosy_voice"` // CosyVoice TTS configuration
+	OpenAI    *OpenAITtsConfig `yaml:"openai"`     // any OpenAI compatible /audio/speech TTS
+	Doubao    *DoubaoTtsConfig `yaml:"doubao"`     // Volcengine/Doubao bidirectional streaming TTS
+	Local     *LocalTtsConfig  `yaml:"local"`      // offline engine run as a subprocess, e.g. piper
+
+	SentenceMinRunes int `yaml:"sentence_min_runes"` // shorter sentences are merged with the next one
+	SentenceMaxRunes int `yaml:"sentence_max_runes"` // sentences reaching it are split at the next comma, 0 is unlimited
+	Concurrency      int `yaml:"concurrency"`        // sentences synthesized in parallel, they are still spoken in order
+
+	PlaybackLead time.Duration `yaml:"playback_lead"` // audio sent ahead of playback, small devices overflow if too large, e.g. 200ms
+
+	Normalize      bool              `yaml:"normalize"`      // strip Markdown and emoji, spell out numbers, dates and units
+	Pronunciations map[string]string `yaml:"pronunciations"` // words read otherwise, e.g. 行长: 杭长, applied if normalize is enabled
+
+	Cache *TtsCacheConfig `yaml:"cache"` // audio of synthesized sentences
+}
+
+type HistoryConfig struct {
+	Enable        bool          `yaml:"enable"`         // persist conversation turns per device
+	ResumeWindow  time.Duration `yaml:"resume_window"`  // turns newer than this are restored on reconnect, e.g. 30m
+	MaxTurns      int           `yaml:"max_turns"`      // max turns restored on reconnect
+	Retention     time.Duration `yaml:"retention"`      // turns older than this are removed, 0 keeps them forever
+	ForgetPhrases []string      `yaml:"forget_phrases"` // voice commands which clear the history of the device
+	ForgetReply   string        `yaml:"forget_reply"`   // spoken after the history is cleared
+}
+
+type IntentIotConfig struct {
+	Name       string         `yaml:"name"`       // IoT thing, e.g. Speaker
+	Method     string         `yaml:"method"`     // method of the thing, e.g. SetVolume
+	Parameters map[string]any `yaml:"parameters"` // e.g. volume: 80
+}
+
+// IntentSpeechConfig changes the speech of the device, saved in its settings
+type IntentSpeechConfig struct {
+	Rate  float32 `yaml:"rate"`  // added to the speech rate, e.g. -0.2 to speak slower
+	Gain  float32 `yaml:"gain"`  // dB added to the gain, e.g. -4 to speak softer
+	Pitch float32 `yaml:"pitch"` // semitones added to the pitch
+	Reset bool    `yaml:"reset"` // back to the normal speech, the changes are ignored
+}
+
+type IntentRule struct {
+	Name     string           `yaml:"name"`     // name of the intent, logged when matched
+	Patterns []string         `yaml:"patterns"` // regular expressions, matched against the lower cased text without punctuations
+	Keywords []string         `yaml:"keywords"` // phrases contained in the lower cased text without punctuations
+	Action   string           `yaml:"action"`   // one of reply, system, alert, abort, iot, speech
+	Reply    string           `yaml:"reply"`    // text/template spoken after the action, e.g. 现在是{{.Time}}
+	Command  string           `yaml:"command"`  // command of system action, e.g. reboot
+	Status   string           `yaml:"status"`   // status of alert action
+	Message  string           `yaml:"message"`  // message of alert action
+	Emotion  string           `yaml:"emotion"`  // emotion of alert action
+	Iot      *IntentIotConfig `yaml:"iot"`      // command of iot action
+
+	Speech *IntentSpeechConfig `yaml:"speech"` // change of speech action
+}
+
+type IntentConfig struct {
+	Enable bool         `yaml:"enable"` // answer matched commands locally instead of asking LLM
+	Rules  []IntentRule `yaml:"rules"`  // tried in order, the first match wins
+}
+
+type FactsConfig struct {
+	Enable   bool   `yaml:"enable"`    // let LLM save, update and forget facts about the user
+	MaxFacts int    `yaml:"max_facts"` // most recently updated facts added to the system prompt
+	Prompt   string `yaml:"prompt"`    // introduces the facts to LLM
+}
+
+type KnowledgeBaseConfig struct {
+	Name string `yaml:"name"` // referenced by personas and devices
+	Dir  string `yaml:"dir"`  // markdown and text documents, uploaded documents are saved here too
+}
+
+type KnowledgeConfig struct {
+	Bases     []*KnowledgeBaseConfig `yaml:"bases"`      // knowledge bases loaded on start
+	Root      string                 `yaml:"root"`       // bases created through the admin API are stored in a directory of their name here, in memory only if empty
+	TopK      int                    `yaml:"top_k"`      // passages added to the prompt for every question
+	MinScore  float64                `yaml:"min_score"`  // passages scoring lower are ignored, BM25 scores depend on the size of the base
+	ChunkSize int                    `yaml:"chunk_size"` // runes of a passage
+	Prompt    string                 `yaml:"prompt"`     // introduces the passages to LLM
+}
+
+type PersonaConfig struct {
+	SystemPrompt string   `yaml:"system_prompt"` // replaces the system prompt of llm, empty keeps it
+	Profile      string   `yaml:"profile"`       // LLM profile, empty uses the default one
+	Knowledge    []string `yaml:"knowledge"`     // knowledge bases searched for every question
+	Tts          string   `yaml:"tts"`           // TTS provider, empty uses the default one
+	Voice        string   `yaml:"voice"`         // preset or custom voice, empty uses the one of the provider
+}
+
+// MediaConfig is the local library of music and stories played on request
+type MediaConfig struct {
+	Enable     bool   `yaml:"enable"`      // let LLM search and play the library
+	Dir        string `yaml:"dir"`         // MP3, WAV and Ogg Opus files, sub directories are categories, e.g. 儿歌, 睡前故事
+	MaxResults int    `yaml:"max_results"` // tracks listed by a search
+}
+
+// AnnounceConfig pushes announcements of the admin API to devices
+type AnnounceConfig struct {
+	AssetDir  string        `yaml:"asset_dir"`  // pre-recorded MP3, WAV and Ogg Opus announcements
+	QueueTTL  time.Duration `yaml:"queue_ttl"`  // announcements queued longer for an offline device expire, 0 never
+	MaxQueued int           `yaml:"max_queued"` // announcements queued per offline device, the oldest expire
+	History   int           `yaml:"history"`    // announcements whose delivery status is kept
+}
+
+// VisionConfig is the multimodal model explaining photos of camera equipped
+// devices, the endpoint is advertised to devices through OTA and MCP
+type VisionConfig struct {
+	Enable       bool          `yaml:"enable"`         // serve and advertise the vision endpoint
+	Url          string        `yaml:"url"`            // endpoint advertised to devices, fully qualified URL, e.g. http://192.168.1.7:3457/xiaozhi/vision/explain
+	Token        string        `yaml:"token"`          // bearer token of devices, empty uses the token of ota
+	BaseUrl      string        `yaml:"base_url"`       // OpenAI compatible API, e.g. https://dashscope.aliyuncs.com/compatible-mode/v1
+	ApiKey       string        `yaml:"api_key"`        // API key of the model
+	Model        string        `yaml:"model"`          // multimodal model, e.g. qwen-vl-plus
+	MaxTokens    int           `yaml:"max_tokens"`     // upper bound of an answer, keep it short for voice
+	MaxImageSize int64         `yaml:"max_image_size"` // bytes of an uploaded image
+	Timeout      time.Duration `yaml:"timeout"`        // timeout of a request to the model, e.g. 30s
+	Prompt       string        `yaml:"prompt"`         // prepended to the question of the device
 }
 
 type Config struct {
-	Addr          string     `yaml:"addr"`        // endpoint of both WS and HTTP, publicly accessible
-	WebUIAddr     string     `yaml:"web_ui_addr"` // web UI address
-	Log           *LogConfig `yaml:"log"`         // log
-	Ota           *OtaConfig `yaml:"ota"`         // OTA configuration
-	Asr           *AsrConfig `yaml:"asr"`         // ASR configuration
-	Llm           *LlmConfig `yaml:"llm"`         // LLM configuration, if needed
-	Tts           *TtsConfig `yaml:"tts"`         // TTS configuration, if needed
-	EnableProfile bool       `yaml:"enable_profile"`
+	Addr           string                    `yaml:"addr"`            // endpoint of both WS and HTTP, publicly accessible
+	WebUIAddr      string                    `yaml:"web_ui_addr"`     // web UI address
+	Log            *LogConfig                `yaml:"log"`             // log
+	Ota            *OtaConfig                `yaml:"ota"`             // OTA configuration
+	Asr            *AsrConfig                `yaml:"asr"`             // ASR configuration
+	Llm            *LlmConfig                `yaml:"llm"`             // LLM configuration, if needed
+	Tts            *TtsConfig                `yaml:"tts"`             // TTS configuration, if needed
+	History        *HistoryConfig            `yaml:"history"`         // conversation history configuration
+	Intent         *IntentConfig             `yaml:"intent"`          // local command intents
+	Facts          *FactsConfig              `yaml:"facts"`           // long-term facts about users
+	Knowledge      *KnowledgeConfig          `yaml:"knowledge"`       // offline knowledge bases
+	Personas       map[string]*PersonaConfig `yaml:"personas"`        // personas assignable to devices
+	DefaultPersona string                    `yaml:"default_persona"` // persona of devices without one
+	Vision         *VisionConfig             `yaml:"vision"`          // photo explaining of camera equipped devices
+	Media          *MediaConfig              `yaml:"media"`           // local music and stories
+	Announce       *AnnounceConfig           `yaml:"announce"`        // announcements pushed to devices
+	EnableProfile  bool                      `yaml:"enable_profile"`
 }
 
 func DefaultConfig() *Config {
@@ -72,18 +308,173 @@ func DefaultConfig() *Config {
 			Doubao: &DoubalAsrConfig{},
 		},
 		Llm: &LlmConfig{
+			Provider:     "deepseek",
+			SystemPrompt: "你是小智，一个简短、友好的语音助手。回答要口语化，不要使用 Markdown。",
+			Context: &LlmContextConfig{
+				MaxTokens:        4096,
+				KeepTurns:        4,
+				Summarize:        true,
+				SummaryMaxTokens: 256,
+			},
 			Deepseek: &DeepseekConfig{
 				BaseUrl: "https://api.deepseek.com/v1/chat/completions",
 				Model:   "deepseek-chat-3.5",
 				ApiKey:  "",
 			},
+			Ollama: &OllamaConfig{
+				BaseUrl:   "http://localhost:11434",
+				Model:     "qwen2.5:7b",
+				KeepAlive: "5m",
+			},
+			Anthropic: &AnthropicConfig{
+				BaseUrl:   "https://api.anthropic.com",
+				Model:     "claude-3-5-haiku-latest",
+				MaxTokens: 1024,
+				Version:   "2023-06-01",
+			},
+			Dify: &DifyConfig{
+				BaseUrl: "https://api.dify.ai/v1",
+			},
+			Failover: &LlmFailoverConfig{
+				Providers:        []string{"deepseek"},
+				MaxRetries:       2,
+				Backoff:          200 * time.Millisecond,
+				MaxBackoff:       2 * time.Second,
+				AttemptTimeout:   15 * time.Second,
+				Deadline:         30 * time.Second,
+				BreakerThreshold: 3,
+				BreakerCooldown:  30 * time.Second,
+			},
+			FallbackAnswer: "抱歉，我现在有点忙，请稍后再问我吧。",
+			Emotion: &LlmEmotionConfig{
+				Enable:   true,
+				Fallback: "neutral",
+			},
 		},
 		Tts: &TtsConfig{
+			Provider: "cosyvoice",
 			CosyVoice: &CosyVoiceConfig{
 				BaseUrl: "https://api.siliconflow.cn",
-				Voice:   "benjimin",
+				Voice:   "benjamin",
 				ApiKey:  "",
 			},
+			OpenAI: &OpenAITtsConfig{
+				BaseUrl:    "https://api.openai.com/v1",
+				Model:      "tts-1",
+				Voice:      "alloy",
+				SampleRate: 24000,
+				Timeout:    30 * time.Second,
+			},
+			Doubao: &DoubaoTtsConfig{
+				Endpoint:   "wss://openspeech.bytedance.com/api/v3/tts/bidirection",
+				ResourceId: "volc.service_type.10029",
+				Speaker:    "zh_female_shuangkuaisisi_moon_bigtts",
+			},
+			SentenceMinRunes: 6,
+			SentenceMaxRunes: 60,
+			Concurrency:      2,
+			PlaybackLead:     200 * time.Millisecond,
+			Normalize:        true,
+			Cache: &TtsCacheConfig{
+				Enable:    false,
+				Dir:       "data/tts_cache",
+				MaxMemory: 32 << 20,
+				MaxDisk:   1 << 30,
+				TTL:       30 * 24 * time.Hour,
+			},
+		},
+		History: &HistoryConfig{
+			Enable:       true,
+			ResumeWindow: 30 * time.Minute,
+			MaxTurns:     20,
+			Retention:    7 * 24 * time.Hour,
+			ForgetPhrases: []string{
+				"忘记我们的对话",
+				"忘掉刚才的对话",
+				"清除对话记录",
+				"forget our conversation",
+				"forget everything",
+			},
+			ForgetReply: "好的，我已经忘记了之前的对话。",
+		},
+		Intent: &IntentConfig{
+			Enable: true,
+			Rules: []IntentRule{
+				{
+					Name:     "time",
+					Patterns: []string{`^(现在)?(几点|什么时间)(了|钟)?(了)?$`, `^what time is it( now)?$`},
+					Action:   "reply",
+					Reply:    "现在是{{.Time}}。",
+				},
+				{
+					Name:     "date",
+					Patterns: []string{`^(今天)?(几号|是几号|什么日子|星期几)(了)?$`, `^what (day|date) is (it|today)$`},
+					Action:   "reply",
+					Reply:    "今天是{{.Date}}，{{.Weekday}}。",
+				},
+				{
+					Name:     "reboot",
+					Patterns: []string{`^(重启|重新启动)(一下)?(设备)?$`, `^(reboot|restart)( the device| yourself)?$`},
+					Action:   "system",
+					Command:  "reboot",
+				},
+				{
+					Name:     "stop",
+					Patterns: []string{`^(别说了|不要说了|闭嘴|停止|停下|安静)(吧)?$`, `^(stop talking|be quiet|shut up|stop)$`},
+					Action:   "abort",
+				},
+				{
+					// the server does not know the volume of the device, so the levels are fixed
+					Name:     "volume_high",
+					Patterns: []string{`^(把)?(音量|声音)(调|开)(到)?(高|高音量|大音量)(吧)?$`, `^(set the )?volume (to )?high$`},
+					Action:   "iot",
+					Reply:    "好的，音量调高了。",
+					Iot: &IntentIotConfig{
+						Name:       "Speaker",
+						Method:     "SetVolume",
+						Parameters: map[string]any{"volume": 90},
+					},
+				},
+				{
+					Name:     "volume_low",
+					Patterns: []string{`^(把)?(音量|声音)(调|开)(到)?(低|低音量|小音量)(吧)?$`, `^(set the )?volume (to )?low$`},
+					Action:   "iot",
+					Reply:    "好的，音量调低了。",
+					Iot: &IntentIotConfig{
+						Name:       "Speaker",
+						Method:     "SetVolume",
+						Parameters: map[string]any{"volume": 40},
+					},
+				},
+				{
+					Name:     "slower",
+					Patterns: []string{`^(说话|说得|说|讲)?(慢|慢一)点(儿)?(说)?$`, `^(speak|talk) (slower|more slowly)$`},
+					Action:   "speech",
+					Reply:    "好的。",
+					Speech:   &IntentSpeechConfig{Rate: -0.2},
+				},
+				{
+					Name:     "faster",
+					Patterns: []string{`^(说话|说得|说|讲)?(快|快一)点(儿)?(说)?$`, `^(speak|talk) faster$`},
+					Action:   "speech",
+					Reply:    "好的。",
+					Speech:   &IntentSpeechConfig{Rate: 0.2},
+				},
+				{
+					Name:     "softer",
+					Patterns: []string{`^(说话|说得)(轻|轻一)点(儿)?$`, `^(speak|talk) (softer|more softly)$`},
+					Action:   "speech",
+					Reply:    "好的。",
+					Speech:   &IntentSpeechConfig{Gain: -4},
+				},
+				{
+					Name:     "normal_speech",
+					Patterns: []string{`^(恢复)?正常(的)?(语速|说话|声音)$`, `^(speak|talk) normally$`},
+					Action:   "speech",
+					Reply:    "好的。",
+					Speech:   &IntentSpeechConfig{Reset: true},
+				},
+			},
 		},
 		Ota: &OtaConfig{
 			WsEndpoint:      "ws://192.168.1.7:3457/xiaozhi/ws/",
@@ -93,6 +484,40 @@ func DefaultConfig() *Config {
 			Timezone:        "Asia/Shanghai",
 			TimezoneOffset:  28800, // Asia/Shanghai is UTC+8
 		},
+		Facts: &FactsConfig{
+			Enable:   true,
+			MaxFacts: 20,
+			Prompt:   "以下是你记住的关于用户的长期信息，方括号中是编号。用户告诉你新的长期信息时用 remember_fact 记住，信息变化时用 update_fact 更新，用户要求忘记时用 forget_fact 删除：",
+		},
+		Knowledge: &KnowledgeConfig{
+			Root:      "data/knowledge",
+			TopK:      3,
+			MinScore:  0,
+			ChunkSize: 300,
+			Prompt:    "以下是知识库中与问题相关的资料，回答时优先依据这些资料，并简短说明出处；资料中没有的内容不要编造。",
+		},
+		Personas: map[string]*PersonaConfig{},
+		Media: &MediaConfig{
+			Enable:     false,
+			Dir:        "data/media",
+			MaxResults: 10,
+		},
+		Announce: &AnnounceConfig{
+			AssetDir:  "data/announcements",
+			QueueTTL:  24 * time.Hour,
+			MaxQueued: 20,
+			History:   100,
+		},
+		Vision: &VisionConfig{
+			Enable:       false,
+			Url:          "http://192.168.1.7:3457/xiaozhi/vision/explain",
+			BaseUrl:      "https://dashscope.aliyuncs.com/compatible-mode/v1",
+			Model:        "qwen-vl-plus",
+			MaxTokens:    300,
+			MaxImageSize: 2 << 20,
+			Timeout:      30 * time.Second,
+			Prompt:       "请用简短口语化的中文回答，不要使用 Markdown。",
+		},
 		EnableProfile: false,
 	}
 }
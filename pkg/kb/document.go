@@ -0,0 +1,87 @@
+package kb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const DefaultChunkSize = 300
+
+type Passage struct {
+	Id     string `json:"id"`     // source and position of the passage, e.g. manual.md#3
+	Source string `json:"source"` // file the passage comes from
+	Title  string `json:"title"`  // nearest markdown heading, empty for plain text
+	Text   string `json:"text"`
+}
+
+// Split cuts a document into passages of about chunkSize runes. Paragraphs
+// are kept whole unless they are longer than chunkSize, and markdown headings
+// start new passages and become their titles.
+func Split(source, content string, chunkSize int) []*Passage {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	markdown := strings.EqualFold(filepath.Ext(source), ".md") ||
+		strings.EqualFold(filepath.Ext(source), ".markdown")
+
+	var (
+		passages []*Passage
+		title    string
+		buf      strings.Builder
+	)
+
+	flush := func() {
+		text := strings.TrimSpace(buf.String())
+		buf.Reset()
+		if len(text) == 0 {
+			return
+		}
+
+		passages = append(passages, &Passage{
+			Id:     fmt.Sprintf("%s#%d", source, len(passages)+1),
+			Source: source,
+			Title:  title,
+			Text:   text,
+		})
+	}
+
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	for _, paragraph := range strings.Split(content, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if len(paragraph) == 0 {
+			continue
+		}
+
+		if markdown && strings.HasPrefix(paragraph, "#") {
+			heading, rest, _ := strings.Cut(paragraph, "\n")
+			flush()
+			title = strings.TrimSpace(strings.TrimLeft(heading, "#"))
+			paragraph = strings.TrimSpace(rest)
+			if len(paragraph) == 0 {
+				continue
+			}
+		}
+
+		if buf.Len() != 0 && utf8.RuneCountInString(buf.String())+utf8.RuneCountInString(paragraph) > chunkSize {
+			flush()
+		}
+
+		for utf8.RuneCountInString(paragraph) > chunkSize {
+			runes := []rune(paragraph)
+			buf.WriteString(string(runes[:chunkSize]))
+			flush()
+			paragraph = string(runes[chunkSize:])
+		}
+
+		if buf.Len() != 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(paragraph)
+	}
+	flush()
+
+	return passages
+}
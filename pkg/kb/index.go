@@ -0,0 +1,189 @@
+package kb
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// BM25 parameters, the common defaults
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type Result struct {
+	Passage *Passage `json:"passage"`
+	Score   float64  `json:"score"`
+}
+
+type indexedPassage struct {
+	passage *Passage
+	terms   map[string]int // term -> frequency
+	length  int            // number of terms
+}
+
+// Index is an in memory BM25 index of passages
+type Index struct {
+	lock        sync.RWMutex
+	passages    []*indexedPassage
+	docFreq     map[string]int // term -> passages containing it
+	totalLength int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docFreq: make(map[string]int),
+	}
+}
+
+func (idx *Index) Add(passages ...*Passage) {
+	indexed := indexPassages(passages)
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.add(indexed)
+}
+
+// Remove drops all passages of source
+func (idx *Index) Remove(source string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.remove(source)
+}
+
+// Replace swaps the passages of source for passages at once, searches see
+// either the old or the new ones
+func (idx *Index) Replace(source string, passages ...*Passage) {
+	indexed := indexPassages(passages)
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.remove(source)
+	idx.add(indexed)
+}
+
+// indexPassages tokenizes passages, which is done before taking the lock
+func indexPassages(passages []*Passage) []*indexedPassage {
+	indexed := make([]*indexedPassage, 0, len(passages))
+	for _, p := range passages {
+		terms := Tokenize(p.Title + "\n" + p.Text)
+		ip := &indexedPassage{
+			passage: p,
+			terms:   make(map[string]int),
+			length:  len(terms),
+		}
+
+		for _, term := range terms {
+			ip.terms[term] += 1
+		}
+		indexed = append(indexed, ip)
+	}
+
+	return indexed
+}
+
+func (idx *Index) add(indexed []*indexedPassage) {
+	for _, ip := range indexed {
+		for term := range ip.terms {
+			idx.docFreq[term] += 1
+		}
+
+		idx.totalLength += ip.length
+		idx.passages = append(idx.passages, ip)
+	}
+}
+
+func (idx *Index) remove(source string) {
+	kept := idx.passages[:0]
+	for _, ip := range idx.passages {
+		if ip.passage.Source != source {
+			kept = append(kept, ip)
+			continue
+		}
+
+		for term := range ip.terms {
+			idx.docFreq[term] -= 1
+			if idx.docFreq[term] == 0 {
+				delete(idx.docFreq, term)
+			}
+		}
+		idx.totalLength -= ip.length
+	}
+
+	for i := len(kept); i < len(idx.passages); i++ {
+		idx.passages[i] = nil
+	}
+	idx.passages = kept
+}
+
+// Sources returns the number of passages of every source
+func (idx *Index) Sources() map[string]int {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	sources := make(map[string]int)
+	for _, ip := range idx.passages {
+		sources[ip.passage.Source] += 1
+	}
+
+	return sources
+}
+
+func (idx *Index) Len() int {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	return len(idx.passages)
+}
+
+// Search returns at most topK passages scoring above minScore, best first
+func (idx *Index) Search(query string, topK int, minScore float64) []Result {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	if len(idx.passages) == 0 || topK <= 0 {
+		return nil
+	}
+
+	queryTerms := make(map[string]struct{})
+	for _, term := range Tokenize(query) {
+		queryTerms[term] = struct{}{}
+	}
+
+	n := float64(len(idx.passages))
+	avgLength := float64(idx.totalLength) / n
+
+	results := make([]Result, 0)
+	for _, ip := range idx.passages {
+		var score float64
+		for term := range queryTerms {
+			tf := float64(ip.terms[term])
+			if tf == 0 {
+				continue
+			}
+
+			df := float64(idx.docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) /
+				(tf + bm25K1*(1-bm25B+bm25B*float64(ip.length)/avgLength))
+		}
+
+		if score > 0 && score >= minScore {
+			results = append(results, Result{Passage: ip.passage, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results
+}
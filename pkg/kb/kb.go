@@ -0,0 +1,281 @@
+package kb
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrKnowledgeBaseNotFound = errors.New("knowledge base not found")
+	ErrKnowledgeBaseExists   = errors.New("knowledge base already exists")
+	ErrUnsupportedDocument   = errors.New("only markdown and text documents are supported")
+	ErrInvalidSource         = errors.New("invalid document source")
+)
+
+type Source struct {
+	Name     string `json:"name"`
+	Passages int    `json:"passages"`
+}
+
+// KnowledgeBase is a named collection of documents searched by BM25. When dir
+// is set the documents are stored there and loaded again on restart.
+type KnowledgeBase struct {
+	name      string
+	dir       string
+	chunkSize int
+	index     *Index
+}
+
+func NewKnowledgeBase(name, dir string, chunkSize int) *KnowledgeBase {
+	return &KnowledgeBase{
+		name:      name,
+		dir:       dir,
+		chunkSize: chunkSize,
+		index:     NewIndex(),
+	}
+}
+
+func (kb *KnowledgeBase) Name() string {
+	return kb.name
+}
+
+// Load ingests every markdown and text document under dir, a missing dir is
+// created by the first ingested document
+func (kb *KnowledgeBase) Load() error {
+	if len(kb.dir) == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(kb.dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(kb.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !IsSupported(path) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read document %s", path)
+		}
+
+		source, err := filepath.Rel(kb.dir, path)
+		if err != nil {
+			return err
+		}
+
+		kb.add(filepath.ToSlash(source), string(content))
+		return nil
+	})
+}
+
+// Ingest adds a document or replaces the one of the same source. The new
+// passages are built first and swapped in at once, so a failure keeps the old
+// document and searches never see a partial one.
+func (kb *KnowledgeBase) Ingest(source string, content []byte) error {
+	source, err := cleanSource(source)
+	if err != nil {
+		return err
+	}
+
+	passages := Split(source, string(content), kb.chunkSize)
+	if len(kb.dir) != 0 {
+		if err := kb.save(source, content); err != nil {
+			return err
+		}
+	}
+
+	kb.index.Replace(source, passages...)
+	return nil
+}
+
+// save writes the document through a temporary file, so it is either the old
+// or the new one on disk
+func (kb *KnowledgeBase) save(source string, content []byte) error {
+	path := filepath.Join(kb.dir, filepath.FromSlash(source))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory of %s", path)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ingest-*")
+	if err != nil {
+		return errors.Wrapf(err, "failed to save document %s", path)
+	}
+	defer os.Remove(tmp.Name()) // fails once renamed
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	return errors.Wrapf(err, "failed to save document %s", path)
+}
+
+func (kb *KnowledgeBase) Remove(source string) error {
+	source, err := cleanSource(source)
+	if err != nil {
+		return err
+	}
+
+	kb.index.Remove(source)
+	if len(kb.dir) == 0 {
+		return nil
+	}
+
+	err = os.Remove(filepath.Join(kb.dir, filepath.FromSlash(source)))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to remove document %s", source)
+	}
+
+	return nil
+}
+
+func (kb *KnowledgeBase) Search(query string, topK int, minScore float64) []Result {
+	return kb.index.Search(query, topK, minScore)
+}
+
+func (kb *KnowledgeBase) Sources() []Source {
+	sources := make([]Source, 0)
+	for name, passages := range kb.index.Sources() {
+		sources = append(sources, Source{Name: name, Passages: passages})
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+
+	return sources
+}
+
+func (kb *KnowledgeBase) add(source, content string) {
+	kb.index.Add(Split(source, content, kb.chunkSize)...)
+}
+
+func IsSupported(source string) bool {
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".md", ".markdown", ".txt":
+		return true
+	}
+
+	return false
+}
+
+// sources are relative paths inside the knowledge base
+func cleanSource(source string) (string, error) {
+	source = filepath.ToSlash(filepath.Clean(strings.TrimSpace(source)))
+	if len(source) == 0 || source == "." || strings.HasPrefix(source, "/") ||
+		source == ".." || strings.HasPrefix(source, "../") {
+		return "", errors.Wrap(ErrInvalidSource, source)
+	}
+
+	if !IsSupported(source) {
+		return "", errors.Wrap(ErrUnsupportedDocument, source)
+	}
+
+	return source, nil
+}
+
+// Manager holds the knowledge bases by name
+type Manager struct {
+	lock  sync.RWMutex
+	bases map[string]*KnowledgeBase
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		bases: make(map[string]*KnowledgeBase),
+	}
+}
+
+func (m *Manager) Add(kb *KnowledgeBase) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.bases[kb.name]; ok {
+		return errors.Wrap(ErrKnowledgeBaseExists, kb.name)
+	}
+
+	m.bases[kb.name] = kb
+	return nil
+}
+
+func (m *Manager) Get(name string) (*KnowledgeBase, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	kb, ok := m.bases[name]
+	if !ok {
+		return nil, errors.Wrap(ErrKnowledgeBaseNotFound, name)
+	}
+
+	return kb, nil
+}
+
+// Remove forgets the knowledge base, its documents on disk are kept
+func (m *Manager) Remove(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.bases[name]; !ok {
+		return errors.Wrap(ErrKnowledgeBaseNotFound, name)
+	}
+
+	delete(m.bases, name)
+	return nil
+}
+
+func (m *Manager) List() []*KnowledgeBase {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	bases := make([]*KnowledgeBase, 0, len(m.bases))
+	for _, kb := range m.bases {
+		bases = append(bases, kb)
+	}
+
+	sort.Slice(bases, func(i, j int) bool {
+		return bases[i].name < bases[j].name
+	})
+
+	return bases
+}
+
+// Search queries the named knowledge bases and merges the results, unknown
+// names are skipped
+func (m *Manager) Search(names []string, query string, topK int, minScore float64) []Result {
+	results := make([]Result, 0)
+	for _, name := range names {
+		kb, err := m.Get(name)
+		if err != nil {
+			continue
+		}
+		results = append(results, kb.Search(query, topK, minScore)...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results
+}
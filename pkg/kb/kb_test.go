@@ -0,0 +1,121 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"小智", "智音", "音箱", "v2", "的", "wifi", "连接"}, Tokenize("小智音箱V2 的 WiFi 连接"))
+	assert.Equal(t, []string{"充电", "电要", "要多", "多久"}, Tokenize("充电要多久？"))
+	assert.Equal(t, []string{"的", "hello"}, Tokenize("的 hello"))
+	assert.Empty(t, Tokenize("，。!?"))
+}
+
+func TestSplit(t *testing.T) {
+	content := "# 充电\n\n使用 Type-C 充电，约两小时充满。\n\n## 指示灯\n红灯表示正在充电。\n\n绿灯表示已充满。"
+	passages := Split("manual.md", content, 300)
+
+	if assert.Len(t, passages, 2) {
+		assert.Equal(t, "manual.md#1", passages[0].Id)
+		assert.Equal(t, "充电", passages[0].Title)
+		assert.Equal(t, "使用 Type-C 充电，约两小时充满。", passages[0].Text)
+
+		assert.Equal(t, "指示灯", passages[1].Title)
+		assert.Equal(t, "红灯表示正在充电。\n绿灯表示已充满。", passages[1].Text)
+	}
+
+	// headings are plain text in txt documents, long paragraphs are cut
+	passages = Split("faq.txt", "# 不是标题\n\n一二三四五六七八九十", 4)
+	assert.Len(t, passages, 5)
+	assert.Equal(t, "", passages[0].Title)
+	assert.Equal(t, "# 不是", passages[0].Text)
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(Split("manual.md", "# 充电\n\n使用 Type-C 接口充电，约两小时充满。\n\n# 联网\n\n长按按键三秒进入配网模式，连接手机热点。", 300)...)
+	idx.Add(Split("faq.txt", "小智支持中文和英文对话。\n\nThe speaker supports Bluetooth pairing.", 300)...)
+
+	results := idx.Search("怎么充电？", 3, 0)
+	if assert.NotEmpty(t, results) {
+		assert.Equal(t, "manual.md#1", results[0].Passage.Id)
+	}
+
+	results = idx.Search("bluetooth", 3, 0)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "faq.txt", results[0].Passage.Source)
+	}
+
+	assert.Empty(t, idx.Search("天气预报", 3, 0))
+	assert.Len(t, idx.Search("充电 配网 对话", 2, 0), 2)
+
+	idx.Remove("manual.md")
+	assert.Empty(t, idx.Search("充电", 3, 0))
+	assert.Equal(t, map[string]int{"faq.txt": 1}, idx.Sources())
+}
+
+func TestKnowledgeBasePersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	kb := NewKnowledgeBase("product", dir, 0)
+	assert.NoError(t, kb.Ingest("docs/manual.md", []byte("# 充电\n\n约两小时充满。")))
+	assert.ErrorIs(t, kb.Ingest("../escape.md", []byte("x")), ErrInvalidSource)
+	assert.ErrorIs(t, kb.Ingest("image.png", []byte("x")), ErrUnsupportedDocument)
+
+	_, err := os.Stat(filepath.Join(dir, "docs", "manual.md"))
+	assert.NoError(t, err)
+
+	reloaded := NewKnowledgeBase("product", dir, 0)
+	assert.NoError(t, reloaded.Load())
+	assert.Equal(t, []Source{{Name: "docs/manual.md", Passages: 1}}, reloaded.Sources())
+
+	assert.NoError(t, reloaded.Remove("docs/manual.md"))
+	assert.Empty(t, reloaded.Sources())
+	_, err = os.Stat(filepath.Join(dir, "docs", "manual.md"))
+	assert.True(t, os.IsNotExist(err))
+
+	m := NewManager()
+	assert.NoError(t, m.Add(kb))
+	assert.ErrorIs(t, m.Add(kb), ErrKnowledgeBaseExists)
+	assert.Len(t, m.Search([]string{"product", "missing"}, "充电", 3, 0), 1)
+	assert.NoError(t, m.Remove("product"))
+	_, err = m.Get("product")
+	assert.ErrorIs(t, err, ErrKnowledgeBaseNotFound)
+}
+
+func TestKnowledgeBaseReingest(t *testing.T) {
+	dir := t.TempDir()
+	kb := NewKnowledgeBase("product", dir, 0)
+
+	long := []byte("# 充电\n\n约两小时充满。\n\n# 开机\n\n长按电源键。\n\n# 关机\n\n再次长按电源键。")
+	short := []byte("# 充电\n\n约三小时充满。")
+	assert.NoError(t, kb.Ingest("docs/manual.md", long))
+
+	// searches see either document, never a part of one
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			kb.Ingest("docs/manual.md", [][]byte{short, long}[i%2])
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		passages := kb.Sources()[0].Passages
+		assert.Contains(t, []int{1, 3}, passages)
+	}
+
+	// a document failing to be saved keeps the old one
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "docs")))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "docs"), nil, 0644))
+	assert.Error(t, kb.Ingest("docs/manual.md", short))
+	assert.Equal(t, []Source{{Name: "docs/manual.md", Passages: 3}}, kb.Sources())
+}
@@ -0,0 +1,59 @@
+package kb
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into terms without a dictionary. Latin letters and
+// digits form lower cased words, and runs of CJK characters are split into
+// overlapping bigrams, a lone CJK character is a term by itself.
+func Tokenize(text string) []string {
+	var (
+		terms []string
+		word  strings.Builder
+		cjk   []rune
+	)
+
+	flushWord := func() {
+		if word.Len() != 0 {
+			terms = append(terms, word.String())
+			word.Reset()
+		}
+	}
+
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			terms = append(terms, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			terms = append(terms, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
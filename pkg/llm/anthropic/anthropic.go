@@ -0,0 +1,315 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultBaseURL   = "https://api.anthropic.com"
+	DefaultVersion   = "2023-06-01"
+	DefaultMaxTokens = 1024
+)
+
+type AnthropicConfig struct {
+	BaseURL   string `json:"base_url"`   // e.g. https://api.anthropic.com
+	APIKey    string `json:"api_key"`    // sent as x-api-key
+	Model     string `json:"model"`      // e.g. claude-3-5-haiku-latest
+	MaxTokens int    `json:"max_tokens"` // required by the Messages API
+	Version   string `json:"version"`    // anthropic-version header
+
+	Generation llm.GenerationConfig `json:"generation"` // sampling and request parameters, max tokens overrides the one above
+}
+
+// https://docs.anthropic.com/en/api/messages
+type Anthropic struct {
+	cfg    AnthropicConfig
+	client *http.Client
+}
+
+type contentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	Id    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseId string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type messagesRequest struct {
+	Model         string    `json:"model"`
+	MaxTokens     int       `json:"max_tokens"`
+	System        string    `json:"system,omitempty"`
+	Messages      []message `json:"messages"`
+	Tools         []tool    `json:"tools,omitempty"`
+	Stream        bool      `json:"stream"`
+	Temperature   *float32  `json:"temperature,omitempty"`
+	TopP          *float32  `json:"top_p,omitempty"`
+	StopSequences []string  `json:"stop_sequences,omitempty"`
+}
+
+type streamEvent struct {
+	Type         string       `json:"type"`
+	Index        int          `json:"index"`
+	ContentBlock contentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJson string `json:"partial_json"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewAnthropic(cfg AnthropicConfig) *Anthropic {
+	if len(cfg.BaseURL) == 0 {
+		cfg.BaseURL = DefaultBaseURL
+	}
+
+	if len(cfg.Version) == 0 {
+		cfg.Version = DefaultVersion
+	}
+
+	if cfg.Generation.MaxTokens > 0 {
+		cfg.MaxTokens = cfg.Generation.MaxTokens
+	}
+
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = DefaultMaxTokens
+	}
+
+	return &Anthropic{
+		cfg:    cfg,
+		client: llm.NewHTTPClient(cfg.Generation),
+	}
+}
+
+func (a *Anthropic) Response(ctx context.Context, dialogues []llm.Dialogue) (string, error) {
+	return a.Stream(ctx, dialogues, nil)
+}
+
+func (a *Anthropic) Stream(ctx context.Context, dialogues []llm.Dialogue, onDelta func(delta string) error) (string, error) {
+	answer, err := a.messages(ctx, dialogues, nil, onDelta)
+	if err != nil {
+		return "", err
+	}
+
+	return answer.Content, nil
+}
+
+func (a *Anthropic) Chat(ctx context.Context, dialogues []llm.Dialogue, tools []llm.Tool) (*llm.Dialogue, error) {
+	return a.messages(ctx, dialogues, tools, nil)
+}
+
+func (a *Anthropic) messages(ctx context.Context,
+	dialogues []llm.Dialogue,
+	tools []llm.Tool,
+	onDelta func(delta string) error,
+) (*llm.Dialogue, error) {
+	system, messages := toMessages(dialogues)
+	request := messagesRequest{
+		Model:     a.cfg.Model,
+		MaxTokens: a.cfg.MaxTokens,
+		System:    system,
+		Messages:  messages,
+		Stream:    true,
+
+		Temperature:   a.cfg.Generation.Temperature,
+		TopP:          a.cfg.Generation.TopP,
+		StopSequences: a.cfg.Generation.Stop,
+	}
+
+	for _, t := range tools {
+		schema := t.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		request.Tools = append(request.Tools, tool{
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: schema,
+		})
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal anthropic request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(a.cfg.BaseURL, "/")+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", a.cfg.APIKey)
+	req.Header.Set("anthropic-version", a.cfg.Version)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send anthropic request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &llm.StatusError{StatusCode: resp.StatusCode, Body: string(raw)}
+	}
+
+	var (
+		content strings.Builder
+		blocks  = make(map[int]*contentBlock)
+		inputs  = make(map[int]*strings.Builder)
+		order   = make([]int, 0)
+	)
+
+	err = llm.ReadServerSentEvents(resp.Body, func(_, data string) error {
+		var event streamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return errors.Wrapf(err, "failed to decode anthropic event %s", data)
+		}
+
+		switch event.Type {
+		case "content_block_start":
+			block := event.ContentBlock
+			blocks[event.Index] = &block
+			inputs[event.Index] = &strings.Builder{}
+			order = append(order, event.Index)
+
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				content.WriteString(event.Delta.Text)
+				if onDelta != nil {
+					return onDelta(event.Delta.Text)
+				}
+			case "input_json_delta":
+				if input, ok := inputs[event.Index]; ok {
+					input.WriteString(event.Delta.PartialJson)
+				}
+			}
+
+		case "error":
+			return errors.Errorf("anthropic error %s: %s", event.Error.Type, event.Error.Message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &llm.Dialogue{
+		Role:    llm.RoleAssistant,
+		Content: content.String(),
+	}
+
+	for _, index := range order {
+		block := blocks[index]
+		if block.Type != "tool_use" {
+			continue
+		}
+
+		arguments := inputs[index].String()
+		if len(arguments) == 0 {
+			arguments = "{}"
+		}
+		answer.ToolCalls = append(answer.ToolCalls, llm.ToolCall{
+			Id:        block.Id,
+			Name:      block.Name,
+			Arguments: arguments,
+		})
+	}
+
+	return answer, nil
+}
+
+// toMessages moves system dialogues to the system field and converts the rest
+// to content blocks. Tool results are sent by the user, and consecutive
+// messages of the same role are merged as the API requires alternating roles.
+func toMessages(dialogues []llm.Dialogue) (string, []message) {
+	var system []string
+	messages := make([]message, 0, len(dialogues))
+
+	for _, d := range dialogues {
+		var (
+			role   string
+			blocks []contentBlock
+		)
+
+		switch d.Role {
+		case llm.RoleSystem:
+			system = append(system, d.Content)
+			continue
+
+		case llm.RoleTool:
+			role = llm.RoleUser
+			blocks = append(blocks, contentBlock{
+				Type:      "tool_result",
+				ToolUseId: d.ToolCallId,
+				Content:   d.Content,
+			})
+
+		default:
+			role = d.Role
+			if len(d.Content) != 0 {
+				blocks = append(blocks, contentBlock{Type: "text", Text: d.Content})
+			}
+
+			for _, call := range d.ToolCalls {
+				input := json.RawMessage(call.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, contentBlock{
+					Type:  "tool_use",
+					Id:    call.Id,
+					Name:  call.Name,
+					Input: input,
+				})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if len(messages) != 0 && messages[len(messages)-1].Role == role {
+			last := &messages[len(messages)-1]
+			last.Content = append(last.Content, blocks...)
+			continue
+		}
+
+		messages = append(messages, message{Role: role, Content: blocks})
+	}
+
+	return strings.Join(system, "\n\n"), messages
+}
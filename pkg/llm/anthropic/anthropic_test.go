@@ -0,0 +1,149 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildAnthropicServer(t *testing.T, status int, events ...string) (*httptest.Server, *messagesRequest, *http.Header) {
+	var (
+		received messagesRequest
+		headers  http.Header
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		headers = r.Header.Clone()
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", event)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+	return srv, &received, &headers
+}
+
+func TestAnthropicStream(t *testing.T) {
+	srv, received, headers := buildAnthropicServer(t, http.StatusOK,
+		`{"type":"message_start","message":{"id":"msg_1","role":"assistant"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_stop"}`,
+	)
+
+	a := NewAnthropic(AnthropicConfig{BaseURL: srv.URL, APIKey: "sk-test", Model: "claude-test"})
+
+	deltas := make([]string, 0)
+	answer, err := a.Stream(context.Background(), []llm.Dialogue{
+		{Role: llm.RoleSystem, Content: "you are xiaozhi"},
+		{Role: llm.RoleUser, Content: "hi"},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello there", answer)
+	assert.Equal(t, []string{"Hello", " there"}, deltas)
+
+	assert.Equal(t, "sk-test", headers.Get("x-api-key"))
+	assert.Equal(t, DefaultVersion, headers.Get("anthropic-version"))
+	assert.Equal(t, "you are xiaozhi", received.System)
+	assert.Equal(t, DefaultMaxTokens, received.MaxTokens)
+	assert.Len(t, received.Messages, 1)
+	assert.Equal(t, "text", received.Messages[0].Content[0].Type)
+}
+
+func TestAnthropicToolUse(t *testing.T) {
+	srv, received, _ := buildAnthropicServer(t, http.StatusOK,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me check."}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Beijing\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+	)
+
+	a := NewAnthropic(AnthropicConfig{BaseURL: srv.URL, Model: "claude-test"})
+	answer, err := a.Chat(context.Background(), []llm.Dialogue{
+		{Role: llm.RoleUser, Content: "weather?"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{
+			{Id: "toolu_0", Name: "get_city", Arguments: `{}`},
+			{Id: "toolu_x", Name: "get_unit", Arguments: `{}`},
+		}},
+		{Role: llm.RoleTool, ToolCallId: "toolu_0", Content: "Beijing"},
+		{Role: llm.RoleTool, ToolCallId: "toolu_x", Content: "celsius"},
+	}, []llm.Tool{{Name: "get_weather", Description: "weather of a city"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Let me check.", answer.Content)
+	assert.Len(t, answer.ToolCalls, 1)
+	assert.Equal(t, "toolu_1", answer.ToolCalls[0].Id)
+	assert.JSONEq(t, `{"city":"Beijing"}`, answer.ToolCalls[0].Arguments)
+
+	assert.Len(t, received.Tools, 1)
+	assert.NotNil(t, received.Tools[0].InputSchema)
+	assert.Len(t, received.Messages, 3, "tool results must be merged into one user message")
+	assert.Equal(t, "tool_use", received.Messages[1].Content[0].Type)
+	assert.Equal(t, llm.RoleUser, received.Messages[2].Role)
+	assert.Len(t, received.Messages[2].Content, 2)
+	assert.Equal(t, "toolu_x", received.Messages[2].Content[1].ToolUseId)
+}
+
+func TestAnthropicStatusError(t *testing.T) {
+	srv, _, _ := buildAnthropicServer(t, 529)
+
+	a := NewAnthropic(AnthropicConfig{BaseURL: srv.URL, Model: "claude-test"})
+	_, err := a.Response(context.Background(), []llm.Dialogue{{Role: llm.RoleUser, Content: "hi"}})
+
+	var statusErr *llm.StatusError
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, 529, statusErr.StatusCode)
+}
+
+func TestAnthropicGeneration(t *testing.T) {
+	srv, received, headers := buildAnthropicServer(t, http.StatusOK,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"ok"}}`,
+	)
+
+	temperature := float32(0.3)
+	a := NewAnthropic(AnthropicConfig{
+		BaseURL: srv.URL,
+		Model:   "claude-test",
+		Generation: llm.GenerationConfig{
+			Temperature: &temperature,
+			MaxTokens:   128,
+			Stop:        []string{"\n\n"},
+			Headers:     map[string]string{"X-Gateway-Key": "gw"},
+		},
+	})
+
+	_, err := a.Response(context.Background(), []llm.Dialogue{{Role: llm.RoleUser, Content: "hi"}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 128, received.MaxTokens)
+	assert.Equal(t, &temperature, received.Temperature)
+	assert.Nil(t, received.TopP)
+	assert.Equal(t, []string{"\n\n"}, received.StopSequences)
+	assert.Equal(t, "gw", headers.Get("X-Gateway-Key"))
+}
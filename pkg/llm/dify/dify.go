@@ -0,0 +1,170 @@
+package dify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultBaseURL = "https://api.dify.ai/v1"
+)
+
+type DifyConfig struct {
+	BaseURL string         `json:"base_url"` // e.g. https://api.dify.ai/v1
+	APIKey  string         `json:"api_key"`  // app API key
+	User    string         `json:"user"`     // end user identity, the device id
+	Inputs  map[string]any `json:"inputs"`   // app variables
+
+	Generation llm.GenerationConfig `json:"generation"` // only timeout and headers apply, the app decides sampling
+}
+
+// Dify talks to the chat-messages API of a Dify style agent platform, the
+// agent keeps the conversation so only the latest question is sent.
+// https://docs.dify.ai/guides/application-publishing/developing-with-apis
+type Dify struct {
+	cfg    DifyConfig
+	client *http.Client
+
+	lock           sync.Mutex
+	conversationId string
+}
+
+type chatRequest struct {
+	Inputs         map[string]any `json:"inputs"`
+	Query          string         `json:"query"`
+	ResponseMode   string         `json:"response_mode"`
+	ConversationId string         `json:"conversation_id"`
+	User           string         `json:"user"`
+}
+
+type chatEvent struct {
+	Event          string `json:"event"`
+	Answer         string `json:"answer"`
+	ConversationId string `json:"conversation_id"`
+
+	// error event
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewDify(cfg DifyConfig) *Dify {
+	if len(cfg.BaseURL) == 0 {
+		cfg.BaseURL = DefaultBaseURL
+	}
+
+	if cfg.Inputs == nil {
+		cfg.Inputs = make(map[string]any)
+	}
+
+	return &Dify{
+		cfg:    cfg,
+		client: llm.NewHTTPClient(cfg.Generation),
+	}
+}
+
+func (d *Dify) ConversationId() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.conversationId
+}
+
+func (d *Dify) SetConversationId(id string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.conversationId = id
+}
+
+func (d *Dify) Response(ctx context.Context, dialogues []llm.Dialogue) (string, error) {
+	return d.Stream(ctx, dialogues, nil)
+}
+
+func (d *Dify) Stream(ctx context.Context, dialogues []llm.Dialogue, onDelta func(delta string) error) (string, error) {
+	query := ""
+	for i := len(dialogues) - 1; i >= 0; i-- {
+		if dialogues[i].Role == llm.RoleUser {
+			query = dialogues[i].Content
+			break
+		}
+	}
+
+	if len(query) == 0 {
+		return "", errors.New("no user dialogue to send")
+	}
+
+	body, err := json.Marshal(chatRequest{
+		Inputs:         d.cfg.Inputs,
+		Query:          query,
+		ResponseMode:   "streaming",
+		ConversationId: d.ConversationId(),
+		User:           d.cfg.User,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal dify request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(d.cfg.BaseURL, "/")+"/chat-messages", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+d.cfg.APIKey)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to send dify request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", &llm.StatusError{StatusCode: resp.StatusCode, Body: string(raw)}
+	}
+
+	var answer strings.Builder
+	err = llm.ReadServerSentEvents(resp.Body, func(_, data string) error {
+		var event chatEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return errors.Wrapf(err, "failed to decode dify event %s", data)
+		}
+
+		if len(event.ConversationId) != 0 {
+			d.SetConversationId(event.ConversationId)
+		}
+
+		switch event.Event {
+		case "message", "agent_message":
+			answer.WriteString(event.Answer)
+			if onDelta != nil && len(event.Answer) != 0 {
+				return onDelta(event.Answer)
+			}
+
+		case "message_replace":
+			// content moderation replaced the whole answer
+			answer.Reset()
+			answer.WriteString(event.Answer)
+
+		case "error":
+			return errors.Errorf("dify error %d %s: %s", event.Status, event.Code, event.Message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return answer.String(), nil
+}
@@ -0,0 +1,73 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDifyConversation(t *testing.T) {
+	requests := make([]chatRequest, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat-messages", r.URL.Path)
+		assert.Equal(t, "Bearer app-test", r.Header.Get("Authorization"))
+
+		var req chatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: ping\n\n")
+		fmt.Fprint(w, `data: {"event":"workflow_started","conversation_id":"conv-1"}`+"\n\n")
+		fmt.Fprint(w, `data: {"event":"agent_message","answer":"你好","conversation_id":"conv-1"}`+"\n\n")
+		fmt.Fprint(w, `data: {"event":"agent_message","answer":"！","conversation_id":"conv-1"}`+"\n\n")
+		fmt.Fprint(w, `data: {"event":"message_end","conversation_id":"conv-1"}`+"\n\n")
+	}))
+	defer srv.Close()
+
+	d := NewDify(DifyConfig{BaseURL: srv.URL + "/v1", APIKey: "app-test", User: "device-1"})
+
+	deltas := make([]string, 0)
+	answer, err := d.Stream(context.Background(), []llm.Dialogue{
+		{Role: llm.RoleSystem, Content: "ignored"},
+		{Role: llm.RoleUser, Content: "第一个问题"},
+		{Role: llm.RoleAssistant, Content: "第一个回答"},
+		{Role: llm.RoleUser, Content: "你好"},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "你好！", answer)
+	assert.Equal(t, []string{"你好", "！"}, deltas)
+	assert.Equal(t, "conv-1", d.ConversationId())
+
+	_, err = d.Response(context.Background(), []llm.Dialogue{{Role: llm.RoleUser, Content: "再见"}})
+	assert.NoError(t, err)
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "你好", requests[0].Query, "only the latest question is sent")
+	assert.Equal(t, "", requests[0].ConversationId)
+	assert.Equal(t, "device-1", requests[0].User)
+	assert.Equal(t, "streaming", requests[0].ResponseMode)
+	assert.Equal(t, "conv-1", requests[1].ConversationId)
+}
+
+func TestDifyErrorEvent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `data: {"event":"error","status":400,"code":"invalid_param","message":"bad query"}`+"\n\n")
+	}))
+	defer srv.Close()
+
+	d := NewDify(DifyConfig{BaseURL: srv.URL})
+	_, err := d.Response(context.Background(), []llm.Dialogue{{Role: llm.RoleUser, Content: "hi"}})
+	assert.ErrorContains(t, err, "bad query")
+}
@@ -0,0 +1,16 @@
+package llm
+
+import (
+	"fmt"
+)
+
+// StatusError is returned by providers when the API answers with a non 2xx
+// status code.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("llm request failed with status code %d: %s", e.StatusCode, e.Body)
+}
@@ -0,0 +1,290 @@
+package failover
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNoProvider = errors.New("no LLM provider available")
+)
+
+type FailoverConfig struct {
+	MaxRetries     int           // retries of a provider on transient errors
+	Backoff        time.Duration // wait before the first retry, doubled on every retry
+	MaxBackoff     time.Duration // upper bound of the wait between retries
+	AttemptTimeout time.Duration // timeout of a single request, 0 means bounded by the deadline only
+	Deadline       time.Duration // deadline of a whole turn across all providers, 0 means no deadline
+}
+
+type Provider struct {
+	Name   string
+	LLM    llm.LLM
+	Health *Health // shared by all chains using the provider
+}
+
+// Chain is an llm.LLM trying providers in order. Transient errors are retried
+// with backoff, and a provider failing repeatedly is skipped by its breaker
+// until it cools down.
+type Chain struct {
+	cfg       FailoverConfig
+	providers []Provider
+	active    atomic.Int32 // index of the provider which answered last
+}
+
+func NewChain(cfg FailoverConfig, providers ...Provider) *Chain {
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 200 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 2 * time.Second
+	}
+
+	for i := range providers {
+		if providers[i].Health == nil {
+			providers[i].Health = NewHealth(providers[i].Name, 0, 0)
+		}
+	}
+
+	return &Chain{
+		cfg:       cfg,
+		providers: providers,
+	}
+}
+
+func (c *Chain) Response(ctx context.Context, dialogues []llm.Dialogue) (string, error) {
+	return c.Stream(ctx, dialogues, nil)
+}
+
+// Stream falls over only until the first delta is delivered, a provider
+// failing in the middle of an answer can not be replaced without repeating it.
+func (c *Chain) Stream(ctx context.Context, dialogues []llm.Dialogue, onDelta func(delta string) error) (string, error) {
+	var answer string
+	err := c.run(ctx, func(ctx context.Context, p Provider) (bool, error) {
+		var (
+			err       error
+			delivered bool
+		)
+
+		streamer, ok := p.LLM.(llm.StreamLLM)
+		if ok && onDelta != nil {
+			answer, err = streamer.Stream(ctx, dialogues, func(delta string) error {
+				delivered = true
+				return onDelta(delta)
+			})
+			return delivered, err
+		}
+
+		answer, err = p.LLM.Response(ctx, dialogues)
+		if err == nil && onDelta != nil && len(answer) != 0 {
+			err = onDelta(answer)
+			delivered = true
+		}
+		return delivered, err
+	})
+
+	return answer, err
+}
+
+// Chat asks providers without function calling support for a plain answer,
+// the tool calls and results they can not read are left out of dialogues
+func (c *Chain) Chat(ctx context.Context, dialogues []llm.Dialogue, tools []llm.Tool) (*llm.Dialogue, error) {
+	var answer *llm.Dialogue
+	err := c.run(ctx, func(ctx context.Context, p Provider) (bool, error) {
+		var err error
+		if chatter, ok := p.LLM.(llm.ToolLLM); ok {
+			answer, err = chatter.Chat(ctx, dialogues, tools)
+			return false, err
+		}
+
+		var content string
+		content, err = p.LLM.Response(ctx, withoutTools(dialogues))
+		answer = &llm.Dialogue{Role: llm.RoleAssistant, Content: content}
+		return false, err
+	})
+
+	return answer, err
+}
+
+// withoutTools drops the tool results and the tool calls of dialogues, the
+// text of the assistant requesting them is kept
+func withoutTools(dialogues []llm.Dialogue) []llm.Dialogue {
+	plain := make([]llm.Dialogue, 0, len(dialogues))
+	for _, d := range dialogues {
+		if d.Role == llm.RoleTool {
+			continue
+		}
+
+		if len(d.ToolCalls) != 0 {
+			if len(d.Content) == 0 {
+				continue
+			}
+			d.ToolCalls = nil
+		}
+		plain = append(plain, d)
+	}
+
+	return plain
+}
+
+func (c *Chain) Stats() []Stats {
+	stats := make([]Stats, 0, len(c.providers))
+	for _, p := range c.providers {
+		stats = append(stats, p.Health.Stats())
+	}
+
+	return stats
+}
+
+// Conversational reports whether a provider keeps the conversation remotely,
+// the chain should then be used through ConversationalChain
+func (c *Chain) Conversational() bool {
+	for _, p := range c.providers {
+		if _, ok := p.LLM.(llm.Conversational); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConversationalChain is a Chain implementing llm.Conversational, the
+// conversation is the one of the provider which answered last since ids of
+// one platform mean nothing to another
+type ConversationalChain struct {
+	*Chain
+}
+
+func (c *ConversationalChain) ConversationId() string {
+	if conversational, ok := c.providers[c.active.Load()].LLM.(llm.Conversational); ok {
+		return conversational.ConversationId()
+	}
+
+	return ""
+}
+
+// SetConversationId resumes the conversation with the active provider, an
+// empty id starts over with every provider
+func (c *ConversationalChain) SetConversationId(id string) {
+	for i, p := range c.providers {
+		conversational, ok := p.LLM.(llm.Conversational)
+		if ok && (len(id) == 0 || int32(i) == c.active.Load()) {
+			conversational.SetConversationId(id)
+		}
+	}
+}
+
+// run calls attempt with providers in order until one succeeds, attempt
+// reports whether output was already delivered so no other provider may be
+// tried anymore
+func (c *Chain) run(ctx context.Context, attempt func(ctx context.Context, p Provider) (bool, error)) error {
+	if c.cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Deadline)
+		defer cancel()
+	}
+
+	lastErr := ErrNoProvider
+	for i, p := range c.providers {
+		backoff := c.cfg.Backoff
+		for retry := 0; retry <= c.cfg.MaxRetries; retry++ {
+			if ctx.Err() != nil {
+				return errors.Wrapf(lastErr, "turn deadline exceeded: %v", ctx.Err())
+			}
+
+			if !p.Health.Allow() {
+				log.Warn().Str("provider", p.Name).Msg("LLM provider skipped, circuit breaker is open")
+				break
+			}
+
+			attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+			if c.cfg.AttemptTimeout > 0 {
+				attemptCtx, cancel = context.WithTimeout(ctx, c.cfg.AttemptTimeout)
+			}
+
+			start := time.Now()
+			delivered, err := attempt(attemptCtx, p)
+			cancel()
+
+			// the caller gave up, e.g. the user interrupted the turn, which
+			// tells nothing about the provider
+			if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+				p.Health.Canceled()
+				return errors.Wrapf(err, "provider %s", p.Name)
+			}
+
+			if err == nil {
+				p.Health.Success()
+				c.active.Store(int32(i))
+				log.Info().Str("provider", p.Name).Int("retry", retry).
+					Dur("latency", time.Since(start)).Msg("LLM attempt succeeded")
+				return nil
+			}
+
+			p.Health.Failure()
+			lastErr = errors.Wrapf(err, "provider %s", p.Name)
+			log.Warn().Err(err).Str("provider", p.Name).Int("retry", retry).
+				Dur("latency", time.Since(start)).Msg("LLM attempt failed")
+
+			if delivered {
+				return lastErr
+			}
+
+			if !IsTransient(err) || retry == c.cfg.MaxRetries {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > c.cfg.MaxBackoff {
+				backoff = c.cfg.MaxBackoff
+			}
+		}
+	}
+
+	return lastErr
+}
+
+// IsTransient reports whether err is worth retrying with the same provider
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var statusErr *llm.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooEarly, http.StatusTooManyRequests:
+			return true
+		}
+		return statusErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// errors of SDKs are not always typed
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "connection refused")
+}
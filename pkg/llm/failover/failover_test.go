@@ -0,0 +1,236 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubLLM struct {
+	calls   int
+	errs    []error // error returned by each call, nil afterwards
+	answer  string
+	latency time.Duration
+	last    []llm.Dialogue // dialogues of the last call
+}
+
+func (s *stubLLM) Response(ctx context.Context, dialogues []llm.Dialogue) (string, error) {
+	s.calls += 1
+	s.last = dialogues
+	if s.latency > 0 {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(s.latency):
+		}
+	}
+
+	if len(s.errs) != 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return s.answer, nil
+}
+
+var (
+	errUnavailable = &llm.StatusError{StatusCode: http.StatusServiceUnavailable}
+	errBadRequest  = &llm.StatusError{StatusCode: http.StatusBadRequest}
+	question       = []llm.Dialogue{{Role: llm.RoleUser, Content: "hi"}}
+)
+
+func fastConfig() FailoverConfig {
+	return FailoverConfig{MaxRetries: 2, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+}
+
+func TestChainRetriesTransientErrors(t *testing.T) {
+	primary := &stubLLM{errs: []error{errUnavailable, errUnavailable}, answer: "primary"}
+	secondary := &stubLLM{answer: "secondary"}
+
+	chain := NewChain(fastConfig(),
+		Provider{Name: "primary", LLM: primary},
+		Provider{Name: "secondary", LLM: secondary})
+
+	answer, err := chain.Response(context.Background(), question)
+	assert.NoError(t, err)
+	assert.Equal(t, "primary", answer)
+	assert.Equal(t, 3, primary.calls)
+	assert.Equal(t, 0, secondary.calls)
+
+	stats := chain.Stats()
+	assert.Equal(t, uint64(3), stats[0].Attempts)
+	assert.Equal(t, uint64(2), stats[0].Failures)
+	assert.Equal(t, uint64(1), stats[0].Successes)
+}
+
+func TestChainFallsThroughOnPermanentError(t *testing.T) {
+	primary := &stubLLM{errs: []error{errBadRequest}}
+	secondary := &stubLLM{answer: "secondary"}
+
+	chain := NewChain(fastConfig(),
+		Provider{Name: "primary", LLM: primary},
+		Provider{Name: "secondary", LLM: secondary})
+
+	answer, err := chain.Response(context.Background(), question)
+	assert.NoError(t, err)
+	assert.Equal(t, "secondary", answer)
+	assert.Equal(t, 1, primary.calls, "permanent errors are not retried")
+}
+
+func TestChainCircuitBreaker(t *testing.T) {
+	primary := &stubLLM{errs: []error{errBadRequest, errBadRequest, errBadRequest}, answer: "primary"}
+	secondary := &stubLLM{answer: "secondary"}
+	health := NewHealth("primary", 2, 20*time.Millisecond)
+
+	chain := NewChain(fastConfig(),
+		Provider{Name: "primary", LLM: primary, Health: health},
+		Provider{Name: "secondary", LLM: secondary})
+
+	for i := 0; i < 3; i++ {
+		answer, err := chain.Response(context.Background(), question)
+		assert.NoError(t, err)
+		assert.Equal(t, "secondary", answer)
+	}
+
+	assert.Equal(t, 2, primary.calls, "breaker opens after two failures")
+	assert.Equal(t, BreakerOpen, health.State())
+	assert.Equal(t, uint64(1), health.Stats().Rejected)
+
+	time.Sleep(25 * time.Millisecond)
+	answer, _ := chain.Response(context.Background(), question)
+	assert.Equal(t, "secondary", answer, "half open trial fails and reopens the breaker")
+	assert.Equal(t, BreakerOpen, health.State())
+
+	time.Sleep(25 * time.Millisecond)
+	answer, _ = chain.Response(context.Background(), question)
+	assert.Equal(t, "primary", answer)
+	assert.Equal(t, BreakerClosed, health.State())
+}
+
+func TestChainDeadline(t *testing.T) {
+	slow := &stubLLM{latency: time.Second, answer: "slow"}
+	never := &stubLLM{answer: "never"}
+
+	cfg := fastConfig()
+	cfg.Deadline = 20 * time.Millisecond
+	chain := NewChain(cfg,
+		Provider{Name: "slow", LLM: slow},
+		Provider{Name: "never", LLM: never})
+
+	start := time.Now()
+	_, err := chain.Response(context.Background(), question)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, 0, never.calls)
+}
+
+func TestChainAttemptTimeout(t *testing.T) {
+	slow := &stubLLM{latency: time.Second, answer: "slow"}
+	fast := &stubLLM{answer: "fast"}
+
+	cfg := fastConfig()
+	cfg.MaxRetries = 0
+	cfg.AttemptTimeout = 10 * time.Millisecond
+	chain := NewChain(cfg,
+		Provider{Name: "slow", LLM: slow},
+		Provider{Name: "fast", LLM: fast})
+
+	answer, err := chain.Response(context.Background(), question)
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", answer)
+}
+
+func TestChainCanceled(t *testing.T) {
+	slow := &stubLLM{latency: time.Second, answer: "slow"}
+	never := &stubLLM{answer: "never"}
+	health := NewHealth("slow", 1, time.Minute)
+
+	chain := NewChain(fastConfig(),
+		Provider{Name: "slow", LLM: slow, Health: health},
+		Provider{Name: "never", LLM: never})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := chain.Response(ctx, question)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, slow.calls, "no retry once the turn is interrupted")
+	assert.Equal(t, 0, never.calls)
+	assert.Equal(t, BreakerClosed, health.State(), "interruptions are not failures")
+	assert.Equal(t, uint64(0), health.Stats().Failures)
+}
+
+type stubConversational struct {
+	stubLLM
+	id string
+}
+
+func (s *stubConversational) ConversationId() string      { return s.id }
+func (s *stubConversational) SetConversationId(id string) { s.id = id }
+
+func TestConversationalChain(t *testing.T) {
+	assert.False(t, NewChain(fastConfig(), Provider{Name: "openai", LLM: &stubLLM{}}).Conversational())
+
+	primary := &stubConversational{stubLLM: stubLLM{errs: []error{errBadRequest}, answer: "primary"}}
+	secondary := &stubConversational{stubLLM: stubLLM{answer: "secondary"}}
+	chain := NewChain(fastConfig(),
+		Provider{Name: "primary", LLM: primary},
+		Provider{Name: "secondary", LLM: secondary})
+	assert.True(t, chain.Conversational())
+
+	var conversational llm.Conversational = &ConversationalChain{Chain: chain}
+	conversational.SetConversationId("restored")
+	assert.Equal(t, "restored", primary.id)
+	assert.Empty(t, secondary.id, "ids of one platform mean nothing to another")
+
+	_, err := chain.Response(context.Background(), question)
+	assert.NoError(t, err)
+	secondary.id = "remote"
+	assert.Equal(t, "remote", conversational.ConversationId(), "the provider which answered is active")
+
+	conversational.SetConversationId("")
+	assert.Empty(t, primary.id)
+	assert.Empty(t, secondary.id)
+}
+
+func TestChainChatWithoutTools(t *testing.T) {
+	plain := &stubLLM{answer: "明天晴"}
+	chain := NewChain(fastConfig(), Provider{Name: "plain", LLM: plain})
+
+	dialogues := []llm.Dialogue{
+		{Role: llm.RoleUser, Content: "明天天气怎么样"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{Id: "call_0", Name: "weather"}}},
+		{Role: llm.RoleTool, ToolCallId: "call_0", Content: "晴"},
+		{Role: llm.RoleAssistant, Content: "我查一下", ToolCalls: []llm.ToolCall{{Id: "call_1", Name: "weather"}}},
+	}
+	answer, err := chain.Chat(context.Background(), dialogues, []llm.Tool{{Name: "weather"}})
+	assert.NoError(t, err)
+	assert.Equal(t, &llm.Dialogue{Role: llm.RoleAssistant, Content: "明天晴"}, answer)
+	assert.Equal(t, []llm.Dialogue{
+		{Role: llm.RoleUser, Content: "明天天气怎么样"},
+		{Role: llm.RoleAssistant, Content: "我查一下"},
+	}, plain.last, "the provider can not read tool dialogues")
+	assert.Len(t, dialogues[3].ToolCalls, 1, "dialogues of the caller are kept")
+}
+
+func TestChainNoProvider(t *testing.T) {
+	_, err := NewChain(fastConfig()).Response(context.Background(), question)
+	assert.ErrorIs(t, err, ErrNoProvider)
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(errUnavailable))
+	assert.True(t, IsTransient(&llm.StatusError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, IsTransient(context.DeadlineExceeded))
+	assert.False(t, IsTransient(errBadRequest))
+	assert.False(t, IsTransient(errors.New("invalid api key")))
+	assert.False(t, IsTransient(nil))
+}
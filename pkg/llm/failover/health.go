@@ -0,0 +1,138 @@
+package failover
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // requests flow normally
+	BreakerOpen     BreakerState = "open"      // requests are rejected until cooldown passes
+	BreakerHalfOpen BreakerState = "half_open" // a single trial request is allowed
+)
+
+type Stats struct {
+	Name      string       `json:"name"`
+	State     BreakerState `json:"state"`
+	Attempts  uint64       `json:"attempts"`  // requests sent, retries included
+	Successes uint64       `json:"successes"` // requests succeeded
+	Failures  uint64       `json:"failures"`  // requests failed
+	Rejected  uint64       `json:"rejected"`  // requests skipped by the open breaker
+}
+
+// Health tracks a provider across all sessions using it: a circuit breaker
+// and counters of the attempts.
+type Health struct {
+	name      string
+	threshold int           // consecutive failures opening the breaker
+	cooldown  time.Duration // how long the breaker stays open
+
+	lock      sync.Mutex
+	state     BreakerState
+	failures  int       // consecutive failures
+	openedAt  time.Time // when the breaker opened
+	trialSent bool      // whether the half open trial request is in flight
+
+	attempts  atomic.Uint64
+	successes atomic.Uint64
+	errors    atomic.Uint64
+	rejected  atomic.Uint64
+}
+
+func NewHealth(name string, threshold int, cooldown time.Duration) *Health {
+	if threshold <= 0 {
+		threshold = 3
+	}
+
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+
+	return &Health{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+// Allow reports whether a request may be sent to the provider now
+func (h *Health) Allow() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.state == BreakerOpen && time.Since(h.openedAt) >= h.cooldown {
+		h.state = BreakerHalfOpen
+		h.trialSent = false
+	}
+
+	switch h.state {
+	case BreakerOpen:
+		h.rejected.Add(1)
+		return false
+	case BreakerHalfOpen:
+		if h.trialSent {
+			h.rejected.Add(1)
+			return false
+		}
+		h.trialSent = true
+	}
+
+	h.attempts.Add(1)
+	return true
+}
+
+func (h *Health) Success() {
+	h.successes.Add(1)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.failures = 0
+	h.state = BreakerClosed
+}
+
+func (h *Health) Failure() {
+	h.errors.Add(1)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.failures += 1
+	if h.state == BreakerHalfOpen || h.failures >= h.threshold {
+		h.state = BreakerOpen
+		h.openedAt = time.Now()
+	}
+}
+
+// Canceled releases a request given up by the caller, it is neither a success
+// nor a failure of the provider
+func (h *Health) Canceled() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.state == BreakerHalfOpen {
+		h.trialSent = false
+	}
+}
+
+func (h *Health) State() BreakerState {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.state
+}
+
+func (h *Health) Stats() Stats {
+	return Stats{
+		Name:      h.name,
+		State:     h.State(),
+		Attempts:  h.attempts.Load(),
+		Successes: h.successes.Load(),
+		Failures:  h.errors.Load(),
+		Rejected:  h.rejected.Load(),
+	}
+}
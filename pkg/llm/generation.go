@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"net/http"
+	"time"
+)
+
+// GenerationConfig holds the sampling and request parameters understood by
+// every provider, zero values keep the defaults of the provider
+type GenerationConfig struct {
+	Temperature *float32          `json:"temperature,omitempty"` // nil keeps the default of the model
+	TopP        *float32          `json:"top_p,omitempty"`       // nil keeps the default of the model
+	MaxTokens   int               `json:"max_tokens,omitempty"`  // upper bound of the answer
+	Stop        []string          `json:"stop,omitempty"`        // sequences ending the answer
+	Timeout     time.Duration     `json:"timeout,omitempty"`     // timeout of a request, the answer included
+	Headers     map[string]string `json:"headers,omitempty"`     // extra headers of every request, e.g. for gateways
+}
+
+// NewHTTPClient returns the client of a provider honoring the timeout and the
+// extra headers of gen
+func NewHTTPClient(gen GenerationConfig) *http.Client {
+	client := &http.Client{
+		Timeout: gen.Timeout,
+	}
+
+	if len(gen.Headers) != 0 {
+		client.Transport = &headerTransport{
+			base:    http.DefaultTransport,
+			headers: gen.Headers,
+		}
+	}
+
+	return client
+}
+
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	return t.base.RoundTrip(req)
+}
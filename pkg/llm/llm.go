@@ -17,11 +17,55 @@ type LLMResponse struct {
 	Err      error  `json:"error,omitempty"`
 }
 
+type ToolCall struct {
+	Id        string `json:"id"`        // id assigned by the model, echoed back in the tool dialogue
+	Name      string `json:"name"`      // name of the tool to call
+	Arguments string `json:"arguments"` // JSON encoded arguments
+}
+
 type Dialogue struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // tools requested by an assistant dialogue
+	ToolCallId string     `json:"tool_call_id,omitempty"` // call answered by a tool dialogue
 }
 
 type LLM interface {
 	Response(ctx context.Context, dialogues []Dialogue) (string, error)
 }
+
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"` // JSON schema of the arguments
+}
+
+// StreamLLM is implemented by providers able to deliver the answer
+// incrementally, onDelta is called with every piece of text as it arrives.
+type StreamLLM interface {
+	LLM
+	Stream(ctx context.Context, dialogues []Dialogue, onDelta func(delta string) error) (string, error)
+}
+
+// ToolLLM is implemented by providers supporting function calling. The
+// returned dialogue is an assistant dialogue carrying content, tool calls or
+// both.
+type ToolLLM interface {
+	LLM
+	Chat(ctx context.Context, dialogues []Dialogue, tools []Tool) (*Dialogue, error)
+}
+
+// VisionLLM is implemented by multimodal providers able to answer a question
+// about an image, mimeType is the type of image, e.g. image/jpeg.
+type VisionLLM interface {
+	Explain(ctx context.Context, question string, image []byte, mimeType string) (string, error)
+}
+
+// Conversational is implemented by agent platforms which keep the
+// conversation remotely, they only need the latest user dialogue and are
+// identified by a conversation id instead.
+type Conversational interface {
+	ConversationId() string
+	SetConversationId(id string)
+}
@@ -0,0 +1,256 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultBaseURL   = "http://localhost:11434"
+	DefaultKeepAlive = "5m"
+)
+
+type OllamaConfig struct {
+	BaseURL   string         `json:"base_url"`   // e.g. http://192.168.1.10:11434
+	Model     string         `json:"model"`      // e.g. qwen2.5:7b
+	KeepAlive string         `json:"keep_alive"` // how long the model stays loaded after a request, e.g. 5m
+	Options   map[string]any `json:"options"`    // model options, e.g. temperature, num_ctx
+
+	Generation llm.GenerationConfig `json:"generation"` // sampling and request parameters, override options
+}
+
+// https://github.com/ollama/ollama/blob/main/docs/api.md#generate-a-chat-completion
+type Ollama struct {
+	cfg    OllamaConfig
+	client *http.Client
+}
+
+type message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+type toolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type tool struct {
+	Type     string   `json:"type"`
+	Function llm.Tool `json:"function"`
+}
+
+type chatRequest struct {
+	Model     string         `json:"model"`
+	Messages  []message      `json:"messages"`
+	Tools     []tool         `json:"tools,omitempty"`
+	Stream    bool           `json:"stream"`
+	KeepAlive string         `json:"keep_alive,omitempty"`
+	Options   map[string]any `json:"options,omitempty"`
+}
+
+type chatResponse struct {
+	Message    message `json:"message"`
+	Done       bool    `json:"done"`
+	DoneReason string  `json:"done_reason"`
+	Error      string  `json:"error"`
+}
+
+func NewOllama(cfg OllamaConfig) *Ollama {
+	if len(cfg.BaseURL) == 0 {
+		cfg.BaseURL = DefaultBaseURL
+	}
+
+	if len(cfg.KeepAlive) == 0 {
+		cfg.KeepAlive = DefaultKeepAlive
+	}
+
+	return &Ollama{
+		cfg:    cfg,
+		client: llm.NewHTTPClient(cfg.Generation),
+	}
+}
+
+func (o *Ollama) Response(ctx context.Context, dialogues []llm.Dialogue) (string, error) {
+	return o.Stream(ctx, dialogues, nil)
+}
+
+func (o *Ollama) Stream(ctx context.Context, dialogues []llm.Dialogue, onDelta func(delta string) error) (string, error) {
+	answer, err := o.chat(ctx, dialogues, nil, onDelta)
+	if err != nil {
+		return "", err
+	}
+
+	return answer.Content, nil
+}
+
+func (o *Ollama) Chat(ctx context.Context, dialogues []llm.Dialogue, tools []llm.Tool) (*llm.Dialogue, error) {
+	return o.chat(ctx, dialogues, tools, nil)
+}
+
+func (o *Ollama) chat(ctx context.Context,
+	dialogues []llm.Dialogue,
+	tools []llm.Tool,
+	onDelta func(delta string) error,
+) (*llm.Dialogue, error) {
+	request := chatRequest{
+		Model:     o.cfg.Model,
+		Messages:  toMessages(dialogues),
+		Stream:    true,
+		KeepAlive: o.cfg.KeepAlive,
+		Options:   o.options(),
+	}
+
+	for _, t := range tools {
+		request.Tools = append(request.Tools, tool{Type: "function", Function: t})
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal ollama request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(o.cfg.BaseURL, "/")+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send ollama request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &llm.StatusError{StatusCode: resp.StatusCode, Body: string(raw)}
+	}
+
+	// the stream is one JSON object per line
+	answer := &llm.Dialogue{Role: llm.RoleAssistant}
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk chatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode ollama chunk %s", string(line))
+		}
+
+		if len(chunk.Error) != 0 {
+			return nil, errors.Errorf("ollama error: %s", chunk.Error)
+		}
+
+		if len(chunk.Message.Content) != 0 {
+			content.WriteString(chunk.Message.Content)
+			if onDelta != nil {
+				if err := onDelta(chunk.Message.Content); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, call := range chunk.Message.ToolCalls {
+			answer.ToolCalls = append(answer.ToolCalls, llm.ToolCall{
+				// ollama does not assign ids to tool calls
+				Id:        fmt.Sprintf("call_%d", len(answer.ToolCalls)),
+				Name:      call.Function.Name,
+				Arguments: string(call.Function.Arguments),
+			})
+		}
+
+		if chunk.Done {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read ollama stream")
+	}
+
+	answer.Content = content.String()
+	return answer, nil
+}
+
+// options merges the generation parameters into the model options
+func (o *Ollama) options() map[string]any {
+	gen := o.cfg.Generation
+	options := make(map[string]any, len(o.cfg.Options))
+	for key, value := range o.cfg.Options {
+		options[key] = value
+	}
+
+	if gen.Temperature != nil {
+		options["temperature"] = *gen.Temperature
+	}
+
+	if gen.TopP != nil {
+		options["top_p"] = *gen.TopP
+	}
+
+	if gen.MaxTokens > 0 {
+		options["num_predict"] = gen.MaxTokens
+	}
+
+	if len(gen.Stop) != 0 {
+		options["stop"] = gen.Stop
+	}
+
+	if len(options) == 0 {
+		return nil
+	}
+
+	return options
+}
+
+func toMessages(dialogues []llm.Dialogue) []message {
+	toolNames := make(map[string]string)
+	messages := make([]message, 0, len(dialogues))
+	for _, d := range dialogues {
+		m := message{
+			Role:    d.Role,
+			Content: d.Content,
+		}
+
+		for _, call := range d.ToolCalls {
+			toolNames[call.Id] = call.Name
+
+			var tc toolCall
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = json.RawMessage(call.Arguments)
+			if !json.Valid(tc.Function.Arguments) {
+				tc.Function.Arguments = json.RawMessage("{}")
+			}
+			m.ToolCalls = append(m.ToolCalls, tc)
+		}
+
+		if d.Role == llm.RoleTool {
+			m.ToolName = toolNames[d.ToolCallId]
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages
+}
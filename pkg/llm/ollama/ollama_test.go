@@ -0,0 +1,122 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildOllamaServer(t *testing.T, lines ...string) (*httptest.Server, *chatRequest) {
+	var received chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+	return srv, &received
+}
+
+func TestOllamaStream(t *testing.T) {
+	srv, received := buildOllamaServer(t,
+		`{"message":{"role":"assistant","content":"你好"},"done":false}`,
+		`{"message":{"role":"assistant","content":"，小智"},"done":false}`,
+		`{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`,
+	)
+
+	o := NewOllama(OllamaConfig{
+		BaseURL: srv.URL,
+		Model:   "qwen2.5:7b",
+		Options: map[string]any{"temperature": 0.2},
+	})
+
+	deltas := make([]string, 0)
+	answer, err := o.Stream(context.Background(), []llm.Dialogue{
+		{Role: llm.RoleSystem, Content: "you are xiaozhi"},
+		{Role: llm.RoleUser, Content: "hello"},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "你好，小智", answer)
+	assert.Equal(t, []string{"你好", "，小智"}, deltas)
+
+	assert.Equal(t, "qwen2.5:7b", received.Model)
+	assert.True(t, received.Stream)
+	assert.Equal(t, DefaultKeepAlive, received.KeepAlive)
+	assert.Equal(t, 0.2, received.Options["temperature"])
+	assert.Len(t, received.Messages, 2)
+}
+
+func TestOllamaToolCall(t *testing.T) {
+	srv, received := buildOllamaServer(t,
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_time","arguments":{"zone":"Asia/Shanghai"}}}]},"done":false}`,
+		`{"message":{"role":"assistant","content":""},"done":true}`,
+	)
+
+	o := NewOllama(OllamaConfig{BaseURL: srv.URL, Model: "qwen2.5:7b"})
+	answer, err := o.Chat(context.Background(), []llm.Dialogue{
+		{Role: llm.RoleUser, Content: "what time is it"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{Id: "call_0", Name: "get_zone", Arguments: `{}`}}},
+		{Role: llm.RoleTool, ToolCallId: "call_0", Content: "Asia/Shanghai"},
+	}, []llm.Tool{{Name: "get_time", Description: "current time"}})
+
+	assert.NoError(t, err)
+	assert.Len(t, answer.ToolCalls, 1)
+	assert.Equal(t, "get_time", answer.ToolCalls[0].Name)
+	assert.JSONEq(t, `{"zone":"Asia/Shanghai"}`, answer.ToolCalls[0].Arguments)
+
+	assert.Len(t, received.Tools, 1)
+	assert.Equal(t, "function", received.Tools[0].Type)
+	assert.Equal(t, "get_zone", received.Messages[2].ToolName)
+}
+
+func TestOllamaError(t *testing.T) {
+	srv, _ := buildOllamaServer(t, `{"error":"model 'foo' not found"}`)
+
+	o := NewOllama(OllamaConfig{BaseURL: srv.URL, Model: "foo"})
+	_, err := o.Response(context.Background(), []llm.Dialogue{{Role: llm.RoleUser, Content: "hi"}})
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestOllamaGeneration(t *testing.T) {
+	srv, received := buildOllamaServer(t,
+		`{"message":{"role":"assistant","content":"ok"},"done":true}`,
+	)
+
+	topP := float32(0.9)
+	o := NewOllama(OllamaConfig{
+		BaseURL: srv.URL,
+		Model:   "qwen2.5:7b",
+		Options: map[string]any{"num_ctx": 4096, "num_predict": 1},
+		Generation: llm.GenerationConfig{
+			TopP:      &topP,
+			MaxTokens: 256,
+			Stop:      []string{"。"},
+		},
+	})
+
+	_, err := o.Response(context.Background(), []llm.Dialogue{{Role: llm.RoleUser, Content: "hi"}})
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, 4096, received.Options["num_ctx"])
+	assert.EqualValues(t, 256, received.Options["num_predict"], "generation overrides options")
+	assert.InDelta(t, 0.9, received.Options["top_p"], 0.0001)
+	assert.Equal(t, []any{"。"}, received.Options["stop"])
+	assert.NotContains(t, received.Options, "temperature")
+}
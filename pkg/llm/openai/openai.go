@@ -2,59 +2,147 @@ package openai
 
 import (
 	"context"
+	"errors"
 
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
 	goopenai "github.com/sashabaranov/go-openai"
 )
 
 type OpenAIConfig struct {
-	ModelName string `json:"model_name"`
-	BaseURL   string `json:"base_url"`
-	APIKey    string `json:"api_key"`
+	ModelName  string               `json:"model_name"`
+	BaseURL    string               `json:"base_url"`
+	APIKey     string               `json:"api_key"`
+	Generation llm.GenerationConfig `json:"generation"` // sampling and request parameters
 }
 
 type OpenAI struct {
-	modelName string
-	baseURL   string
-	apiKey    string
-	client    *goopenai.Client
+	modelName  string
+	baseURL    string
+	apiKey     string
+	generation llm.GenerationConfig
+	client     *goopenai.Client
 }
 
 func NewOpenAI(apiKey, baseUrl, modelName string) *OpenAI {
+	return NewOpenAIWithConfig(OpenAIConfig{
+		ModelName: modelName,
+		BaseURL:   baseUrl,
+		APIKey:    apiKey,
+	})
+}
+
+func NewOpenAIWithConfig(cfg OpenAIConfig) *OpenAI {
 	client := &OpenAI{
-		modelName: modelName,
-		apiKey:    apiKey,
-		baseURL:   baseUrl,
+		modelName:  cfg.ModelName,
+		apiKey:     cfg.APIKey,
+		baseURL:    cfg.BaseURL,
+		generation: cfg.Generation,
 	}
 
-	cfg := goopenai.DefaultConfig(apiKey)
-	cfg.BaseURL = baseUrl
-	client.client = goopenai.NewClientWithConfig(cfg)
+	clientCfg := goopenai.DefaultConfig(cfg.APIKey)
+	clientCfg.BaseURL = cfg.BaseURL
+	clientCfg.HTTPClient = llm.NewHTTPClient(cfg.Generation)
+	client.client = goopenai.NewClientWithConfig(clientCfg)
 
 	return client
 }
 
-// TODO tools to be added - then function call
 func (o *OpenAI) Response(ctx context.Context, dialogues []llm.Dialogue) (string, error) {
+	answer, err := o.Chat(ctx, dialogues, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return answer.Content, nil
+}
+
+func (o *OpenAI) Chat(ctx context.Context, dialogues []llm.Dialogue, tools []llm.Tool) (*llm.Dialogue, error) {
 	request := goopenai.ChatCompletionRequest{
-		Model: o.modelName,
+		Model:     o.modelName,
+		MaxTokens: o.generation.MaxTokens,
+		Stop:      o.generation.Stop,
+	}
+
+	if o.generation.Temperature != nil {
+		request.Temperature = *o.generation.Temperature
+	}
+
+	if o.generation.TopP != nil {
+		request.TopP = *o.generation.TopP
 	}
 
 	for _, dialogue := range dialogues {
-		request.Messages = append(request.Messages, goopenai.ChatCompletionMessage{
-			Role:    dialogue.Role,
-			Content: dialogue.Content,
+		message := goopenai.ChatCompletionMessage{
+			Role:       dialogue.Role,
+			Content:    dialogue.Content,
+			ToolCallID: dialogue.ToolCallId,
+		}
+
+		for _, call := range dialogue.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, goopenai.ToolCall{
+				ID:   call.Id,
+				Type: goopenai.ToolTypeFunction,
+				Function: goopenai.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			})
+		}
+
+		request.Messages = append(request.Messages, message)
+	}
+
+	for _, tool := range tools {
+		parameters := tool.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+
+		request.Tools = append(request.Tools, goopenai.Tool{
+			Type: goopenai.ToolTypeFunction,
+			Function: &goopenai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  parameters,
+			},
 		})
 	}
 
 	resp, err := o.client.CreateChatCompletion(ctx, request)
 	if err != nil {
-		return "", err
+		return nil, toStatusError(err)
 	}
 
+	answer := &llm.Dialogue{Role: llm.RoleAssistant}
 	if len(resp.Choices) == 0 {
-		return "", nil
+		return answer, nil
+	}
+
+	message := resp.Choices[0].Message
+	answer.Content = message.Content
+	for _, call := range message.ToolCalls {
+		answer.ToolCalls = append(answer.ToolCalls, llm.ToolCall{
+			Id:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
+	return answer, nil
+}
+
+// toStatusError exposes the status code of failed requests the same way as
+// the other providers do
+func toStatusError(err error) error {
+	var apiErr *goopenai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode != 0 {
+		return &llm.StatusError{StatusCode: apiErr.HTTPStatusCode, Body: apiErr.Message}
+	}
+
+	var reqErr *goopenai.RequestError
+	if errors.As(err, &reqErr) && reqErr.HTTPStatusCode != 0 {
+		return &llm.StatusError{StatusCode: reqErr.HTTPStatusCode, Body: string(reqErr.Body)}
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return err
 }
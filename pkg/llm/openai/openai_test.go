@@ -2,6 +2,9 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -42,3 +45,59 @@ func TestPingRequest(t *testing.T) {
 	assert.NotEmpty(t, pong, "OpenAI ping request should return a response")
 	assert.Equal(t, "pong", pong, "OpenAI ping request should return 'pong'")
 }
+
+func TestChatToolCalls(t *testing.T) {
+	var request map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"remember_fact","arguments":"{\"content\":\"名字叫小明\"}"}}]}}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewOpenAI("key", srv.URL, "model")
+	answer, err := c.Chat(context.Background(), []llm.Dialogue{
+		{Role: llm.RoleUser, Content: "我叫小明"},
+	}, []llm.Tool{{Name: "remember_fact", Description: "remember a fact"}})
+	assert.NoError(t, err)
+
+	if assert.Len(t, answer.ToolCalls, 1) {
+		assert.Equal(t, "call_1", answer.ToolCalls[0].Id)
+		assert.Equal(t, "remember_fact", answer.ToolCalls[0].Name)
+		assert.JSONEq(t, `{"content":"名字叫小明"}`, answer.ToolCalls[0].Arguments)
+	}
+
+	tools, _ := request["tools"].([]any)
+	assert.Len(t, tools, 1)
+}
+
+func TestExplainImage(t *testing.T) {
+	var request struct {
+		Messages []struct {
+			Content []struct {
+				Type     string `json:"type"`
+				Text     string `json:"text"`
+				ImageURL struct {
+					URL string `json:"url"`
+				} `json:"image_url"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"一只猫"}}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewOpenAI("key", srv.URL, "model")
+	answer, err := c.Explain(context.Background(), "这是什么", []byte("jpeg"), "image/jpeg")
+	assert.NoError(t, err)
+	assert.Equal(t, "一只猫", answer)
+
+	if assert.Len(t, request.Messages, 1) && assert.Len(t, request.Messages[0].Content, 2) {
+		assert.Equal(t, "data:image/jpeg;base64,anBlZw==", request.Messages[0].Content[0].ImageURL.URL)
+		assert.Equal(t, "这是什么", request.Messages[0].Content[1].Text)
+	}
+}
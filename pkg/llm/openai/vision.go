@@ -0,0 +1,51 @@
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+
+	goopenai "github.com/sashabaranov/go-openai"
+)
+
+// Explain sends image inline as a data URL along with question, most OpenAI
+// compatible multimodal models, e.g. qwen-vl or gpt-4o, accept it
+func (o *OpenAI) Explain(ctx context.Context, question string, image []byte, mimeType string) (string, error) {
+	request := goopenai.ChatCompletionRequest{
+		Model:     o.modelName,
+		MaxTokens: o.generation.MaxTokens,
+		Stop:      o.generation.Stop,
+		Messages: []goopenai.ChatCompletionMessage{
+			{
+				Role: goopenai.ChatMessageRoleUser,
+				MultiContent: []goopenai.ChatMessagePart{
+					{
+						Type: goopenai.ChatMessagePartTypeImageURL,
+						ImageURL: &goopenai.ChatMessageImageURL{
+							URL:    "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(image),
+							Detail: goopenai.ImageURLDetailAuto,
+						},
+					},
+					{
+						Type: goopenai.ChatMessagePartTypeText,
+						Text: question,
+					},
+				},
+			},
+		},
+	}
+
+	if o.generation.Temperature != nil {
+		request.Temperature = *o.generation.Temperature
+	}
+
+	resp, err := o.client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return "", toStatusError(err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", nil
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ReadServerSentEvents parses a text/event-stream body and calls fn with the
+// event name and data of every event until the body ends or fn fails.
+func ReadServerSentEvents(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		event string
+		data  strings.Builder
+	)
+
+	dispatch := func() error {
+		defer func() {
+			event = ""
+			data.Reset()
+		}()
+
+		if data.Len() == 0 {
+			return nil
+		}
+		return fn(event, data.String())
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			if err := dispatch(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue // comment, usually keep-alive
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			if data.Len() != 0 {
+				data.WriteString("\n")
+			}
+			data.WriteString(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return dispatch()
+}
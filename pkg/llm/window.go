@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// every dialogue costs a few tokens for role and separators
+	tokensPerDialogue = 4
+
+	summaryPrompt = `You maintain the memory of a voice assistant. Merge the previous summary and the conversation below into a new summary.
+Keep names, preferences, facts and open questions, drop small talk. Answer with the summary only, in the language of the conversation, no more than %d tokens.`
+	summaryPrefix = "Summary of the earlier conversation: "
+)
+
+type WindowConfig struct {
+	MaxTokens        int  // token budget of the dialogues sent to LLM, 0 means unlimited
+	KeepTurns        int  // most recent turns which are never trimmed
+	Summarize        bool // compress trimmed turns into a rolling summary
+	SummaryMaxTokens int  // token budget of the rolling summary
+}
+
+// Window keeps a dialogue history within a token budget. Summarize may run in
+// the background while the other methods are used.
+type Window struct {
+	cfg        WindowConfig
+	summarizer LLM // used to compress trimmed turns, optional
+
+	summarizeMu sync.Mutex // serializes summaries, each one merges the previous
+
+	mu         sync.Mutex // guards the fields below
+	summary    string
+	generation int // incremented by Reset, summaries of older turns are dropped
+}
+
+func NewWindow(cfg WindowConfig, summarizer LLM) *Window {
+	if cfg.KeepTurns <= 0 {
+		cfg.KeepTurns = 1
+	}
+
+	if cfg.SummaryMaxTokens <= 0 {
+		cfg.SummaryMaxTokens = 256
+	}
+
+	return &Window{
+		cfg:        cfg,
+		summarizer: summarizer,
+	}
+}
+
+// EstimateTokens gives a rough token count without a tokenizer: a CJK
+// character is about one token, other text about four bytes per token.
+func EstimateTokens(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			cjk += 1
+			continue
+		}
+		other += utf8.RuneLen(r)
+	}
+
+	return cjk + (other+3)/4
+}
+
+func EstimateDialogueTokens(dialogues []Dialogue) int {
+	total := 0
+	for _, d := range dialogues {
+		total += tokensPerDialogue + EstimateTokens(d.Content)
+		for _, call := range d.ToolCalls {
+			total += EstimateTokens(call.Name) + EstimateTokens(call.Arguments)
+		}
+	}
+
+	return total
+}
+
+func (w *Window) Summary() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.summary
+}
+
+// Reset drops the summary, including the one of a summarization in progress
+func (w *Window) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.summary = ""
+	w.generation += 1
+}
+
+// Fit trims dialogues like Trim and summarizes the trimmed turns right away
+func (w *Window) Fit(ctx context.Context, dialogues []Dialogue) []Dialogue {
+	kept, trimmed := w.Trim(dialogues)
+	if len(trimmed) != 0 {
+		if err := w.Summarize(ctx, trimmed); err != nil {
+			log.Warn().Err(err).Msgf("failed to summarize %d trimmed turns", len(trimmed))
+		}
+	}
+
+	return kept
+}
+
+// Trim drops the oldest turns of dialogues until it fits the budget and
+// returns the dialogues to keep and the turns dropped. Leading system
+// dialogues are never trimmed, and a turn is dropped as a whole so tool calls
+// always stay with their results.
+func (w *Window) Trim(dialogues []Dialogue) ([]Dialogue, [][]Dialogue) {
+	if w.cfg.MaxTokens <= 0 {
+		return dialogues, nil
+	}
+
+	system, turns := splitTurns(dialogues)
+	budget := w.cfg.MaxTokens - EstimateDialogueTokens(system)
+	if w.cfg.Summarize {
+		budget -= w.cfg.SummaryMaxTokens
+	}
+
+	total := 0
+	for _, turn := range turns {
+		total += EstimateDialogueTokens(turn)
+	}
+
+	drop := 0
+	for total > budget && len(turns)-drop > w.cfg.KeepTurns {
+		total -= EstimateDialogueTokens(turns[drop])
+		drop += 1
+	}
+
+	if drop == 0 {
+		return dialogues, nil
+	}
+
+	kept := make([]Dialogue, 0, len(dialogues))
+	kept = append(kept, system...)
+	for _, turn := range turns[drop:] {
+		kept = append(kept, turn...)
+	}
+
+	return kept, turns[:drop]
+}
+
+// WithSummary inserts the rolling summary right after the leading system
+// dialogues, dialogues is left untouched.
+func (w *Window) WithSummary(dialogues []Dialogue) []Dialogue {
+	summary := w.Summary()
+	if len(summary) == 0 {
+		return dialogues
+	}
+
+	system, _ := splitTurns(dialogues)
+	result := make([]Dialogue, 0, len(dialogues)+1)
+	result = append(result, system...)
+	result = append(result, Dialogue{
+		Role:    RoleSystem,
+		Content: summaryPrefix + summary,
+	})
+
+	return append(result, dialogues[len(system):]...)
+}
+
+// Summarize merges turns trimmed by Trim into the rolling summary, it does
+// nothing if summarizing is disabled
+func (w *Window) Summarize(ctx context.Context, turns [][]Dialogue) error {
+	if !w.cfg.Summarize || w.summarizer == nil || len(turns) == 0 {
+		return nil
+	}
+
+	w.summarizeMu.Lock()
+	defer w.summarizeMu.Unlock()
+
+	w.mu.Lock()
+	previous, generation := w.summary, w.generation
+	w.mu.Unlock()
+
+	var sb strings.Builder
+	if len(previous) != 0 {
+		sb.WriteString("Previous summary: ")
+		sb.WriteString(previous)
+		sb.WriteString("\n\n")
+	}
+
+	sb.WriteString("Conversation:\n")
+	for _, turn := range turns {
+		for _, d := range turn {
+			if len(d.Content) == 0 {
+				continue
+			}
+			sb.WriteString(d.Role)
+			sb.WriteString(": ")
+			sb.WriteString(d.Content)
+			sb.WriteString("\n")
+		}
+	}
+
+	summary, err := w.summarizer.Response(ctx, []Dialogue{
+		{Role: RoleSystem, Content: fmt.Sprintf(summaryPrompt, w.cfg.SummaryMaxTokens)},
+		{Role: RoleUser, Content: sb.String()},
+	})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.generation == generation {
+		w.summary = strings.TrimSpace(summary)
+	}
+	return nil
+}
+
+// splitTurns separates the leading system dialogues from the rest, which is
+// grouped into turns each starting with a user dialogue.
+func splitTurns(dialogues []Dialogue) ([]Dialogue, [][]Dialogue) {
+	i := 0
+	for i < len(dialogues) && dialogues[i].Role == RoleSystem {
+		i += 1
+	}
+
+	system := dialogues[:i]
+	turns := make([][]Dialogue, 0)
+	for ; i < len(dialogues); i++ {
+		if dialogues[i].Role == RoleUser || len(turns) == 0 {
+			turns = append(turns, []Dialogue{})
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], dialogues[i])
+	}
+
+	return system, turns
+}
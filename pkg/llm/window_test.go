@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubSummarizer struct {
+	calls  int
+	input  string
+	during func() // called while summarizing
+}
+
+func (s *stubSummarizer) Response(ctx context.Context, dialogues []Dialogue) (string, error) {
+	s.calls += 1
+	s.input = dialogues[len(dialogues)-1].Content
+	if s.during != nil {
+		s.during()
+	}
+	return "user likes cats", nil
+}
+
+func buildHistory(turns int) []Dialogue {
+	dialogues := []Dialogue{{Role: RoleSystem, Content: "you are xiaozhi"}}
+	for i := 0; i < turns; i++ {
+		dialogues = append(dialogues,
+			Dialogue{Role: RoleUser, Content: strings.Repeat("question ", 20)},
+			Dialogue{Role: RoleAssistant, Content: strings.Repeat("answer ", 20)},
+		)
+	}
+	return dialogues
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 4, EstimateTokens("你好世界"))
+	assert.Equal(t, 3, EstimateTokens("hello world"))
+	assert.Equal(t, 3, EstimateTokens("你好 abc"))
+}
+
+func TestWindowUnlimited(t *testing.T) {
+	w := NewWindow(WindowConfig{}, nil)
+	history := buildHistory(50)
+
+	assert.Equal(t, history, w.Fit(context.Background(), history))
+}
+
+func TestWindowTrimKeepsSystemPrompt(t *testing.T) {
+	w := NewWindow(WindowConfig{MaxTokens: 200, KeepTurns: 1}, nil)
+	history := buildHistory(10)
+
+	kept := w.Fit(context.Background(), history)
+	assert.Less(t, len(kept), len(history))
+	assert.LessOrEqual(t, EstimateDialogueTokens(kept), 200)
+	assert.Equal(t, RoleSystem, kept[0].Role)
+	assert.Equal(t, RoleUser, kept[1].Role, "expected trimming on turn boundary")
+	assert.Equal(t, history[len(history)-1], kept[len(kept)-1])
+	assert.Empty(t, w.Summary())
+}
+
+func TestWindowKeepTurnsOverBudget(t *testing.T) {
+	w := NewWindow(WindowConfig{MaxTokens: 10, KeepTurns: 2}, nil)
+	history := buildHistory(5)
+
+	kept := w.Fit(context.Background(), history)
+	assert.Len(t, kept, 1+2*2, "expected system prompt and last two turns")
+}
+
+func TestWindowKeepsToolCallPairs(t *testing.T) {
+	w := NewWindow(WindowConfig{MaxTokens: 120, KeepTurns: 1}, nil)
+	history := buildHistory(3)
+	history = append(history,
+		Dialogue{Role: RoleUser, Content: "remember my name is xiaoming"},
+		Dialogue{Role: RoleAssistant, ToolCalls: []ToolCall{
+			{Id: "call-1", Name: "remember_fact", Arguments: `{"content":"name is xiaoming"}`},
+		}},
+	)
+
+	kept := w.Fit(context.Background(), history)
+	assert.Equal(t, RoleSystem, kept[0].Role)
+	assert.Equal(t, "remember my name is xiaoming", kept[len(kept)-2].Content)
+	assert.Len(t, kept[len(kept)-1].ToolCalls, 1, "pending tool call must be kept")
+
+	history = append(kept, Dialogue{Role: RoleTool, ToolCallId: "call-1", Content: "saved"})
+	kept = w.Fit(context.Background(), history)
+	assert.Equal(t, RoleTool, kept[len(kept)-1].Role)
+	assert.Len(t, kept[len(kept)-2].ToolCalls, 1, "tool result must follow its call")
+}
+
+func TestWindowSummarize(t *testing.T) {
+	summarizer := &stubSummarizer{}
+	w := NewWindow(WindowConfig{MaxTokens: 300, KeepTurns: 1, Summarize: true, SummaryMaxTokens: 50}, summarizer)
+	history := buildHistory(10)
+
+	kept := w.Fit(context.Background(), history)
+	assert.Equal(t, 1, summarizer.calls)
+	assert.Contains(t, summarizer.input, "question")
+	assert.Equal(t, "user likes cats", w.Summary())
+
+	request := w.WithSummary(kept)
+	assert.Len(t, request, len(kept)+1)
+	assert.Equal(t, RoleSystem, request[1].Role)
+	assert.Contains(t, request[1].Content, "user likes cats")
+	assert.Equal(t, kept[1:], request[2:])
+
+	w.Fit(context.Background(), append(kept, buildHistory(5)[1:]...))
+	assert.Equal(t, 2, summarizer.calls)
+	assert.Contains(t, summarizer.input, "Previous summary: user likes cats")
+}
+
+func TestWindowTrimThenSummarize(t *testing.T) {
+	summarizer := &stubSummarizer{}
+	w := NewWindow(WindowConfig{MaxTokens: 300, KeepTurns: 1, Summarize: true, SummaryMaxTokens: 50}, summarizer)
+	history := buildHistory(10)
+
+	kept, trimmed := w.Trim(history)
+	assert.Equal(t, 0, summarizer.calls, "trimming does not summarize")
+	assert.NotEmpty(t, trimmed)
+	assert.Equal(t, len(history), len(kept)+2*len(trimmed))
+
+	assert.NoError(t, w.Summarize(context.Background(), trimmed))
+	assert.Equal(t, 1, summarizer.calls)
+	assert.Equal(t, "user likes cats", w.Summary())
+
+	// a summary finishing after Reset belongs to forgotten turns
+	w.Reset()
+	summarizer.during = w.Reset
+	assert.NoError(t, w.Summarize(context.Background(), trimmed))
+	assert.Empty(t, w.Summary())
+}
@@ -0,0 +1,128 @@
+package media
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/pkg/errors"
+)
+
+var ErrUnsupportedFormat = errors.New("only MP3, 16-bit PCM WAV and Ogg Opus are supported")
+
+// Open decodes the audio file at path to 16-bit little endian mono PCM, which
+// is returned with its sample rate. The caller must close it.
+func Open(path string) (io.ReadCloser, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to open %s", path)
+	}
+
+	pcm, sampleRate, err := decode(f, strings.ToLower(filepath.Ext(path)))
+	if err != nil {
+		f.Close()
+		return nil, 0, errors.Wrapf(err, "failed to decode %s", path)
+	}
+
+	return &readCloser{Reader: pcm, file: f}, sampleRate, nil
+}
+
+func decode(r io.Reader, ext string) (io.Reader, int, error) {
+	switch ext {
+	case ".mp3":
+		// always decoded to 2 channels
+		d, err := mp3.NewDecoder(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		return newMonoReader(d, 2), d.SampleRate(), nil
+
+	case ".wav":
+		br := bufio.NewReader(r)
+		format, err := utils.ReadWavHeader(br)
+		if err != nil {
+			return nil, 0, err
+		}
+		if format.AudioFormat != 1 || format.BitsPerSample != 16 || format.Channels == 0 {
+			return nil, 0, ErrUnsupportedFormat
+		}
+		return newMonoReader(br, int(format.Channels)), int(format.SampleRate), nil
+
+	case ".ogg", ".opus":
+		d, err := newOggOpusReader(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		return d, opusSampleRate, nil
+	}
+
+	return nil, 0, ErrUnsupportedFormat
+}
+
+// readCloser closes the decoder, if it holds resources, and the file
+type readCloser struct {
+	io.Reader
+	file *os.File
+}
+
+func (r *readCloser) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return r.file.Close()
+}
+
+// monoReader averages the channels of interleaved 16-bit PCM
+type monoReader struct {
+	src      io.Reader
+	channels int
+	buf      []byte // read from src
+	pending  []byte // incomplete frame of samples of the last read
+	out      []byte // averaged but not yet read
+}
+
+func newMonoReader(src io.Reader, channels int) io.Reader {
+	if channels == 1 {
+		return src
+	}
+
+	return &monoReader{
+		src:      src,
+		channels: channels,
+		buf:      make([]byte, 4096),
+	}
+}
+
+func (m *monoReader) Read(p []byte) (int, error) {
+	frameSize := 2 * m.channels
+	for len(m.out) == 0 {
+		n, err := m.src.Read(m.buf)
+		if n > 0 {
+			data := append(m.pending, m.buf[:n]...)
+			whole := len(data) - len(data)%frameSize
+			m.pending = append([]byte(nil), data[whole:]...)
+
+			m.out = make([]byte, 0, whole/m.channels)
+			for i := 0; i < whole; i += frameSize {
+				sum := 0
+				for c := range m.channels {
+					sum += int(int16(binary.LittleEndian.Uint16(data[i+c*2:])))
+				}
+				m.out = binary.LittleEndian.AppendUint16(m.out, uint16(int16(sum/m.channels)))
+			}
+		}
+		if err != nil && len(m.out) == 0 {
+			return 0, err
+		}
+	}
+
+	n := copy(p, m.out)
+	m.out = m.out[n:]
+	return n, nil
+}
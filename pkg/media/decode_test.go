@@ -0,0 +1,106 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pcmOf(samples ...int16) []byte {
+	var buf []byte
+	for _, s := range samples {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(s))
+	}
+	return buf
+}
+
+func wavOf(channels, sampleRate int, pcm []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{
+		uint32(16), uint16(1), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * 2), uint16(channels * 2), uint16(16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+func TestOpenWav(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "mono.wav")
+	os.WriteFile(path, wavOf(1, 16000, pcmOf(1, 2, 3)), 0644)
+	pcm, sampleRate, err := Open(path)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(pcm)
+	assert.NoError(t, err)
+	assert.NoError(t, pcm.Close())
+	assert.Equal(t, 16000, sampleRate)
+	assert.Equal(t, pcmOf(1, 2, 3), data)
+
+	// channels are averaged
+	path = filepath.Join(dir, "stereo.wav")
+	os.WriteFile(path, wavOf(2, 44100, pcmOf(100, 300, -100, -300, 7, 7)), 0644)
+	pcm, sampleRate, err = Open(path)
+	assert.NoError(t, err)
+	data, err = io.ReadAll(iotest.OneByteReader(pcm))
+	assert.NoError(t, err)
+	pcm.Close()
+	assert.Equal(t, 44100, sampleRate)
+	assert.Equal(t, pcmOf(200, -200, 7), data)
+
+	path = filepath.Join(dir, "song.flac")
+	os.WriteFile(path, nil, 0644)
+	_, _, err = Open(path)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+// oggPage builds a page of serial holding segments of the given lacing values
+func oggPage(serial uint32, lacing []byte, body []byte) []byte {
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint32(header[14:], serial)
+	header[26] = byte(len(lacing))
+	return append(append(header, lacing...), body...)
+}
+
+func TestOggPackets(t *testing.T) {
+	long := bytes.Repeat([]byte{'x'}, 300)
+
+	var stream []byte
+	stream = append(stream, oggPage(1, []byte{3, 255}, append([]byte("abc"), long[:255]...))...)
+	stream = append(stream, oggPage(2, []byte{2}, []byte("zz"))...) // another logical stream
+	stream = append(stream, oggPage(1, []byte{45, 0}, long[255:])...)
+
+	ogg := newOggReader(bytes.NewReader(stream))
+	packet, err := ogg.nextPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(packet))
+
+	// continued on the next page of the stream
+	packet, err = ogg.nextPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, long, packet)
+
+	packet, err = ogg.nextPacket()
+	assert.NoError(t, err)
+	assert.Empty(t, packet)
+
+	_, err = ogg.nextPacket()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = newOggReader(bytes.NewReader([]byte("RIFF0000000000000000000000000"))).nextPacket()
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package media
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Track is an audio file of the library
+type Track struct {
+	Id       string `json:"id"`       // path relative to the library, e.g. 儿歌/小星星.mp3
+	Title    string `json:"title"`    // file name without extension, e.g. 小星星
+	Category string `json:"category"` // directory relative to the library, e.g. 儿歌, empty at the top
+	Path     string `json:"-"`
+}
+
+// Library indexes the audio files under a directory, sub directories are
+// categories such as nursery rhymes or bedtime stories
+type Library struct {
+	dir string
+
+	mu     sync.RWMutex
+	tracks []*Track // sorted by id, so tracks of a category are adjacent
+}
+
+func NewLibrary(dir string) *Library {
+	return &Library{dir: dir}
+}
+
+// IsSupported reports whether path is an audio file the library can decode
+func IsSupported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3", ".wav", ".ogg", ".opus":
+		return true
+	}
+	return false
+}
+
+// Scan indexes the audio files under dir again, a missing dir is empty
+func (l *Library) Scan() error {
+	var tracks []*Track
+	if _, err := os.Stat(l.dir); err == nil {
+		err := filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() || !IsSupported(path) {
+				return nil
+			}
+
+			id, err := filepath.Rel(l.dir, path)
+			if err != nil {
+				return err
+			}
+
+			id = filepath.ToSlash(id)
+			category := filepath.ToSlash(filepath.Dir(id))
+			if category == "." {
+				category = ""
+			}
+
+			tracks = append(tracks, &Track{
+				Id:       id,
+				Title:    strings.TrimSuffix(filepath.Base(id), filepath.Ext(id)),
+				Category: category,
+				Path:     path,
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].Id < tracks[j].Id
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tracks = tracks
+	return nil
+}
+
+// Tracks returns every track of the library
+func (l *Library) Tracks() []*Track {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.tracks
+}
+
+// Search returns up to limit tracks matching query, tracks whose title
+// matches come first. Every word of query has to be found in the title or
+// the category, an empty query matches every track.
+func (l *Library) Search(query string, limit int) []*Track {
+	words := strings.Fields(normalize(query))
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	type match struct {
+		track *Track
+		score int
+	}
+
+	var matches []match
+	for _, track := range l.tracks {
+		title := normalize(track.Title)
+		category := normalize(track.Category)
+
+		score := 0
+		for _, word := range words {
+			switch {
+			case strings.Contains(title, word):
+				score += 2
+			case strings.Contains(category, word):
+				score++
+			default:
+				score = -1
+			}
+			if score < 0 {
+				break
+			}
+		}
+		if score < 0 {
+			continue
+		}
+
+		if len(words) != 0 && title == strings.Join(words, " ") {
+			score += 10 // exactly the title
+		}
+		matches = append(matches, match{track, score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	tracks := make([]*Track, 0, len(matches))
+	for _, m := range matches {
+		tracks = append(tracks, m.track)
+	}
+
+	return tracks
+}
+
+// Next returns the track following track in its category, the first one
+// follows the last one. It is nil if the category has no other track.
+func (l *Library) Next(track *Track) *Track {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var siblings []*Track
+	for _, t := range l.tracks {
+		if t.Category == track.Category {
+			siblings = append(siblings, t)
+		}
+	}
+
+	for i, t := range siblings {
+		if t.Id == track.Id && len(siblings) > 1 {
+			return siblings[(i+1)%len(siblings)]
+		}
+	}
+
+	return nil
+}
+
+// lower case, punctuations and separators such as _ or - become spaces, so
+// file names match what ASR recognizes
+func normalize(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r)
+	}), " ")
+}
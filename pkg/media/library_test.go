@@ -0,0 +1,61 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLibrary(t *testing.T, ids ...string) *Library {
+	dir := t.TempDir()
+	for _, id := range ids {
+		path := filepath.Join(dir, filepath.FromSlash(id))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+
+	l := NewLibrary(dir)
+	assert.NoError(t, l.Scan())
+	return l
+}
+
+func ids(tracks []*Track) []string {
+	var ids []string
+	for _, track := range tracks {
+		ids = append(ids, track.Id)
+	}
+	return ids
+}
+
+func TestLibraryScan(t *testing.T) {
+	l := newTestLibrary(t, "儿歌/小星星.mp3", "儿歌/两只老虎.wav", "睡前故事/小红帽.ogg", "readme.txt", "Morning_Song.MP3")
+
+	assert.Equal(t, []string{"Morning_Song.MP3", "儿歌/两只老虎.wav", "儿歌/小星星.mp3", "睡前故事/小红帽.ogg"}, ids(l.Tracks()))
+	track := l.Tracks()[2]
+	assert.Equal(t, "小星星", track.Title)
+	assert.Equal(t, "儿歌", track.Category)
+
+	assert.NoError(t, NewLibrary(filepath.Join(t.TempDir(), "missing")).Scan())
+}
+
+func TestLibrarySearch(t *testing.T) {
+	l := newTestLibrary(t, "儿歌/小星星.mp3", "儿歌/两只老虎.wav", "睡前故事/小红帽.ogg", "睡前故事/小星星的故事.mp3", "Morning_Song.MP3")
+
+	assert.Equal(t, []string{"儿歌/小星星.mp3", "睡前故事/小星星的故事.mp3"}, ids(l.Search("小星星", 0)))
+	assert.Equal(t, []string{"睡前故事/小星星的故事.mp3"}, ids(l.Search("睡前故事 小星星", 0)))
+	assert.Equal(t, []string{"儿歌/两只老虎.wav", "儿歌/小星星.mp3"}, ids(l.Search("儿歌", 0)))
+	assert.Equal(t, []string{"Morning_Song.MP3"}, ids(l.Search("morning song", 0)))
+	assert.Len(t, l.Search("", 3), 3)
+	assert.Empty(t, l.Search("小白兔", 0))
+}
+
+func TestLibraryNext(t *testing.T) {
+	l := newTestLibrary(t, "儿歌/小星星.mp3", "儿歌/两只老虎.wav", "睡前故事/小红帽.ogg")
+	tracks := l.Tracks()
+
+	assert.Equal(t, "儿歌/小星星.mp3", l.Next(tracks[0]).Id)
+	assert.Equal(t, "儿歌/两只老虎.wav", l.Next(tracks[1]).Id, "wraps around")
+	assert.Nil(t, l.Next(tracks[2]), "alone in its category")
+}
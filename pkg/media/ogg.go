@@ -0,0 +1,167 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/qrtc/opus-go"
+)
+
+const (
+	opusSampleRate = 48000 // Ogg Opus is always decoded at 48kHz
+	// samples of the longest Opus packet, 120ms at 48kHz
+	opusMaxPacketSamples = 5760
+)
+
+// oggReader splits an Ogg stream into the packets of its first logical
+// stream, pages of other streams are skipped
+type oggReader struct {
+	r        io.Reader
+	serial   uint32
+	started  bool
+	segments []byte // lacing values of the current page not read yet
+	partial  []byte // packet continued on the next page
+}
+
+func newOggReader(r io.Reader) *oggReader {
+	return &oggReader{r: r}
+}
+
+// nextPacket returns the next complete packet, io.EOF at the end of the stream
+func (o *oggReader) nextPacket() ([]byte, error) {
+	for {
+		for len(o.segments) != 0 {
+			size := int(o.segments[0])
+			o.segments = o.segments[1:]
+
+			start := len(o.partial)
+			o.partial = append(o.partial, make([]byte, size)...)
+			if _, err := io.ReadFull(o.r, o.partial[start:]); err != nil {
+				return nil, errors.Wrap(err, "failed to read Ogg segment")
+			}
+
+			// a lacing value of 255 continues the packet
+			if size < 255 {
+				packet := o.partial
+				o.partial = nil
+				return packet, nil
+			}
+		}
+
+		if err := o.nextPage(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (o *oggReader) nextPage() error {
+	for {
+		var header [27]byte
+		if _, err := io.ReadFull(o.r, header[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return errors.Wrap(err, "truncated Ogg page")
+			}
+			return err
+		}
+		if string(header[0:4]) != "OggS" {
+			return errors.New("not an Ogg stream")
+		}
+
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(o.r, lacing); err != nil {
+			return errors.Wrap(err, "failed to read Ogg lacing values")
+		}
+
+		serial := binary.LittleEndian.Uint32(header[14:18])
+		if !o.started {
+			o.serial, o.started = serial, true
+		}
+
+		if serial != o.serial {
+			size := 0
+			for _, v := range lacing {
+				size += int(v)
+			}
+			if _, err := io.CopyN(io.Discard, o.r, int64(size)); err != nil {
+				return errors.Wrap(err, "failed to skip Ogg page")
+			}
+			continue
+		}
+
+		o.segments = lacing
+		return nil
+	}
+}
+
+// oggOpusReader decodes the Opus packets of an Ogg stream to 48kHz mono PCM
+type oggOpusReader struct {
+	ogg     *oggReader
+	decoder *opus.OpusDecoder
+	skip    int    // bytes of pre-skip not dropped yet
+	buf     []byte // decoded PCM
+	out     []byte // decoded but not yet read
+}
+
+func newOggOpusReader(r io.Reader) (*oggOpusReader, error) {
+	ogg := newOggReader(r)
+
+	head, err := ogg.nextPacket()
+	if err != nil {
+		return nil, err
+	}
+	if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// OpusTags follow the header
+	if _, err := ogg.nextPacket(); err != nil {
+		return nil, err
+	}
+
+	// stereo streams are downmixed by the decoder
+	decoder, err := opus.CreateOpusDecoder(&opus.OpusDecoderConfig{
+		SampleRate:  opusSampleRate,
+		MaxChannels: 1,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Opus decoder")
+	}
+
+	return &oggOpusReader{
+		ogg:     ogg,
+		decoder: decoder,
+		skip:    int(binary.LittleEndian.Uint16(head[10:12])) * 2,
+		buf:     make([]byte, opusMaxPacketSamples*2),
+	}, nil
+}
+
+func (d *oggOpusReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		packet, err := d.ogg.nextPacket()
+		if err != nil {
+			return 0, err
+		}
+		if len(packet) == 0 {
+			continue
+		}
+
+		n, err := d.decoder.Decode(packet, d.buf)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to decode Opus packet")
+		}
+
+		skipped := min(d.skip, n)
+		d.skip -= skipped
+		d.out = d.buf[skipped:n]
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *oggOpusReader) Close() error {
+	return d.decoder.Close()
+}
@@ -0,0 +1,12 @@
+package repo
+
+import (
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+)
+
+type conversationRepo interface {
+	AppendTurn(turn *types.Turn) error
+	// ListTurns returns matched turns ordered from the oldest to the newest
+	ListTurns(where WhereCondition) ([]*types.Turn, error)
+	RemoveTurns(where WhereCondition) error
+}
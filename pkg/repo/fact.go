@@ -0,0 +1,19 @@
+package repo
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+)
+
+var (
+	ErrFactNotFound = errors.New("fact not found")
+)
+
+type factRepo interface {
+	// SaveFact creates the fact or replaces the one of the same device and id
+	SaveFact(fact *types.Fact) error
+	// ListFacts returns matched facts ordered from the oldest to the newest update
+	ListFacts(where WhereCondition) ([]*types.Fact, error)
+	RemoveFacts(where WhereCondition) error
+}
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
@@ -8,11 +9,26 @@ import (
 
 type InMemoryRepository struct {
 	devices sync.Map // Using sync.Map for concurrent access
+
+	turnsLock sync.RWMutex
+	turns     map[string][]*types.Turn // device id -> turns ordered by time
+
+	settings sync.Map // device id -> *types.DeviceSettings
+
+	factsLock sync.RWMutex
+	facts     map[factKey]*types.Fact
+
+	voicesLock sync.RWMutex
+	voices     map[string]*types.Voice // voice name -> voice
 }
 
 func NewInMemoryRepository() *InMemoryRepository {
 	return &InMemoryRepository{
-		devices: sync.Map{},
+		devices:  sync.Map{},
+		turns:    make(map[string][]*types.Turn),
+		settings: sync.Map{},
+		facts:    make(map[factKey]*types.Fact),
+		voices:   make(map[string]*types.Voice),
 	}
 }
 
@@ -74,3 +90,171 @@ func (r *InMemoryRepository) RemoveDevice(where WhereCondition) error {
 	}
 	return nil
 }
+
+func (r *InMemoryRepository) AppendTurn(turn *types.Turn) error {
+	r.turnsLock.Lock()
+	defer r.turnsLock.Unlock()
+
+	turns := append(r.turns[turn.DeviceId], turn)
+	sort.SliceStable(turns, func(i, j int) bool {
+		return turns[i].AskedAt.Before(turns[j].AskedAt)
+	})
+	r.turns[turn.DeviceId] = turns
+
+	return nil
+}
+
+func (r *InMemoryRepository) ListTurns(where WhereCondition) ([]*types.Turn, error) {
+	r.turnsLock.RLock()
+	defer r.turnsLock.RUnlock()
+
+	turns := make([]*types.Turn, 0)
+	for _, deviceTurns := range r.turns {
+		for _, turn := range deviceTurns {
+			if where.MatchTurn(turn) {
+				turns = append(turns, turn)
+			}
+		}
+	}
+
+	sort.SliceStable(turns, func(i, j int) bool {
+		return turns[i].AskedAt.Before(turns[j].AskedAt)
+	})
+
+	return turns, nil
+}
+
+func (r *InMemoryRepository) RemoveTurns(where WhereCondition) error {
+	r.turnsLock.Lock()
+	defer r.turnsLock.Unlock()
+
+	for deviceId, deviceTurns := range r.turns {
+		kept := make([]*types.Turn, 0, len(deviceTurns))
+		for _, turn := range deviceTurns {
+			if !where.MatchTurn(turn) {
+				kept = append(kept, turn)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(r.turns, deviceId)
+			continue
+		}
+		r.turns[deviceId] = kept
+	}
+
+	return nil
+}
+
+func (r *InMemoryRepository) FindDeviceSettings(where WhereCondition) (*types.DeviceSettings, error) {
+	deviceId, ok := where["device_id"].(string)
+	if !ok {
+		return nil, ErrInvalidWhereCondition
+	}
+
+	obj, ok := r.settings.Load(deviceId)
+	if !ok {
+		return nil, ErrSettingsNotFound
+	}
+
+	return obj.(*types.DeviceSettings), nil
+}
+
+func (r *InMemoryRepository) SaveDeviceSettings(settings *types.DeviceSettings) error {
+	r.settings.Store(settings.DeviceId, settings)
+	return nil
+}
+
+func (r *InMemoryRepository) RemoveDeviceSettings(where WhereCondition) error {
+	deviceId, ok := where["device_id"].(string)
+	if !ok {
+		return ErrInvalidWhereCondition
+	}
+
+	r.settings.Delete(deviceId)
+	return nil
+}
+
+// factKey identifies a fact, ids are only unique within a device
+type factKey struct {
+	deviceId string
+	id       string
+}
+
+func (r *InMemoryRepository) SaveFact(fact *types.Fact) error {
+	r.factsLock.Lock()
+	defer r.factsLock.Unlock()
+
+	r.facts[factKey{deviceId: fact.DeviceId, id: fact.Id}] = fact
+	return nil
+}
+
+func (r *InMemoryRepository) ListFacts(where WhereCondition) ([]*types.Fact, error) {
+	r.factsLock.RLock()
+	defer r.factsLock.RUnlock()
+
+	facts := make([]*types.Fact, 0)
+	for _, fact := range r.facts {
+		if where.MatchFact(fact) {
+			facts = append(facts, fact)
+		}
+	}
+
+	sort.SliceStable(facts, func(i, j int) bool {
+		return facts[i].UpdatedAt.Before(facts[j].UpdatedAt)
+	})
+
+	return facts, nil
+}
+
+func (r *InMemoryRepository) RemoveFacts(where WhereCondition) error {
+	r.factsLock.Lock()
+	defer r.factsLock.Unlock()
+
+	for key, fact := range r.facts {
+		if where.MatchFact(fact) {
+			delete(r.facts, key)
+		}
+	}
+
+	return nil
+}
+
+func (r *InMemoryRepository) SaveVoice(voice *types.Voice) error {
+	r.voicesLock.Lock()
+	defer r.voicesLock.Unlock()
+
+	r.voices[voice.Name] = voice
+	return nil
+}
+
+func (r *InMemoryRepository) ListVoices(where WhereCondition) ([]*types.Voice, error) {
+	r.voicesLock.RLock()
+	defer r.voicesLock.RUnlock()
+
+	voices := make([]*types.Voice, 0)
+	for _, voice := range r.voices {
+		if where.MatchVoice(voice) {
+			voices = append(voices, voice)
+		}
+	}
+
+	sort.SliceStable(voices, func(i, j int) bool {
+		return voices[i].CreatedAt.Before(voices[j].CreatedAt)
+	})
+
+	return voices, nil
+}
+
+func (r *InMemoryRepository) RemoveVoices(where WhereCondition) error {
+	r.voicesLock.Lock()
+	defer r.voicesLock.Unlock()
+
+	for name, voice := range r.voices {
+		if where.MatchVoice(voice) {
+			delete(r.voices, name)
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"testing"
+	"time"
 
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
 
@@ -100,3 +101,115 @@ func TestMemoryRemoveDevice(t *testing.T) {
 	assert.Error(t, err, "Expected error when finding removed device")
 	assert.Nil(t, fountDevice, "Expected no device found after removal")
 }
+
+func TestMemoryTurns(t *testing.T) {
+	m := memoryRepository()
+	device := randomDevice()
+	other := randomDevice()
+	now := time.Now()
+
+	m.AppendTurn(&types.Turn{DeviceId: device.DeviceId, Question: "second", AskedAt: now.Add(-time.Minute)})
+	m.AppendTurn(&types.Turn{DeviceId: device.DeviceId, Question: "first", AskedAt: now.Add(-time.Hour)})
+	m.AppendTurn(&types.Turn{DeviceId: other.DeviceId, Question: "other", AskedAt: now})
+
+	turns, err := m.ListTurns(WhereCondition{"device_id": device.DeviceId})
+	assert.NoError(t, err, "Expected no error when listing turns")
+	assert.Len(t, turns, 2, "Expected two turns of the device")
+	assert.Equal(t, "first", turns[0].Question, "Expected turns ordered by time")
+
+	turns, err = m.ListTurns(WhereCondition{"device_id": device.DeviceId, "after": now.Add(-10 * time.Minute)})
+	assert.NoError(t, err, "Expected no error when listing recent turns")
+	assert.Len(t, turns, 1, "Expected one recent turn")
+	assert.Equal(t, "second", turns[0].Question)
+
+	err = m.RemoveTurns(WhereCondition{"device_id": device.DeviceId})
+	assert.NoError(t, err, "Expected no error when removing turns")
+
+	turns, _ = m.ListTurns(WhereCondition{"device_id": device.DeviceId})
+	assert.Empty(t, turns, "Expected no turns after removal")
+
+	turns, _ = m.ListTurns(WhereCondition{"device_id": other.DeviceId})
+	assert.Len(t, turns, 1, "Expected turns of other devices untouched")
+}
+
+func TestMemoryDeviceSettings(t *testing.T) {
+	m := memoryRepository()
+	device := randomDevice()
+
+	_, err := m.FindDeviceSettings(WhereCondition{"device_id": device.DeviceId})
+	assert.ErrorIs(t, err, ErrSettingsNotFound, "Expected no settings of a new device")
+
+	err = m.SaveDeviceSettings(&types.DeviceSettings{DeviceId: device.DeviceId, Persona: "teacher"})
+	assert.NoError(t, err, "Expected no error when saving settings")
+
+	settings, err := m.FindDeviceSettings(WhereCondition{"device_id": device.DeviceId})
+	assert.NoError(t, err, "Expected no error when finding settings")
+	assert.Equal(t, "teacher", settings.Persona)
+
+	_, err = m.FindDeviceSettings(WhereCondition{"client_id": device.ClientId})
+	assert.ErrorIs(t, err, ErrInvalidWhereCondition, "Expected settings found by device id only")
+
+	err = m.RemoveDeviceSettings(WhereCondition{"device_id": device.DeviceId})
+	assert.NoError(t, err, "Expected no error when removing settings")
+
+	_, err = m.FindDeviceSettings(WhereCondition{"device_id": device.DeviceId})
+	assert.ErrorIs(t, err, ErrSettingsNotFound, "Expected no settings after removal")
+}
+
+func TestMemoryFacts(t *testing.T) {
+	m := memoryRepository()
+	device := randomDevice()
+	other := randomDevice()
+	now := time.Now()
+
+	m.SaveFact(&types.Fact{Id: "2", DeviceId: device.DeviceId, Content: "对花生过敏", UpdatedAt: now})
+	m.SaveFact(&types.Fact{Id: "1", DeviceId: device.DeviceId, Content: "名字叫小明", UpdatedAt: now.Add(-time.Hour)})
+	m.SaveFact(&types.Fact{Id: "3", DeviceId: other.DeviceId, Content: "other", UpdatedAt: now})
+
+	facts, err := m.ListFacts(WhereCondition{"device_id": device.DeviceId})
+	assert.NoError(t, err, "Expected no error when listing facts")
+	assert.Len(t, facts, 2, "Expected two facts of the device")
+	assert.Equal(t, "1", facts[0].Id, "Expected facts ordered by update time")
+
+	m.SaveFact(&types.Fact{Id: "1", DeviceId: device.DeviceId, Content: "名字叫小红", UpdatedAt: now.Add(time.Minute)})
+	facts, _ = m.ListFacts(WhereCondition{"device_id": device.DeviceId})
+	assert.Len(t, facts, 2, "Expected the fact replaced")
+	assert.Equal(t, "名字叫小红", facts[1].Content)
+
+	err = m.RemoveFacts(WhereCondition{"device_id": device.DeviceId, "id": "2"})
+	assert.NoError(t, err, "Expected no error when removing a fact")
+
+	facts, _ = m.ListFacts(WhereCondition{"device_id": device.DeviceId})
+	assert.Len(t, facts, 1, "Expected one fact left")
+
+	facts, _ = m.ListFacts(WhereCondition{"device_id": other.DeviceId})
+	assert.Len(t, facts, 1, "Expected facts of other devices untouched")
+
+	m.SaveFact(&types.Fact{Id: "1", DeviceId: other.DeviceId, Content: "名字叫小刚", UpdatedAt: now})
+	facts, _ = m.ListFacts(WhereCondition{"device_id": device.DeviceId})
+	assert.Equal(t, "名字叫小红", facts[0].Content, "Expected ids only unique within a device")
+}
+
+func TestMemoryVoices(t *testing.T) {
+	m := memoryRepository()
+	now := time.Now()
+
+	m.SaveVoice(&types.Voice{Name: "妈妈", Provider: "cosyvoice", Uri: "speech:mama:1", CreatedAt: now})
+	m.SaveVoice(&types.Voice{Name: "爸爸", Provider: "cosyvoice", Uri: "speech:baba:1", CreatedAt: now.Add(-time.Hour)})
+
+	voices, err := m.ListVoices(nil)
+	assert.NoError(t, err, "Expected no error when listing voices")
+	assert.Len(t, voices, 2, "Expected two voices")
+	assert.Equal(t, "爸爸", voices[0].Name, "Expected voices ordered by creation time")
+
+	m.SaveVoice(&types.Voice{Name: "妈妈", Provider: "cosyvoice", Uri: "speech:mama:2", CreatedAt: now})
+	voices, _ = m.ListVoices(WhereCondition{"name": "妈妈"})
+	assert.Len(t, voices, 1, "Expected the voice replaced")
+	assert.Equal(t, "speech:mama:2", voices[0].Uri)
+
+	err = m.RemoveVoices(WhereCondition{"name": "妈妈"})
+	assert.NoError(t, err, "Expected no error when removing a voice")
+
+	voices, _ = m.ListVoices(WhereCondition{"provider": "cosyvoice"})
+	assert.Len(t, voices, 1, "Expected one voice left")
+}
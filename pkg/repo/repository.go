@@ -1,12 +1,18 @@
 package repo
 
 import (
+	"time"
+
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
 )
 
 // Repository interface defines the methods for device repository operations.
 type Respository interface {
-	deviceRepo // deviceRepo defines the methods for device operations.
+	deviceRepo       // deviceRepo defines the methods for device operations.
+	conversationRepo // conversationRepo defines the methods for conversation history.
+	settingsRepo     // settingsRepo defines the methods for per device settings.
+	factRepo         // factRepo defines the methods for long-term facts of devices.
+	voiceRepo        // voiceRepo defines the methods for custom TTS voices.
 }
 
 type WhereCondition map[string]any
@@ -38,3 +44,63 @@ func (wc WhereCondition) MatchDevice(d *types.Device) bool {
 
 	return false
 }
+
+// MatchTurn supports device_id, session_id, after and before conditions, time
+// conditions are compared with the time the question was asked.
+func (wc WhereCondition) MatchTurn(t *types.Turn) bool {
+	if wc == nil {
+		return true
+	}
+
+	if deviceId, ok := wc["device_id"]; ok && deviceId != t.DeviceId {
+		return false
+	}
+
+	if sessionId, ok := wc["session_id"]; ok && sessionId != t.SessionId {
+		return false
+	}
+
+	if after, ok := wc["after"].(time.Time); ok && !t.AskedAt.After(after) {
+		return false
+	}
+
+	if before, ok := wc["before"].(time.Time); ok && !t.AskedAt.Before(before) {
+		return false
+	}
+
+	return true
+}
+
+// MatchFact supports device_id and id conditions
+func (wc WhereCondition) MatchFact(f *types.Fact) bool {
+	if wc == nil {
+		return true
+	}
+
+	if deviceId, ok := wc["device_id"]; ok && deviceId != f.DeviceId {
+		return false
+	}
+
+	if id, ok := wc["id"]; ok && id != f.Id {
+		return false
+	}
+
+	return true
+}
+
+// MatchVoice supports name and provider conditions
+func (wc WhereCondition) MatchVoice(v *types.Voice) bool {
+	if wc == nil {
+		return true
+	}
+
+	if name, ok := wc["name"]; ok && name != v.Name {
+		return false
+	}
+
+	if provider, ok := wc["provider"]; ok && provider != v.Provider {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,17 @@
+package repo
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+)
+
+var (
+	ErrSettingsNotFound = errors.New("device settings not found")
+)
+
+type settingsRepo interface {
+	FindDeviceSettings(where WhereCondition) (*types.DeviceSettings, error)
+	SaveDeviceSettings(settings *types.DeviceSettings) error
+	RemoveDeviceSettings(where WhereCondition) error
+}
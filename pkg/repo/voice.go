@@ -0,0 +1,19 @@
+package repo
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+)
+
+var (
+	ErrVoiceNotFound = errors.New("voice not found")
+)
+
+type voiceRepo interface {
+	// SaveVoice creates the voice or replaces the one of the same name
+	SaveVoice(voice *types.Voice) error
+	// ListVoices returns matched voices ordered from the oldest to the newest
+	ListVoices(where WhereCondition) ([]*types.Voice, error)
+	RemoveVoices(where WhereCondition) error
+}
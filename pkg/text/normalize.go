@@ -0,0 +1,180 @@
+package text
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	reCodeBlock  = regexp.MustCompile("(?s)```.*?(?:```|$)")
+	reInlineCode = regexp.MustCompile("`([^`\n]*)`")
+	reImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	reLink       = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	reURL        = regexp.MustCompile(`(?i)(?:https?://|www\.)[^\s<>()（）\p{Han}，。！？；：、]+`)
+	reHTMLTag    = regexp.MustCompile(`</?[a-zA-Z][^>\n]*>`)
+	reHeading    = regexp.MustCompile(`(?m)^[ \t]*#{1,6}[ \t]*`)
+	reQuote      = regexp.MustCompile(`(?m)^[ \t]*>+[ \t]?`)
+	reListMarker = regexp.MustCompile(`(?m)^[ \t]*(?:[-*+•]|\d{1,2}[.)])[ \t]+`)
+	reRule       = regexp.MustCompile(`(?m)^[ \t]*(?:-{3,}|\*{3,}|_{3,})[ \t]*$`)
+	reTableRule  = regexp.MustCompile(`(?m)^[ \t]*\|?(?:[ \t]*:?-{3,}:?[ \t]*\|)+[ \t]*:?-*:?[ \t]*$`)
+	reTablePipe  = regexp.MustCompile(`[ \t]*\|[ \t]*`)
+	reEmphasis   = regexp.MustCompile(`\*\*|__|~~`)
+	reItalic     = regexp.MustCompile(`\*([^*\n]+)\*`)
+	reSpaces     = regexp.MustCompile(`[ \t]+`)
+)
+
+// Normalizer rewrites answers of LLM into what TTS reads well. Formatting,
+// URLs and emoji are removed, then numbers, dates, times, currencies and
+// units are spelled out in Chinese, or in English if the text has no Chinese.
+type Normalizer struct {
+	dictionary []pronunciation // longest words first
+}
+
+type pronunciation struct {
+	word   string
+	spoken string
+}
+
+// NewNormalizer creates a normalizer replacing the words of dictionary by how
+// they should be pronounced, e.g. 行长: 杭长
+func NewNormalizer(dictionary map[string]string) *Normalizer {
+	n := &Normalizer{}
+	for word, spoken := range dictionary {
+		if len(word) != 0 {
+			n.dictionary = append(n.dictionary, pronunciation{word, spoken})
+		}
+	}
+
+	sort.Slice(n.dictionary, func(i, j int) bool {
+		if len(n.dictionary[i].word) != len(n.dictionary[j].word) {
+			return len(n.dictionary[i].word) > len(n.dictionary[j].word)
+		}
+		return n.dictionary[i].word < n.dictionary[j].word
+	})
+
+	return n
+}
+
+// Normalize returns the text TTS should read for text
+func (n *Normalizer) Normalize(text string) string {
+	return n.Spoken(n.Clean(text))
+}
+
+// Clean removes Markdown, code blocks, URLs and emoji, what is left may be
+// shown on the device as is. A nil normalizer returns text unchanged.
+func (n *Normalizer) Clean(text string) string {
+	if n == nil {
+		return text
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = reCodeBlock.ReplaceAllString(text, "")
+	text = reInlineCode.ReplaceAllString(text, "$1")
+	text = reImage.ReplaceAllString(text, "$1")
+	text = reLink.ReplaceAllString(text, "$1")
+	text = reURL.ReplaceAllString(text, "")
+	text = reHTMLTag.ReplaceAllString(text, "")
+	text = reRule.ReplaceAllString(text, "")
+	text = reTableRule.ReplaceAllString(text, "")
+	text = reHeading.ReplaceAllString(text, "")
+	text = reQuote.ReplaceAllString(text, "")
+	text = reListMarker.ReplaceAllString(text, "")
+	text = reEmphasis.ReplaceAllString(text, "")
+	text = reItalic.ReplaceAllString(text, "$1")
+
+	text = strings.Map(func(r rune) rune {
+		if isEmoji(r) {
+			return -1
+		}
+		return r
+	}, text)
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Trim(reTablePipe.ReplaceAllString(line, " "), " \t")
+		if line = reSpaces.ReplaceAllString(line, " "); len(line) != 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Spoken replaces the words of the dictionary, expands abbreviations and
+// spells out numbers. A nil normalizer returns text unchanged.
+func (n *Normalizer) Spoken(text string) string {
+	if n == nil {
+		return text
+	}
+
+	for _, p := range n.dictionary {
+		text = replaceWord(text, p.word, p.spoken)
+	}
+
+	lang := languageOf(text)
+	for _, a := range lang.abbreviations {
+		text = replaceWord(text, a.word, a.spoken)
+	}
+
+	return spellNumbers(text, lang)
+}
+
+// replaceWord replaces word in text, words starting or ending with a latin
+// letter or digit are only replaced as whole words, so AI does not match SAID
+func replaceWord(text, word, spoken string) string {
+	first, _ := utf8.DecodeRuneInString(word)
+	last, _ := utf8.DecodeLastRuneInString(word)
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(text, word)
+		if i < 0 {
+			sb.WriteString(text)
+			return sb.String()
+		}
+
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[i+len(word):])
+		whole := !(isLatinAlnum(first) && isLatinAlnum(before)) && !(isLatinAlnum(last) && isLatinAlnum(after))
+
+		sb.WriteString(text[:i])
+		if whole {
+			sb.WriteString(spoken)
+		} else {
+			sb.WriteString(word)
+		}
+		text = text[i+len(word):]
+	}
+}
+
+func isLatinAlnum(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // emoticons, pictographs, flags
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // miscellaneous symbols and dingbats
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF: // arrows and stars such as ⭐
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // tags of flags
+		return true
+	case r == 0x200D || r == 0x20E3 || r == 0xFE0F || r == 0xFE0E: // joiners, keycaps and variation selectors
+		return true
+	}
+	return false
+}
+
+func hasHan(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "今天天气不错。", "今天天气不错。"},
+		{"emphasis", "这是**重点**，也是*斜体*和~~删除~~。", "这是重点，也是斜体和删除。"},
+		{"heading", "## 第一步\n打开电源", "第一步\n打开电源"},
+		{"list", "- 苹果\n* 香蕉\n1. 橘子\n2) 葡萄", "苹果\n香蕉\n橘子\n葡萄"},
+		{"quote", "> 学而时习之", "学而时习之"},
+		{"rule", "上文\n---\n下文", "上文\n下文"},
+		{"code block", "运行下面的命令：\n```bash\nrm -rf /tmp/x\n```\n就好了", "运行下面的命令：\n就好了"},
+		{"unclosed code block", "示例：\n```go\nfmt.Println(1)", "示例："},
+		{"inline code", "调用 `Open` 函数", "调用 Open 函数"},
+		{"link", "详见[官方文档](https://example.com/doc)。", "详见官方文档。"},
+		{"image", "![小猫](cat.png)很可爱", "小猫很可爱"},
+		{"url", "访问 https://example.com/a?b=1 了解更多", "访问 了解更多"},
+		{"url before Chinese", "网址是www.example.com，欢迎", "网址是，欢迎"},
+		{"html", "第一行<br>第二行", "第一行第二行"},
+		{"table", "| 名称 | 价格 |\n|---|:---:|\n| 苹果 | 5元 |", "名称 价格\n苹果 5元"},
+		{"emoji", "太棒了😄👍！明天☀️见", "太棒了！明天见"},
+		{"emoji sequence", "一家人👨‍👩‍👧在一起", "一家人在一起"},
+		{"spaces", "a   b\t\tc", "a b c"},
+		{"crlf", "一\r\n\r\n二", "一\n二"},
+		{"only formatting", "```\ncode\n```", ""},
+	}
+
+	n := NewNormalizer(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, n.Clean(tt.text))
+		})
+	}
+}
+
+func TestSpokenChinese(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"integer", "一共有123个", "一共有一百二十三个"},
+		{"teens", "他今年15岁", "他今年十五岁"},
+		{"zeros", "1005和10010", "一千零五和一万零一十"},
+		{"large", "人口14亿，约1400000000人", "人口十四亿，约十四亿人"},
+		{"thousands separator", "售价12,800元", "售价一万二千八百元"},
+		{"two with measure word", "买2个苹果，等2天", "买两个苹果，等两天"},
+		{"two without measure word", "第2名", "第二名"},
+		{"decimal", "圆周率约3.14", "圆周率约三点一四"},
+		{"negative", "气温-5度", "气温负五度"},
+		{"leading zero", "编号007", "编号零零七"},
+		{"date", "2024-03-05出发", "二零二四年三月五日出发"},
+		{"date with slash", "截止2024/12/31", "截止二零二四年十二月三十一日"},
+		{"year", "2008年奥运会", "二零零八年奥运会"},
+		{"time", "10:30开会", "十点三十分开会"},
+		{"time with zero", "8:05出发", "八点零五分出发"},
+		{"o'clock", "2:00见", "两点整见"},
+		{"time with seconds", "现在12:30:15", "现在十二点三十分十五秒"},
+		{"percent", "增长了25%", "增长了百分之二十五"},
+		{"decimal percent", "利率3.5％", "利率百分之三点五"},
+		{"permille", "千分比5‰", "千分比千分之五"},
+		{"mobile", "电话13812345678", "电话幺三八幺二三四五六七八"},
+		{"landline", "拨打010-12345678", "拨打零幺零幺二三四五六七八"},
+		{"currency", "花了¥35.5", "花了三十五点五元"},
+		{"dollar", "价格$20", "价格二十美元"},
+		{"unit", "跑了5km", "跑了五公里"},
+		{"two with unit", "重2kg", "重两公斤"},
+		{"temperature", "今天25℃", "今天二十五摄氏度"},
+		{"speed", "时速120km/h", "时速一百二十公里每小时"},
+		{"unknown unit", "型号5X", "型号五X"},
+		{"range", "需要3-5天", "需要三到五天"},
+		{"operator", "1+1=2吗", "一加一等于二吗"},
+		{"version", "升级到1.2.3版本", "升级到一点二点三版本"},
+		{"abbreviation", "水果，e.g.苹果", "水果，例如苹果"},
+	}
+
+	n := NewNormalizer(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, n.Spoken(tt.text))
+		})
+	}
+}
+
+func TestSpokenEnglish(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"integer", "I have 3 cats", "I have three cats"},
+		{"hyphenated", "It costs 42 points", "It costs forty-two points"},
+		{"large", "About 1,234,567 people", "About one million two hundred thirty-four thousand five hundred sixty-seven people"},
+		{"hundred", "Room 100", "Room one hundred"},
+		{"decimal", "Pi is 3.14", "Pi is three point one four"},
+		{"negative", "It is -5 outside", "It is minus five outside"},
+		{"date", "Due 2024-03-05.", "Due March fifth, twenty twenty-four."},
+		{"old date", "Born 1999-12-21", "Born December twenty-first, nineteen ninety-nine"},
+		{"round year", "On 2000-01-01", "On January first, two thousand"},
+		{"time", "Meet at 10:30", "Meet at ten thirty"},
+		{"time with zero", "Wake at 7:05", "Wake at seven oh five"},
+		{"o'clock", "Lunch at 12:00", "Lunch at twelve o'clock"},
+		{"percent", "Up 25%", "Up twenty-five percent"},
+		{"dollars", "It costs $3.50", "It costs three dollars and fifty cents"},
+		{"one dollar", "Only $1", "Only one dollar"},
+		{"unit", "Walk 5km", "Walk five kilometers"},
+		{"one unit", "Just 1kg", "Just one kilogram"},
+		{"temperature", "It is 20°C", "It is twenty degrees Celsius"},
+		{"range", "Wait 3-5 days", "Wait three to five days"},
+		{"operator", "2 + 2 = 4", "two plus two equals four"},
+		{"abbreviations", "Fruits, e.g. apples, etc.", "Fruits, for example apples, et cetera"},
+		{"title", "Dr. Smith", "Doctor Smith"},
+		{"not a word", "avs.", "avs."},
+	}
+
+	n := NewNormalizer(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, n.Spoken(tt.text))
+		})
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	n := NewNormalizer(map[string]string{
+		"行长":     "杭长",
+		"AI":     "人工智能",
+		"AI助手":   "爱助手",
+		"GoLang": "go lang",
+		"":       "ignored",
+	})
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"word", "银行行长来了", "银行杭长来了"},
+		{"longest first", "我是AI助手", "我是爱助手"},
+		{"whole word", "AI is not SAID", "人工智能 is not SAID"},
+		{"next to Chinese", "用AI写作", "用人工智能写作"},
+		{"mixed with numbers", "学GoLang 2天", "学go lang 两天"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, n.Spoken(tt.text))
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	n := NewNormalizer(nil)
+	assert.Equal(t, "第一步：打开设置，音量调到百分之八十\n第二步：等两分钟",
+		n.Normalize("### 第一步：打开**设置**，音量调到80% 🎵\n- 第二步：等2分钟"))
+
+	var none *Normalizer
+	assert.Equal(t, "**2**个", none.Normalize("**2**个"))
+}
+
+func TestSpokenLanguage(t *testing.T) {
+	n := NewNormalizer(nil)
+	assert.Equal(t, "three apples", n.Spoken("3 apples"))
+	assert.Equal(t, "三个apple", n.Spoken("3个apple"))
+}
@@ -0,0 +1,573 @@
+package text
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	reThousands = regexp.MustCompile(`\d{1,3}(?:,\d{3})+`)
+	rePhone     = regexp.MustCompile(`(?:\+86[- ]?)?1[3-9]\d{9}|0\d{2,3}-\d{7,8}|[48]00-?\d{3}-?\d{4}`)
+	reDate      = regexp.MustCompile(`(\d{4})[-/](\d{1,2})[-/](\d{1,2})`)
+	reYear      = regexp.MustCompile(`(\d{4})年`)
+	reTime      = regexp.MustCompile(`(\d{1,2}):(\d{2})(?::(\d{2}))?`)
+	reVersion   = regexp.MustCompile(`\d+(?:\.\d+){2,}`)
+	reCurrency  = regexp.MustCompile(`([¥￥$€£])\s?(\d+(?:\.\d+)?)`)
+	rePercent   = regexp.MustCompile(`(-?\d+(?:\.\d+)?)\s?([%％‰])`)
+	reRange     = regexp.MustCompile(`(\d)\s?[-~～]\s?(\d)`)
+	reOperator  = regexp.MustCompile(`(\d)\s?([+×*÷=])\s?(-?\d)`)
+	reUnit      = regexp.MustCompile(`(\d+(?:\.\d+)?)\s?(km/h|m/s|°C|°F|℃|℉|°|[A-Za-z]+[²³]?)`)
+	reNumber    = regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+)
+
+// language spells out numbers and expands abbreviations
+type language struct {
+	abbreviations []pronunciation
+	currencies    map[string][2]string // symbol -> singular and plural name
+	units         map[string][2]string
+	operators     map[string]string
+
+	integer    func(n int64) string
+	digit      func(d byte) string
+	digitSep   string // between digits read one by one
+	phoneOne   string // 1 of phone numbers, empty if read as usual
+	point      string
+	negative   string
+	percent    func(number string) string
+	permille   func(number string) string
+	rangeTo    string
+	date       func(year, month, day int) string
+	time       func(hour, minute, second int, hasSecond bool) string
+	year       func(year string) string
+	withUnit   func(number, unit string) string // number is spelled out
+	maxInteger int64                            // longer integers are read digit by digit
+}
+
+func languageOf(text string) *language {
+	if hasHan(text) {
+		return chinese
+	}
+	return english
+}
+
+// spellNumbers spells out numbers in the order from the most to the least
+// specific pattern, so dates are not read as subtractions
+func spellNumbers(text string, lang *language) string {
+	text = reThousands.ReplaceAllStringFunc(text, func(m string) string {
+		return strings.ReplaceAll(m, ",", "")
+	})
+
+	text = replaceMatches(rePhone, text, func(m []string, before, after rune) (string, bool) {
+		if isDigit(before) || isDigit(after) {
+			return "", false
+		}
+		spoken := lang.digits(m[0])
+		if lang.phoneOne != "" {
+			spoken = strings.ReplaceAll(spoken, lang.digit('1'), lang.phoneOne)
+		}
+		return spoken, true
+	})
+
+	text = replaceMatches(reDate, text, func(m []string, before, after rune) (string, bool) {
+		year, month, day := atoi(m[1]), atoi(m[2]), atoi(m[3])
+		if isDigit(before) || isDigit(after) || month < 1 || month > 12 || day < 1 || day > 31 {
+			return "", false
+		}
+		return lang.date(year, month, day), true
+	})
+
+	if lang.year != nil {
+		text = replaceMatches(reYear, text, func(m []string, before, after rune) (string, bool) {
+			if isDigit(before) {
+				return "", false
+			}
+			return lang.year(m[1]), true
+		})
+	}
+
+	text = replaceMatches(reTime, text, func(m []string, before, after rune) (string, bool) {
+		hour, minute, second := atoi(m[1]), atoi(m[2]), atoi(m[3])
+		if isDigit(before) || isDigit(after) || hour > 24 || minute > 59 || second > 59 {
+			return "", false
+		}
+		return lang.time(hour, minute, second, len(m[3]) != 0), true
+	})
+
+	text = replaceMatches(reVersion, text, func(m []string, before, after rune) (string, bool) {
+		parts := strings.Split(m[0], ".")
+		for i, part := range parts {
+			parts[i] = lang.number(part, after)
+		}
+		return strings.Join(parts, lang.point), true
+	})
+
+	text = replaceMatches(reCurrency, text, func(m []string, before, after rune) (string, bool) {
+		return lang.currency(m[1], m[2]), true
+	})
+
+	text = replaceMatches(rePercent, text, func(m []string, before, after rune) (string, bool) {
+		number := lang.number(m[1], 0)
+		if m[2] == "‰" {
+			return lang.permille(number), true
+		}
+		return lang.percent(number), true
+	})
+
+	text = replaceMatches(reUnit, text, func(m []string, before, after rune) (string, bool) {
+		names, ok := lang.units[m[2]]
+		if !ok || isLatinAlnum(before) {
+			return "", false
+		}
+		// Chinese has no plural
+		name := names[1]
+		if m[1] == "1" || len(name) == 0 {
+			name = names[0]
+		}
+		return lang.withUnit(lang.number(m[1], 0), name), true
+	})
+
+	// ranges and operators share their digits with the next match
+	for range 2 {
+		text = replaceMatches(reRange, text, func(m []string, before, after rune) (string, bool) {
+			return m[1] + lang.rangeTo + m[2], true
+		})
+		text = replaceMatches(reOperator, text, func(m []string, before, after rune) (string, bool) {
+			return m[1] + lang.operators[m[2]] + m[3], true
+		})
+	}
+
+	return replaceMatches(reNumber, text, func(m []string, before, after rune) (string, bool) {
+		number := m[0]
+		if strings.HasPrefix(number, "-") && (isLatinAlnum(before) || before == '-') {
+			return "-" + lang.number(number[1:], after), true
+		}
+		return lang.number(number, after), true
+	})
+}
+
+// number spells out an integer or a decimal, after is the rune following it
+func (l *language) number(number string, after rune) string {
+	var prefix string
+	if strings.HasPrefix(number, "-") {
+		prefix, number = l.negative, number[1:]
+	}
+
+	integer, fraction, _ := strings.Cut(number, ".")
+	spoken := l.cardinal(integer, after)
+	if len(fraction) != 0 {
+		spoken += l.point + l.digits(fraction)
+	}
+
+	return prefix + spoken
+}
+
+// cardinal spells out an integer, leading zeros and very long integers such
+// as serial numbers are read digit by digit
+func (l *language) cardinal(integer string, after rune) string {
+	if (len(integer) > 1 && integer[0] == '0') || len(integer) > 16 {
+		return l.digits(integer)
+	}
+
+	n, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil || n > l.maxInteger {
+		return l.digits(integer)
+	}
+
+	if l == chinese && n == 2 && strings.ContainsRune(zhMeasureWords, after) {
+		return "两"
+	}
+
+	return l.integer(n)
+}
+
+// digits reads every digit of text, other characters are kept
+func (l *language) digits(text string) string {
+	var parts []string
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c >= '0' && c <= '9':
+			parts = append(parts, l.digit(c))
+		case c == '+':
+			parts = append(parts, l.operators["+"])
+		}
+	}
+
+	return strings.Join(parts, l.digitSep)
+}
+
+func (l *language) currency(symbol, amount string) string {
+	names := l.currencies[symbol]
+	if l == english {
+		integer, fraction, _ := strings.Cut(amount, ".")
+		name := names[1]
+		if integer == "1" {
+			name = names[0]
+		}
+		cents := atoi(fraction)
+		switch {
+		case cents == 0:
+			return l.cardinal(integer, 0) + " " + name
+		case len(fraction) == 2 && (symbol == "$" || symbol == "€"):
+			return l.cardinal(integer, 0) + " " + name + " and " + enInteger(int64(cents)) + " " + plural(cents, "cent", "cents")
+		default:
+			return l.number(amount, 0) + " " + names[1]
+		}
+	}
+
+	return l.number(amount, 0) + names[0]
+}
+
+// replaceMatches replaces the matches of re for which fn returns true, fn is
+// given the submatches and the runes around the match, 0 at the ends of text
+func replaceMatches(re *regexp.Regexp, text string, fn func(m []string, before, after rune) (string, bool)) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, loc := range matches {
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = text[loc[2*i]:loc[2*i+1]]
+			}
+		}
+
+		var before, after rune
+		if loc[0] > 0 {
+			before, _ = utf8.DecodeLastRuneInString(text[:loc[0]])
+		}
+		if loc[1] < len(text) {
+			after, _ = utf8.DecodeRuneInString(text[loc[1]:])
+		}
+
+		replacement, ok := fn(m, before, after)
+		if !ok {
+			continue
+		}
+
+		sb.WriteString(text[last:loc[0]])
+		sb.WriteString(replacement)
+		last = loc[1]
+	}
+	sb.WriteString(text[last:])
+
+	return sb.String()
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// Chinese
+
+var zhDigits = []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+// 2 followed by them is read 两, e.g. 两个, 两点
+const zhMeasureWords = "个位只次天年分件本种点条张把台辆岁斤周倍"
+
+var chinese = &language{
+	abbreviations: []pronunciation{
+		{"e.g.", "例如"}, {"i.e.", "即"}, {"etc.", "等"}, {"vs.", "对"}, {"vs", "对"},
+	},
+	currencies: map[string][2]string{
+		"¥": {"元"}, "￥": {"元"}, "$": {"美元"}, "€": {"欧元"}, "£": {"英镑"},
+	},
+	units: map[string][2]string{
+		"km": {"公里"}, "m": {"米"}, "cm": {"厘米"}, "mm": {"毫米"},
+		"kg": {"公斤"}, "g": {"克"}, "mg": {"毫克"},
+		"L": {"升"}, "l": {"升"}, "ml": {"毫升"}, "mL": {"毫升"},
+		"m²": {"平方米"}, "m³": {"立方米"}, "km²": {"平方公里"},
+		"km/h": {"公里每小时"}, "m/s": {"米每秒"},
+		"℃": {"摄氏度"}, "°C": {"摄氏度"}, "℉": {"华氏度"}, "°F": {"华氏度"}, "°": {"度"},
+		"h": {"小时"}, "min": {"分钟"}, "s": {"秒"}, "ms": {"毫秒"},
+		"kW": {"千瓦"}, "W": {"瓦"}, "V": {"伏"}, "mAh": {"毫安时"}, "Hz": {"赫兹"},
+	},
+	operators: map[string]string{
+		"+": "加", "×": "乘", "*": "乘", "÷": "除以", "=": "等于",
+	},
+	integer:  zhInteger,
+	digit:    func(d byte) string { return zhDigits[d-'0'] },
+	phoneOne: "幺",
+	point:    "点",
+	negative: "负",
+	percent:  func(number string) string { return "百分之" + number },
+	permille: func(number string) string { return "千分之" + number },
+	rangeTo:  "到",
+	date: func(year, month, day int) string {
+		return zhYear(strconv.Itoa(year)) + zhInteger(int64(month)) + "月" + zhInteger(int64(day)) + "日"
+	},
+	time: zhTime,
+	year: zhYear,
+	withUnit: func(number, unit string) string {
+		if number == "二" {
+			number = "两"
+		}
+		return number + unit
+	},
+	maxInteger: 1e16 - 1,
+}
+
+// zhYear reads a year digit by digit, e.g. 二零二四年
+func zhYear(year string) string {
+	var sb strings.Builder
+	for i := 0; i < len(year); i++ {
+		sb.WriteString(zhDigits[year[i]-'0'])
+	}
+	sb.WriteString("年")
+	return sb.String()
+}
+
+// zhTime reads a time of the day, e.g. 十点零五分, 两点整
+func zhTime(hour, minute, second int, hasSecond bool) string {
+	spoken := zhInteger(int64(hour)) + "点"
+	if hour == 2 {
+		spoken = "两点"
+	}
+
+	switch {
+	case minute == 0 && !hasSecond:
+		spoken += "整"
+	case minute == 0:
+	case minute < 10:
+		spoken += "零" + zhInteger(int64(minute)) + "分"
+	default:
+		spoken += zhInteger(int64(minute)) + "分"
+	}
+
+	if hasSecond {
+		spoken += zhInteger(int64(second)) + "秒"
+	}
+	return spoken
+}
+
+// zhInteger spells out n in Chinese, e.g. 一千零五, 十万
+func zhInteger(n int64) string {
+	if n == 0 {
+		return "零"
+	}
+
+	units := []string{"", "万", "亿", "万亿"}
+	var groups []int64
+	for n > 0 {
+		groups = append(groups, n%10000)
+		n /= 10000
+	}
+
+	var sb strings.Builder
+	zero := false // zeros between two non zero groups are read once
+	for i := len(groups) - 1; i >= 0; i-- {
+		g := groups[i]
+		if g == 0 {
+			zero = sb.Len() != 0
+			continue
+		}
+
+		if sb.Len() != 0 && (zero || g < 1000) {
+			sb.WriteString("零")
+		}
+		sb.WriteString(zhGroup(g))
+		sb.WriteString(units[i])
+		zero = false
+	}
+
+	// 一十 is read 十 at the beginning
+	spoken := sb.String()
+	if strings.HasPrefix(spoken, "一十") {
+		spoken = strings.TrimPrefix(spoken, "一")
+	}
+	return spoken
+}
+
+// zhGroup spells out 1 to 9999
+func zhGroup(g int64) string {
+	places := []string{"千", "百", "十", ""}
+	digits := []int64{g / 1000, g / 100 % 10, g / 10 % 10, g % 10}
+
+	var sb strings.Builder
+	started, zero := false, false
+	for i, d := range digits {
+		if d == 0 {
+			zero = started
+			continue
+		}
+
+		if zero {
+			sb.WriteString("零")
+			zero = false
+		}
+		sb.WriteString(zhDigits[d])
+		sb.WriteString(places[i])
+		started = true
+	}
+
+	return sb.String()
+}
+
+// English
+
+var (
+	enOnes = []string{
+		"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen",
+	}
+	enTens   = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+	enScales = []string{"", " thousand", " million", " billion", " trillion"}
+	enMonths = []string{
+		"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December",
+	}
+	enOrdinals = map[string]string{
+		"one": "first", "two": "second", "three": "third", "five": "fifth",
+		"eight": "eighth", "nine": "ninth", "twelve": "twelfth",
+	}
+)
+
+var english = &language{
+	abbreviations: []pronunciation{
+		{"e.g.", "for example"}, {"i.e.", "that is"}, {"etc.", "et cetera"}, {"vs.", "versus"}, {"vs", "versus"},
+		{"Mr.", "Mister"}, {"Mrs.", "Missus"}, {"Dr.", "Doctor"}, {"Prof.", "Professor"}, {"approx.", "approximately"},
+	},
+	currencies: map[string][2]string{
+		"$": {"dollar", "dollars"}, "€": {"euro", "euros"}, "£": {"pound", "pounds"},
+		"¥": {"yuan", "yuan"}, "￥": {"yuan", "yuan"},
+	},
+	units: map[string][2]string{
+		"km": {"kilometer", "kilometers"}, "m": {"meter", "meters"}, "cm": {"centimeter", "centimeters"}, "mm": {"millimeter", "millimeters"},
+		"kg": {"kilogram", "kilograms"}, "g": {"gram", "grams"}, "mg": {"milligram", "milligrams"},
+		"L": {"liter", "liters"}, "l": {"liter", "liters"}, "ml": {"milliliter", "milliliters"}, "mL": {"milliliter", "milliliters"},
+		"m²": {"square meter", "square meters"}, "m³": {"cubic meter", "cubic meters"}, "km²": {"square kilometer", "square kilometers"},
+		"km/h": {"kilometer per hour", "kilometers per hour"}, "m/s": {"meter per second", "meters per second"},
+		"mph": {"mile per hour", "miles per hour"},
+		"℃":   {"degree Celsius", "degrees Celsius"}, "°C": {"degree Celsius", "degrees Celsius"},
+		"℉": {"degree Fahrenheit", "degrees Fahrenheit"}, "°F": {"degree Fahrenheit", "degrees Fahrenheit"},
+		"°": {"degree", "degrees"},
+		"h": {"hour", "hours"}, "min": {"minute", "minutes"}, "s": {"second", "seconds"}, "ms": {"millisecond", "milliseconds"},
+		"kW": {"kilowatt", "kilowatts"}, "W": {"watt", "watts"}, "V": {"volt", "volts"}, "mAh": {"milliamp hour", "milliamp hours"},
+		"Hz": {"hertz", "hertz"},
+	},
+	operators: map[string]string{
+		"+": " plus ", "×": " times ", "*": " times ", "÷": " divided by ", "=": " equals ",
+	},
+	integer:  enInteger,
+	digit:    func(d byte) string { return enOnes[d-'0'] },
+	digitSep: " ",
+	point:    " point ",
+	negative: "minus ",
+	percent:  func(number string) string { return number + " percent" },
+	permille: func(number string) string { return number + " per mille" },
+	rangeTo:  " to ",
+	date: func(year, month, day int) string {
+		return enMonths[month-1] + " " + enOrdinal(int64(day)) + ", " + enYear(year)
+	},
+	time: enTime,
+	withUnit: func(number, unit string) string {
+		return number + " " + unit
+	},
+	maxInteger: 1e15 - 1,
+}
+
+// enInteger spells out n in English, e.g. one hundred twenty-three
+func enInteger(n int64) string {
+	if n < 20 {
+		return enOnes[n]
+	}
+
+	var parts []string
+	for scale := 0; n > 0; scale++ {
+		if g := n % 1000; g != 0 {
+			parts = append([]string{enGroup(g) + enScales[scale]}, parts...)
+		}
+		n /= 1000
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// enGroup spells out 1 to 999
+func enGroup(g int64) string {
+	var parts []string
+	if g >= 100 {
+		parts = append(parts, enOnes[g/100]+" hundred")
+		g %= 100
+	}
+
+	switch {
+	case g == 0:
+	case g < 20:
+		parts = append(parts, enOnes[g])
+	case g%10 == 0:
+		parts = append(parts, enTens[g/10])
+	default:
+		parts = append(parts, enTens[g/10]+"-"+enOnes[g%10])
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// enOrdinal spells out the ordinal of n, e.g. twenty-first
+func enOrdinal(n int64) string {
+	cardinal := enInteger(n)
+	i := strings.LastIndexAny(cardinal, " -") + 1
+	last := cardinal[i:]
+
+	switch {
+	case enOrdinals[last] != "":
+		last = enOrdinals[last]
+	case strings.HasSuffix(last, "y"):
+		last = strings.TrimSuffix(last, "y") + "ieth"
+	default:
+		last += "th"
+	}
+
+	return cardinal[:i] + last
+}
+
+// enYear reads a year in pairs of digits, e.g. nineteen ninety-nine
+func enYear(year int) string {
+	switch {
+	case year < 1000 || year%1000 < 10 && year/1000 == 2:
+		return enInteger(int64(year))
+	case year%100 == 0:
+		return enInteger(int64(year/100)) + " hundred"
+	case year%100 < 10:
+		return enInteger(int64(year/100)) + " oh " + enOnes[year%100]
+	default:
+		return enInteger(int64(year/100)) + " " + enInteger(int64(year%100))
+	}
+}
+
+// enTime reads a time of the day, e.g. ten oh five, ten o'clock
+func enTime(hour, minute, second int, hasSecond bool) string {
+	spoken := enInteger(int64(hour))
+	switch {
+	case minute == 0:
+		spoken += " o'clock"
+	case minute < 10:
+		spoken += " oh " + enOnes[minute]
+	default:
+		spoken += " " + enInteger(int64(minute))
+	}
+
+	if hasSecond {
+		spoken += " and " + enInteger(int64(second)) + " " + plural(second, "second", "seconds")
+	}
+	return spoken
+}
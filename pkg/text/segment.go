@@ -0,0 +1,198 @@
+// Package text prepares answers of LLM for speech.
+package text
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// abbreviations whose trailing dot does not end an English sentence
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true,
+	"st": true, "vs": true, "etc": true, "e.g": true, "i.e": true, "u.s": true, "u.k": true,
+	"a.m": true, "p.m": true, "no": true, "inc": true, "ltd": true, "co": true, "fig": true,
+}
+
+var quotePairs = map[rune]rune{
+	'“': '”',
+	'‘': '’',
+	'「': '」',
+	'『': '』',
+	'《': '》',
+}
+
+// Segmenter splits text into sentences synthesized one at a time, so the first
+// sentence is spoken while the following ones are still being synthesized
+type Segmenter struct {
+	MinRunes int // shorter sentences are merged with the next one
+	MaxRunes int // sentences reaching it are split at the next comma, 0 is unlimited
+}
+
+func NewSegmenter(minRunes, maxRunes int) *Segmenter {
+	return &Segmenter{
+		MinRunes: minRunes,
+		MaxRunes: maxRunes,
+	}
+}
+
+// Split returns the sentences of text, ending punctuation and closing quotes
+// are kept with their sentence
+func (s *Segmenter) Split(text string) []string {
+	sentences := make([]string, 0)
+	for _, piece := range s.merge(s.cut(text)) {
+		if piece = strings.TrimSpace(piece); len(piece) != 0 {
+			sentences = append(sentences, piece)
+		}
+	}
+
+	return sentences
+}
+
+// cut breaks text after every sentence end outside of quotes, whitespace is
+// kept so merged pieces read like the original
+func (s *Segmenter) cut(text string) []string {
+	runes := []rune(text)
+	pieces := make([]string, 0)
+
+	var (
+		start  int
+		quotes []rune // expected closing quotes
+		ascii  bool   // within ASCII double quotes
+	)
+	quoted := func() bool {
+		return len(quotes) != 0 || ascii
+	}
+	// consumes closing quotes and repeated terminators following i
+	extend := func(i int) int {
+		for i+1 < len(runes) {
+			next := runes[i+1]
+			switch {
+			case isTerminator(next) || next == '.':
+			case len(quotes) != 0 && next == quotes[len(quotes)-1]:
+				quotes = quotes[:len(quotes)-1]
+			case ascii && next == '"':
+				ascii = false
+			default:
+				return i
+			}
+			i++
+		}
+		return i
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		end := false
+
+		switch {
+		case r == '\n':
+			end = true
+		case r == '"':
+			ascii = !ascii
+		case quotePairs[r] != 0:
+			quotes = append(quotes, quotePairs[r])
+		case len(quotes) != 0 && r == quotes[len(quotes)-1]:
+			quotes = quotes[:len(quotes)-1]
+		case isTerminator(r):
+			i = extend(i)
+			end = !quoted() || s.tooLong(i-start)
+		case r == '.':
+			if endsEnglishSentence(runes, i) {
+				i = extend(i)
+				end = !quoted() || s.tooLong(i-start)
+			}
+		case isPause(r):
+			end = s.tooLong(i - start)
+		}
+
+		if end {
+			pieces = append(pieces, string(runes[start:i+1]))
+			start = i + 1
+		}
+	}
+
+	if start < len(runes) {
+		pieces = append(pieces, string(runes[start:]))
+	}
+
+	return pieces
+}
+
+// merge joins pieces shorter than MinRunes with the following piece, the last
+// one is joined with its predecessor
+func (s *Segmenter) merge(pieces []string) []string {
+	merged := make([]string, 0, len(pieces))
+	for _, piece := range pieces {
+		if n := len(merged); n != 0 && (s.tooShort(merged[n-1]) || !speakable(piece)) {
+			merged[n-1] += piece
+			continue
+		}
+		merged = append(merged, piece)
+	}
+
+	if n := len(merged); n > 1 && s.tooShort(merged[n-1]) {
+		merged[n-2] += merged[n-1]
+		merged = merged[:n-1]
+	}
+
+	return merged
+}
+
+func (s *Segmenter) tooShort(piece string) bool {
+	return utf8.RuneCountInString(strings.TrimSpace(piece)) < s.MinRunes
+}
+
+func (s *Segmenter) tooLong(runes int) bool {
+	return s.MaxRunes > 0 && runes >= s.MaxRunes
+}
+
+// endsEnglishSentence reports whether the dot at i ends a sentence rather than
+// a number, an abbreviation or an initial
+func endsEnglishSentence(runes []rune, i int) bool {
+	if i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != '"' {
+		return false // e.g. 3.14, example.com or ...
+	}
+
+	begin := i
+	for begin > 0 && (unicode.IsLetter(runes[begin-1]) || runes[begin-1] == '.') {
+		begin--
+	}
+	word := strings.ToLower(string(runes[begin:i]))
+	if abbreviations[word] {
+		return false
+	}
+
+	// initials, e.g. J. K. Rowling
+	if n := utf8.RuneCountInString(word); n == 1 && unicode.IsUpper(runes[i-1]) {
+		return false
+	}
+
+	return true
+}
+
+func isTerminator(r rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '…', '!', '?', ';':
+		return true
+	}
+	return false
+}
+
+func isPause(r rune) bool {
+	switch r {
+	case '，', '、', '：', ',', ':':
+		return true
+	}
+	return false
+}
+
+// speakable reports whether piece has anything but punctuation and spaces
+func speakable(piece string) bool {
+	for _, r := range piece {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmenterSplit(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "chinese",
+			text: "今天天气很好，适合出去散步。你想去公园吗？我们可以一起去！",
+			want: []string{"今天天气很好，适合出去散步。", "你想去公园吗？", "我们可以一起去！"},
+		},
+		{
+			name: "english",
+			text: "It is sunny today. Do you want to go to the park? Let's go!",
+			want: []string{"It is sunny today.", "Do you want to go to the park?", "Let's go!"},
+		},
+		{
+			name: "numbers and abbreviations",
+			text: "Pi is about 3.14 and Dr. Smith agrees. Visit example.com now.",
+			want: []string{"Pi is about 3.14 and Dr. Smith agrees.", "Visit example.com now."},
+		},
+		{
+			name: "initials",
+			text: "J. K. Rowling wrote it. She lives in Edinburgh.",
+			want: []string{"J. K. Rowling wrote it.", "She lives in Edinburgh."},
+		},
+		{
+			name: "quotes",
+			text: "他说：“你好。我是小智。”然后笑了起来。",
+			want: []string{"他说：“你好。我是小智。”", "然后笑了起来。"},
+		},
+		{
+			name: "closing quote kept",
+			text: "She said \"See you tomorrow.\" Then she left the room.",
+			want: []string{"She said \"See you tomorrow.\"", "Then she left the room."},
+		},
+		{
+			name: "repeated terminators",
+			text: "真的吗？！太好了……我们出发吧。",
+			want: []string{"真的吗？！太好了……", "我们出发吧。"},
+		},
+		{
+			name: "short fragments merged",
+			text: "好的。嗯。那我们明天上午九点见面吧。",
+			want: []string{"好的。嗯。那我们明天上午九点见面吧。"},
+		},
+		{
+			name: "short tail merged",
+			text: "那我们明天上午九点见面吧。好的。",
+			want: []string{"那我们明天上午九点见面吧。好的。"},
+		},
+		{
+			name: "newlines",
+			text: "第一步打开冰箱门\n第二步把大象放进去\n",
+			want: []string{"第一步打开冰箱门", "第二步把大象放进去"},
+		},
+		{
+			name: "long sentence split at commas",
+			text: "春天来了，小草从地下探出头来，花儿也都开了，小鸟在树上唱着歌。",
+			want: []string{"春天来了，小草从地下探出头来，花儿也都开了，", "小鸟在树上唱着歌。"},
+		},
+		{
+			name: "empty",
+			text: "  ",
+			want: []string{},
+		},
+	}
+
+	s := NewSegmenter(6, 16)
+	for _, c := range cases {
+		assert.Equal(t, c.want, s.Split(c.text), c.name)
+	}
+}
@@ -0,0 +1,301 @@
+// Package cache keeps the encoded audio of synthesized sentences, so common
+// phrases are not synthesized again on every turn.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type Config struct {
+	Dir       string        // frames are kept in memory only if empty
+	MaxMemory int64         // bytes of frames kept in memory, 0 is unlimited
+	MaxDisk   int64         // bytes of frames kept on disk, 0 is unlimited
+	TTL       time.Duration // frames older than it are dropped, 0 keeps them forever
+}
+
+// Cache stores the Opus frames of sentences on disk with the most recently
+// used ones in memory, entries are addressed by Key
+type Cache struct {
+	cfg Config
+
+	mu          sync.Mutex
+	lru         *list.List               // of *entry, the front is the most recently used
+	memory      map[string]*list.Element // key -> element in lru
+	memoryBytes int64
+	disk        map[string]*diskEntry // key -> file of the frames
+	diskBytes   int64
+
+	now func() time.Time
+}
+
+type entry struct {
+	key      string
+	frames   [][]byte
+	size     int64
+	storedAt time.Time
+}
+
+type diskEntry struct {
+	size     int64
+	storedAt time.Time
+	usedAt   time.Time
+}
+
+// New creates the cache, files left in Dir by a previous run are reused
+func New(cfg Config) (*Cache, error) {
+	c := &Cache{
+		cfg:    cfg,
+		lru:    list.New(),
+		memory: make(map[string]*list.Element),
+		disk:   make(map[string]*diskEntry),
+		now:    time.Now,
+	}
+
+	if len(cfg.Dir) == 0 {
+		return c, nil
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create TTS cache directory")
+	}
+
+	err := filepath.WalkDir(cfg.Dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		c.disk[d.Name()] = &diskEntry{
+			size:     info.Size(),
+			storedAt: info.ModTime(),
+			usedAt:   info.ModTime(),
+		}
+		c.diskBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan TTS cache directory")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictDisk()
+
+	return c, nil
+}
+
+// Key addresses the frames of a sentence, parts should identify everything
+// the audio depends on, e.g. provider, voice, speed, encoding and text
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the frames of key, they are shared and must not be modified
+func (c *Cache) Get(key string) ([][]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if el, ok := c.memory[key]; ok {
+		e := el.Value.(*entry)
+		if !c.expired(e.storedAt, now) {
+			c.lru.MoveToFront(el)
+			if d, ok := c.disk[key]; ok {
+				d.usedAt = now
+			}
+			return e.frames, true
+		}
+		c.removeMemory(el)
+	}
+
+	d, ok := c.disk[key]
+	if !ok {
+		return nil, false
+	}
+
+	if c.expired(d.storedAt, now) {
+		c.removeDisk(key)
+		return nil, false
+	}
+
+	frames, err := readFrames(c.path(key))
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to read TTS cache %s", key)
+		c.removeDisk(key)
+		return nil, false
+	}
+
+	d.usedAt = now
+	c.addMemory(&entry{key: key, frames: frames, size: d.size, storedAt: d.storedAt})
+	return frames, true
+}
+
+// Put stores the frames of key, replacing the ones stored before
+func (c *Cache) Put(key string, frames [][]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	var size int64
+	for _, frame := range frames {
+		size += int64(len(frame)) + 2
+	}
+
+	if el, ok := c.memory[key]; ok {
+		c.removeMemory(el)
+	}
+	c.addMemory(&entry{key: key, frames: frames, size: size, storedAt: now})
+
+	if len(c.cfg.Dir) == 0 {
+		return nil
+	}
+
+	if err := writeFrames(c.path(key), frames); err != nil {
+		return err
+	}
+
+	if d, ok := c.disk[key]; ok {
+		c.diskBytes -= d.size
+	}
+	c.disk[key] = &diskEntry{size: size, storedAt: now, usedAt: now}
+	c.diskBytes += size
+	c.evictDisk()
+
+	return nil
+}
+
+func (c *Cache) expired(storedAt, now time.Time) bool {
+	return c.cfg.TTL > 0 && now.Sub(storedAt) > c.cfg.TTL
+}
+
+func (c *Cache) addMemory(e *entry) {
+	c.memory[e.key] = c.lru.PushFront(e)
+	c.memoryBytes += e.size
+
+	for c.cfg.MaxMemory > 0 && c.memoryBytes > c.cfg.MaxMemory && c.lru.Len() > 1 {
+		c.removeMemory(c.lru.Back())
+	}
+}
+
+func (c *Cache) removeMemory(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.memory, e.key)
+	c.memoryBytes -= e.size
+}
+
+// evictDisk removes the least recently used files until the limit is met
+func (c *Cache) evictDisk() {
+	if c.cfg.MaxDisk <= 0 || c.diskBytes <= c.cfg.MaxDisk {
+		return
+	}
+
+	keys := make([]string, 0, len(c.disk))
+	for key := range c.disk {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.disk[keys[i]].usedAt.Before(c.disk[keys[j]].usedAt)
+	})
+
+	for _, key := range keys {
+		if c.diskBytes <= c.cfg.MaxDisk {
+			break
+		}
+		c.removeDisk(key)
+	}
+}
+
+func (c *Cache) removeDisk(key string) {
+	d, ok := c.disk[key]
+	if !ok {
+		return
+	}
+
+	delete(c.disk, key)
+	c.diskBytes -= d.size
+	if err := os.Remove(c.path(key)); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msgf("Failed to remove TTS cache %s", key)
+	}
+}
+
+// files are spread over subdirectories named by the first byte of the key
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.cfg.Dir, key[:2], key)
+}
+
+// frames are stored one after another, each prefixed by its length
+func writeFrames(path string, frames [][]byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "failed to create TTS cache directory")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create TTS cache file")
+	}
+	defer os.Remove(f.Name()) // fails once renamed
+
+	for _, frame := range frames {
+		var size [2]byte
+		binary.BigEndian.PutUint16(size[:], uint16(len(frame)))
+		if _, err := f.Write(size[:]); err != nil {
+			f.Close()
+			return errors.Wrap(err, "failed to write TTS cache file")
+		}
+		if _, err := f.Write(frame); err != nil {
+			f.Close()
+			return errors.Wrap(err, "failed to write TTS cache file")
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to write TTS cache file")
+	}
+
+	return errors.Wrap(os.Rename(f.Name(), path), "failed to write TTS cache file")
+}
+
+func readFrames(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([][]byte, 0)
+	for len(data) != 0 {
+		if len(data) < 2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		size := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if len(data) < size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		frames = append(frames, data[:size])
+		data = data[size:]
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func frames(n int) [][]byte {
+	f := make([][]byte, n)
+	for i := range f {
+		f[i] = []byte{byte(i), 1, 2, 3}
+	}
+	return f
+}
+
+func TestCacheKey(t *testing.T) {
+	assert.Equal(t, Key("cosyvoice", "anna", "你好"), Key("cosyvoice", "anna", "你好"))
+	assert.NotEqual(t, Key("cosyvoice", "anna", "你好"), Key("cosyvoice", "alex", "你好"))
+	assert.NotEqual(t, Key("ab", "c"), Key("a", "bc"))
+}
+
+func TestCacheMemoryLru(t *testing.T) {
+	c, err := New(Config{MaxMemory: 2 * 3 * 6}) // two entries of three frames
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Put("a", frames(3)))
+	assert.NoError(t, c.Put("b", frames(3)))
+	_, ok := c.Get("a") // b becomes the least recently used
+	assert.True(t, ok)
+
+	assert.NoError(t, c.Put("c", frames(3)))
+	_, ok = c.Get("b")
+	assert.False(t, ok, "evicted")
+
+	got, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, frames(3), got)
+}
+
+func TestCacheDisk(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(Config{Dir: dir, MaxMemory: 1, TTL: time.Hour})
+	assert.NoError(t, err)
+
+	key := Key("cosyvoice", "anna", "你好")
+	assert.NoError(t, c.Put(key, frames(5)))
+	assert.NoError(t, c.Put(Key("other"), frames(1))) // pushes key out of memory
+
+	got, ok := c.Get(key)
+	assert.True(t, ok, "read from disk")
+	assert.Equal(t, frames(5), got)
+
+	// a new process finds the frames of the previous one
+	c, err = New(Config{Dir: dir, TTL: time.Hour})
+	assert.NoError(t, err)
+	got, ok = c.Get(key)
+	assert.True(t, ok)
+	assert.Equal(t, frames(5), got)
+
+	c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, ok = c.Get(key)
+	assert.False(t, ok, "expired")
+
+	c, err = New(Config{Dir: dir})
+	assert.NoError(t, err)
+	_, ok = c.Get(key)
+	assert.False(t, ok, "expired files are removed")
+}
+
+func TestCacheDiskLimit(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(Config{Dir: dir, MaxMemory: 1, MaxDisk: 2 * 6})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	for i, key := range []string{Key("a"), Key("b"), Key("c")} {
+		c.now = func() time.Time { return now.Add(time.Duration(i) * time.Second) }
+		assert.NoError(t, c.Put(key, frames(1)))
+	}
+
+	_, ok := c.Get(Key("a"))
+	assert.False(t, ok, "the least recently used file is removed")
+	_, ok = c.Get(Key("c"))
+	assert.True(t, ok)
+
+	c, err = New(Config{Dir: dir, MaxDisk: 6})
+	assert.NoError(t, err)
+	assert.Len(t, c.disk, 1, "limit applied to existing files")
+}
@@ -7,15 +7,26 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/samber/lo"
-	openai "github.com/sashabaranov/go-openai"
 )
 
 const (
-	TTSModel     = "FunAudioLLM/CosyVoice2-0.5B"
-	DefaultVoice = "benjamin"
+	TTSModel       = "FunAudioLLM/CosyVoice2-0.5B"
+	DefaultVoice   = "benjamin"
+	DefaultBaseURL = "https://api.siliconflow.cn"
+
+	maxGain = 10 // dB accepted by the service in both directions
+
+	speechPath      = "/v1/audio/speech"
+	uploadVoicePath = "/v1/uploads/audio/voice"
+	deleteVoicePath = "/v1/audio/voice/deletions"
 )
 
 var (
@@ -33,44 +44,93 @@ var (
 
 type Tts struct {
 	apiKey  string
-	baseURL string
+	baseURL string // e.g. https://api.siliconflow.cn
 	voice   string
 
-	client *openai.Client
+	client *http.Client
 }
 
+// NewTts creates the TTS speaking with voice, which is either a preset name
+// of VoiceList or the URI of a custom voice, e.g. speech:name:xxx:yyy
 func NewTts(apiKey, baseURL, voice string) *Tts {
 	t := &Tts{
 		apiKey:  apiKey,
-		baseURL: "https://api.siliconflow.cn/v1/audio/speech",
-		voice:   fmt.Sprintf("%s:%s", TTSModel, DefaultVoice),
+		baseURL: normalizeBaseURL(baseURL),
+		voice:   VoiceURI(voice),
+		client:  http.DefaultClient,
+	}
+
+	return t
+}
+
+// VoiceURI returns the voice sent to the API, preset names are qualified by
+// the model and URIs of custom voices are kept as is
+func VoiceURI(voice string) string {
+	if len(voice) == 0 {
+		return fmt.Sprintf("%s:%s", TTSModel, DefaultVoice)
 	}
 
 	if lo.Contains(VoiceList, voice) {
-		t.voice = fmt.Sprintf("%s:%s", TTSModel, voice)
+		return fmt.Sprintf("%s:%s", TTSModel, voice)
 	}
 
-	config := openai.DefaultConfig(t.apiKey)
-	config.BaseURL = t.baseURL
-	t.client = openai.NewClientWithConfig(config)
+	if strings.Contains(voice, ":") {
+		return voice
+	}
 
-	return t
+	log.Warn().Msgf("Unknown CosyVoice voice %s, %s is used instead", voice, DefaultVoice)
+	return fmt.Sprintf("%s:%s", TTSModel, DefaultVoice)
+}
+
+// normalizeBaseURL accepts the host, the /v1 prefix or the speech endpoint
+func normalizeBaseURL(baseURL string) string {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	baseURL = strings.TrimSuffix(baseURL, speechPath)
+	baseURL = strings.TrimSuffix(baseURL, "/v1")
+	if len(baseURL) == 0 {
+		return DefaultBaseURL
+	}
+	return baseURL
 }
 
 func (t *Tts) GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error) {
-	if t.client == nil {
-		return nil, errors.New("TTS client is not initialized")
+	body, err := t.StreamAudio(ctx, text, speed)
+	if err != nil {
+		return nil, err
 	}
+	defer body.Close()
 
+	responseBody, err := io.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read TTS response body")
+	}
+
+	return responseBody, nil
+}
+
+// StreamAudio returns the PCM as it is synthesized, the caller must close it
+func (t *Tts) StreamAudio(ctx context.Context, text string, speed float32) (io.ReadCloser, error) {
+	return t.StreamAudioWith(ctx, text, tts.Options{Rate: speed})
+}
+
+// Tunes reports that gain is applied by the service, pitch is not supported
+func (t *Tts) Tunes() (bool, bool) {
+	return true, false
+}
+
+// StreamAudioWith is StreamAudio with gain, the part of gain beyond what the
+// service accepts is applied to the PCM
+func (t *Tts) StreamAudioWith(ctx context.Context, text string, opts tts.Options) (io.ReadCloser, error) {
+	gain := max(-maxGain, min(maxGain, opts.Gain))
 	data := map[string]interface{}{
 		"model":           TTSModel,
 		"input":           text,
 		"voice":           t.voice,
 		"response_format": "pcm",
-		"sample_rate":     16000,
+		"sample_rate":     tts.SampleRate,
 		"stream":          true,
-		"gain":            0.0,
-		"speed":           speed,
+		"gain":            gain,
+		"speed":           opts.Speed(),
 	}
 
 	jsonData, err := json.Marshal(data)
@@ -78,28 +138,32 @@ func (t *Tts) GenerateAudio(ctx context.Context, text string, speed float32) ([]
 		return nil, errors.Wrap(err, "failed to marshal TTS request data")
 	}
 
-	req, _ := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		t.baseURL,
+		t.baseURL+speechPath,
 		bytes.NewBuffer(jsonData),
 	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create TTS request")
+	}
 
 	req.Header.Set("Authorization", "Bearer "+t.apiKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := t.client.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create TTS request")
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("TTS request failed with status code: %d", resp.StatusCode)
+		defer resp.Body.Close()
+		return nil, statusError(resp)
 	}
 
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to read TTS response body")
+	if gain != opts.Gain {
+		return utils.NewGainReader(resp.Body, opts.Gain-gain), nil
 	}
 
-	return responseBody, nil
+	return resp.Body, nil
 }
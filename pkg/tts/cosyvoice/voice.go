@@ -0,0 +1,93 @@
+package cosyvoice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+type uploadVoiceResponse struct {
+	URI string `json:"uri"`
+}
+
+// UploadVoice clones a voice from reference audio of a few seconds and its
+// transcript, the returned URI is used as voice of NewTts
+func (t *Tts) UploadVoice(ctx context.Context, name, text string, audio []byte, filename string) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("model", TTSModel)
+	w.WriteField("customName", name)
+	w.WriteField("text", text)
+
+	fw, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create voice upload")
+	}
+	fw.Write(audio)
+	if err := w.Close(); err != nil {
+		return "", errors.Wrap(err, "failed to create voice upload")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+uploadVoicePath, &body)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create voice upload")
+	}
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to upload voice")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp)
+	}
+
+	var uploaded uploadVoiceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return "", errors.Wrap(err, "failed to decode voice upload response")
+	}
+
+	if len(uploaded.URI) == 0 {
+		return "", errors.New("voice upload returned no URI")
+	}
+
+	return uploaded.URI, nil
+}
+
+// DeleteVoice removes a custom voice from the service
+func (t *Tts) DeleteVoice(ctx context.Context, uri string) error {
+	data, _ := json.Marshal(map[string]string{"uri": uri})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+deleteVoicePath, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create voice deletion")
+	}
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete voice")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+
+	return nil
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("TTS request failed with status code: %d, %s", resp.StatusCode, string(body))
+}
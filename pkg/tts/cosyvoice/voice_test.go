@@ -0,0 +1,98 @@
+package cosyvoice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoiceURI(t *testing.T) {
+	assert.Equal(t, TTSModel+":"+DefaultVoice, VoiceURI(""))
+	assert.Equal(t, TTSModel+":anna", VoiceURI("anna"))
+	assert.Equal(t, "speech:mama:abc:def", VoiceURI("speech:mama:abc:def"))
+	assert.Equal(t, TTSModel+":"+DefaultVoice, VoiceURI("benjimin"))
+}
+
+func TestNormalizeBaseURL(t *testing.T) {
+	assert.Equal(t, DefaultBaseURL, normalizeBaseURL(""))
+	assert.Equal(t, "http://127.0.0.1:8000", normalizeBaseURL("http://127.0.0.1:8000/"))
+	assert.Equal(t, "http://127.0.0.1:8000", normalizeBaseURL("http://127.0.0.1:8000/v1"))
+	assert.Equal(t, "http://127.0.0.1:8000", normalizeBaseURL("http://127.0.0.1:8000/v1/audio/speech"))
+}
+
+func TestUploadAndDeleteVoice(t *testing.T) {
+	var deleted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+
+		switch r.URL.Path {
+		case uploadVoicePath:
+			assert.Equal(t, TTSModel, r.FormValue("model"))
+			assert.Equal(t, "mama", r.FormValue("customName"))
+			assert.Equal(t, "今天天气真好", r.FormValue("text"))
+			f, _, err := r.FormFile("file")
+			assert.NoError(t, err)
+			audio, _ := io.ReadAll(f)
+			assert.Equal(t, "RIFF", string(audio))
+			w.Write([]byte(`{"uri":"speech:mama:abc:def"}`))
+		case deleteVoicePath:
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			deleted = req["uri"]
+		case speechPath:
+			var req map[string]any
+			json.NewDecoder(r.Body).Decode(&req)
+			assert.Equal(t, "speech:mama:abc:def", req["voice"])
+			w.Write([]byte("pcm"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewTts("key", srv.URL+"/v1", "")
+	uri, err := client.UploadVoice(context.Background(), "mama", "今天天气真好", []byte("RIFF"), "mama.wav")
+	assert.NoError(t, err)
+	assert.Equal(t, "speech:mama:abc:def", uri)
+
+	pcm, err := NewTts("key", srv.URL, uri).GenerateAudio(context.Background(), "你好", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "pcm", string(pcm))
+
+	assert.NoError(t, client.DeleteVoice(context.Background(), uri))
+	assert.Equal(t, uri, deleted)
+}
+
+func TestStreamAudioWith(t *testing.T) {
+	var req map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte{0xe8, 0x03}) // 1000
+	}))
+	defer srv.Close()
+
+	client := NewTts("key", srv.URL, "")
+	pcm, err := client.StreamAudioWith(context.Background(), "你好", tts.Options{Rate: 0.8, Gain: -4})
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(pcm)
+	pcm.Close()
+	assert.Equal(t, []byte{0xe8, 0x03}, data)
+	assert.InDelta(t, 0.8, req["speed"], 0.001)
+	assert.InDelta(t, -4, req["gain"], 0.001)
+
+	// the service accepts up to -10dB, the rest is applied to the PCM
+	pcm, err = client.StreamAudioWith(context.Background(), "你好", tts.Options{Gain: -16.0206})
+	assert.NoError(t, err)
+	data, _ = io.ReadAll(pcm)
+	pcm.Close()
+	assert.Equal(t, []byte{0xf4, 0x01}, data) // 1000 halved by the remaining 6dB
+	assert.InDelta(t, 1, req["speed"], 0.001)
+	assert.InDelta(t, -10, req["gain"], 0.001)
+}
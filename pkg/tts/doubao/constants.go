@@ -0,0 +1,62 @@
+package doubao
+
+// https://www.volcengine.com/docs/6561/1329505
+const (
+	DoubaoBidirectionTtsEndpoint = "wss://openspeech.bytedance.com/api/v3/tts/bidirection"
+	DoubaoResourceId             = "volc.service_type.10029" // 大模型语音合成
+	DoubaoNamespace              = "BidirectionalTTS"
+	DefaultSpeaker               = "zh_female_shuangkuaisisi_moon_bigtts"
+)
+
+// 协议版本和头部大小（单位 4 字节）
+const (
+	ProtocolVersion = byte(0b0001)
+	HeaderSize      = byte(0b0001)
+)
+
+// 包类型
+const (
+	MessageTypeFullClientRequest  = byte(0b0001)
+	MessageTypeFullServerResponse = byte(0b1001)
+	MessageTypeAudioOnlyResponse  = byte(0b1011)
+	MessageTypeError              = byte(0b1111)
+)
+
+// 标志位，携带事件编号
+const FlagWithEvent = byte(0b0100)
+
+// Serialization Method
+const (
+	SerializationNone = byte(0b0000)
+	SerializationJson = byte(0b0001)
+)
+
+const CompressionNone = byte(0b0000)
+
+type Event int32
+
+// 事件编号
+const (
+	EventStartConnection    Event = 1
+	EventFinishConnection   Event = 2
+	EventConnectionStarted  Event = 50
+	EventConnectionFailed   Event = 51
+	EventConnectionFinished Event = 52
+
+	EventStartSession    Event = 100
+	EventFinishSession   Event = 102
+	EventSessionStarted  Event = 150
+	EventSessionFinished Event = 152
+	EventSessionFailed   Event = 153
+
+	EventTaskRequest      Event = 200
+	EventTTSSentenceStart Event = 350
+	EventTTSSentenceEnd   Event = 351
+	EventTTSResponse      Event = 352
+)
+
+// hasId reports whether frames of the event carry an id, the connection id of
+// connection events sent by the server or the session id of session events
+func (e Event) hasId() bool {
+	return e != EventStartConnection && e != EventFinishConnection
+}
@@ -0,0 +1,321 @@
+package doubao
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type TtsDoubaoConfig struct {
+	Endpoint   string // websocket endpoint, empty uses DoubaoBidirectionTtsEndpoint
+	AppId      string // X-Api-App-Key
+	AccessKey  string // X-Api-Access-Key
+	ResourceId string // X-Api-Resource-Id, empty uses DoubaoResourceId
+	Speaker    string // voice, empty uses DefaultSpeaker
+	Uid        string // user reported to the service
+}
+
+// Tts is the Volcengine/Doubao bidirectional streaming TTS, every synthesis
+// runs in its own connection and session, audio is delivered as it arrives
+type Tts struct {
+	cfg    TtsDoubaoConfig
+	dialer websocket.Dialer
+}
+
+type sessionUser struct {
+	Uid string `json:"uid"`
+}
+
+type sessionAudioParams struct {
+	Format       string `json:"format"`        // pcm / mp3 / ogg_opus
+	SampleRate   int    `json:"sample_rate"`   // 16000
+	SpeechRate   int    `json:"speech_rate"`   // -50 ~ 100, 0 is normal
+	LoudnessRate int    `json:"loudness_rate"` // -50 ~ 100, 0 is normal
+}
+
+type sessionPostProcess struct {
+	Pitch int `json:"pitch"` // -12 ~ 12 semitones
+}
+
+type sessionAdditions struct {
+	PostProcess *sessionPostProcess `json:"post_process,omitempty"`
+}
+
+type sessionReqParams struct {
+	Text        string             `json:"text,omitempty"`
+	Speaker     string             `json:"speaker"`
+	AudioParams sessionAudioParams `json:"audio_params"`
+	Additions   string             `json:"additions,omitempty"` // JSON of sessionAdditions
+}
+
+type sessionPayload struct {
+	User      sessionUser      `json:"user"`
+	Event     Event            `json:"event"`
+	Namespace string           `json:"namespace"`
+	ReqParams sessionReqParams `json:"req_params"`
+}
+
+type failurePayload struct {
+	StatusCode int    `json:"status_code"`
+	Message    string `json:"message"`
+}
+
+func NewTts(cfg TtsDoubaoConfig) *Tts {
+	if len(cfg.Endpoint) == 0 {
+		cfg.Endpoint = DoubaoBidirectionTtsEndpoint
+	}
+	if len(cfg.ResourceId) == 0 {
+		cfg.ResourceId = DoubaoResourceId
+	}
+	if len(cfg.Speaker) == 0 {
+		cfg.Speaker = DefaultSpeaker
+	}
+	if len(cfg.Uid) == 0 {
+		cfg.Uid = "xiaozhi"
+	}
+
+	return &Tts{
+		cfg: cfg,
+		dialer: websocket.Dialer{
+			HandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (t *Tts) GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error) {
+	body, err := t.StreamAudio(ctx, text, speed)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	pcm, err := io.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read TTS audio")
+	}
+
+	return pcm, nil
+}
+
+// StreamAudio returns the PCM as the service synthesizes it, closing it or
+// cancelling ctx closes the connection
+func (t *Tts) StreamAudio(ctx context.Context, text string, speed float32) (io.ReadCloser, error) {
+	return t.StreamAudioWith(ctx, text, tts.Options{Rate: speed})
+}
+
+// Tunes reports that both gain and pitch are applied by the service
+func (t *Tts) Tunes() (bool, bool) {
+	return true, true
+}
+
+// StreamAudioWith is StreamAudio with gain and pitch, the part of gain beyond
+// the loudness rate of the service is applied to the PCM
+func (t *Tts) StreamAudioWith(ctx context.Context, text string, opts tts.Options) (io.ReadCloser, error) {
+	headers := http.Header{}
+	headers.Set("X-Api-App-Key", t.cfg.AppId)
+	headers.Set("X-Api-Access-Key", t.cfg.AccessKey)
+	headers.Set("X-Api-Resource-Id", t.cfg.ResourceId)
+	headers.Set("X-Api-Connect-Id", uuid.New().String())
+
+	conn, resp, err := t.dialer.DialContext(ctx, t.cfg.Endpoint, headers)
+	if err != nil {
+		if resp != nil {
+			return nil, errors.Wrapf(err, "failed to dial doubao TTS, status code %d", resp.StatusCode)
+		}
+		return nil, errors.Wrap(err, "failed to dial doubao TTS")
+	}
+
+	sessionId := uuid.New().String()
+	loudness := loudnessRate(opts.Gain)
+	if err := t.startSession(conn, sessionId, text, opts, loudness); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	go func() {
+		defer close(done)
+		defer conn.Close()
+		w.CloseWithError(t.receiveAudio(conn, w))
+	}()
+
+	// the loudness rate is a ratio of the amplitude
+	if rest := opts.Gain - float32(20*math.Log10(1+float64(loudness)/100)); math.Abs(float64(rest)) > 0.1 {
+		return utils.NewGainReader(r, rest), nil
+	}
+
+	return r, nil
+}
+
+// startSession opens the connection and a session, then sends the whole text
+// and finishes the session right away since it is a single sentence
+func (t *Tts) startSession(conn *websocket.Conn, sessionId string, text string, opts tts.Options, loudness int) error {
+	if err := writeEvent(conn, EventStartConnection, "", []byte("{}")); err != nil {
+		return err
+	}
+	if _, err := expectEvent(conn, EventConnectionStarted); err != nil {
+		return err
+	}
+
+	payload := sessionPayload{
+		User:      sessionUser{Uid: t.cfg.Uid},
+		Event:     EventStartSession,
+		Namespace: DoubaoNamespace,
+		ReqParams: sessionReqParams{
+			Speaker: t.cfg.Speaker,
+			AudioParams: sessionAudioParams{
+				Format:       "pcm",
+				SampleRate:   tts.SampleRate,
+				SpeechRate:   speechRate(opts.Speed()),
+				LoudnessRate: loudness,
+			},
+		},
+	}
+	if pitch := int(math.Round(float64(opts.Pitch))); pitch != 0 {
+		additions, err := json.Marshal(sessionAdditions{PostProcess: &sessionPostProcess{Pitch: pitch}})
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal additions")
+		}
+		payload.ReqParams.Additions = string(additions)
+	}
+	if err := writeJsonEvent(conn, EventStartSession, sessionId, payload); err != nil {
+		return err
+	}
+	if _, err := expectEvent(conn, EventSessionStarted); err != nil {
+		return err
+	}
+
+	payload.Event = EventTaskRequest
+	payload.ReqParams.Text = text
+	if err := writeJsonEvent(conn, EventTaskRequest, sessionId, payload); err != nil {
+		return err
+	}
+
+	return writeEvent(conn, EventFinishSession, sessionId, []byte("{}"))
+}
+
+// receiveAudio writes the audio of the session to w until it is finished
+func (t *Tts) receiveAudio(conn *websocket.Conn, w io.Writer) error {
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			return err
+		}
+
+		switch f.Event {
+		case EventTTSResponse:
+			if _, err := w.Write(f.Payload); err != nil {
+				return err
+			}
+
+		case EventSessionFinished:
+			if err := writeEvent(conn, EventFinishConnection, "", []byte("{}")); err != nil {
+				log.Debug().Err(err).Msg("Failed to finish doubao TTS connection")
+			}
+			return nil
+
+		case EventTTSSentenceStart, EventTTSSentenceEnd:
+		default:
+			log.Debug().Msgf("Unexpected doubao TTS event %d: %s", f.Event, string(f.Payload))
+		}
+	}
+}
+
+func writeEvent(conn *websocket.Conn, event Event, id string, payload []byte) error {
+	f := &Frame{
+		MessageType:   MessageTypeFullClientRequest,
+		Flags:         FlagWithEvent,
+		Serialization: SerializationJson,
+		Event:         event,
+		Id:            id,
+		Payload:       payload,
+	}
+
+	return errors.Wrapf(conn.WriteMessage(websocket.BinaryMessage, f.Marshal()), "failed to send event %d", event)
+}
+
+func writeJsonEvent(conn *websocket.Conn, event Event, id string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal event %d", event)
+	}
+
+	return writeEvent(conn, event, id, data)
+}
+
+// readFrame reads the next frame, failures reported by the service are
+// returned as errors
+func readFrame(conn *websocket.Conn) (*Frame, error) {
+	mt, raw, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	if mt != websocket.BinaryMessage {
+		return nil, errors.New("expected binary message, got text message")
+	}
+
+	f, err := ParseFrame(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.MessageType == MessageTypeError {
+		return nil, errors.Errorf("server error: code %d, message: %s", f.ErrorCode, string(f.Payload))
+	}
+
+	if f.Event == EventConnectionFailed || f.Event == EventSessionFailed {
+		var failure failurePayload
+		json.Unmarshal(f.Payload, &failure)
+		return nil, errors.Errorf("event %d: code %d, message: %s", f.Event, failure.StatusCode, failure.Message)
+	}
+
+	return f, nil
+}
+
+func expectEvent(conn *websocket.Conn, event Event) (*Frame, error) {
+	f, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Event != event {
+		return nil, errors.Errorf("expected event %d, got %d", event, f.Event)
+	}
+
+	return f, nil
+}
+
+// speechRate maps the speed ratio to the speech rate of doubao, 2x is 100
+// and 0.5x is -50
+func speechRate(speed float32) int {
+	rate := int((speed - 1) * 100)
+	return max(-50, min(100, rate))
+}
+
+// loudnessRate maps gain in dB to the loudness rate of doubao, which scales
+// the amplitude, +6dB is 100 and -6dB is -50
+func loudnessRate(gain float32) int {
+	rate := int(math.Round((math.Pow(10, float64(gain)/20) - 1) * 100))
+	return max(-50, min(100, rate))
+}
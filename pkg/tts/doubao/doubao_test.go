@@ -0,0 +1,134 @@
+package doubao
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	f := &Frame{
+		MessageType:   MessageTypeAudioOnlyResponse,
+		Flags:         FlagWithEvent,
+		Serialization: SerializationNone,
+		Event:         EventTTSResponse,
+		Id:            "session-1",
+		Payload:       []byte{1, 2, 3},
+	}
+
+	parsed, err := ParseFrame(f.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, f, parsed)
+
+	// frames of StartConnection carry no id
+	raw := (&Frame{MessageType: MessageTypeFullClientRequest, Flags: FlagWithEvent, Event: EventStartConnection, Payload: []byte("{}")}).Marshal()
+	assert.Len(t, raw, 4+4+4+2)
+
+	_, err = ParseFrame(raw[:10])
+	assert.Error(t, err)
+}
+
+// standInServer speaks the bidirectional protocol, answering every task with
+// the text as audio in two chunks
+func standInServer(t *testing.T, fail bool) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "app", r.Header.Get("X-Api-App-Key"))
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		send := func(mt byte, event Event, id string, payload []byte) {
+			f := &Frame{MessageType: mt, Flags: FlagWithEvent, Serialization: SerializationJson, Event: event, Id: id, Payload: payload}
+			conn.WriteMessage(websocket.BinaryMessage, f.Marshal())
+		}
+
+		for {
+			_, raw, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			f, err := ParseFrame(raw)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			switch f.Event {
+			case EventStartConnection:
+				send(MessageTypeFullServerResponse, EventConnectionStarted, "conn-1", []byte("{}"))
+			case EventStartSession:
+				if fail {
+					send(MessageTypeFullServerResponse, EventSessionFailed, f.Id, []byte(`{"status_code":45000000,"message":"speaker not found"}`))
+					continue
+				}
+				send(MessageTypeFullServerResponse, EventSessionStarted, f.Id, []byte("{}"))
+			case EventTaskRequest:
+				var payload sessionPayload
+				json.Unmarshal(f.Payload, &payload)
+				assert.Equal(t, "speaker", payload.ReqParams.Speaker)
+				assert.Equal(t, 16000, payload.ReqParams.AudioParams.SampleRate)
+
+				audio := []byte(payload.ReqParams.Text)
+				send(MessageTypeFullServerResponse, EventTTSSentenceStart, f.Id, []byte("{}"))
+				send(MessageTypeAudioOnlyResponse, EventTTSResponse, f.Id, audio[:3])
+				send(MessageTypeAudioOnlyResponse, EventTTSResponse, f.Id, audio[3:])
+				send(MessageTypeFullServerResponse, EventTTSSentenceEnd, f.Id, []byte("{}"))
+			case EventFinishSession:
+				send(MessageTypeFullServerResponse, EventSessionFinished, f.Id, []byte("{}"))
+			case EventFinishConnection:
+				send(MessageTypeFullServerResponse, EventConnectionFinished, "conn-1", []byte("{}"))
+				return
+			}
+		}
+	}))
+}
+
+func TestGenerateAudio(t *testing.T) {
+	srv := standInServer(t, false)
+	defer srv.Close()
+
+	tts := NewTts(TtsDoubaoConfig{
+		Endpoint: "ws" + strings.TrimPrefix(srv.URL, "http"),
+		AppId:    "app",
+		Speaker:  "speaker",
+	})
+
+	pcm, err := tts.GenerateAudio(context.Background(), "你好世界", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "你好世界", string(pcm))
+}
+
+func TestGenerateAudioFailure(t *testing.T) {
+	srv := standInServer(t, true)
+	defer srv.Close()
+
+	tts := NewTts(TtsDoubaoConfig{
+		Endpoint: "ws" + strings.TrimPrefix(srv.URL, "http"),
+		AppId:    "app",
+	})
+
+	_, err := tts.GenerateAudio(context.Background(), "你好", 1)
+	assert.ErrorContains(t, err, "speaker not found")
+}
+
+func TestSpeechRate(t *testing.T) {
+	assert.Equal(t, 0, speechRate(1))
+	assert.Equal(t, 100, speechRate(2))
+	assert.Equal(t, -50, speechRate(0.5))
+	assert.Equal(t, 100, speechRate(3))
+}
+
+func TestLoudnessRate(t *testing.T) {
+	assert.Equal(t, 0, loudnessRate(0))
+	assert.Equal(t, 100, loudnessRate(6.0206))
+	assert.Equal(t, -50, loudnessRate(-6.0206))
+	assert.Equal(t, -50, loudnessRate(-20))
+}
@@ -0,0 +1,107 @@
+package doubao
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// Frame is a binary message of the bidirectional TTS protocol
+//
+//	header (4 bytes) | event (4 bytes) | id size (4 bytes) | id | payload size (4 bytes) | payload
+//
+// error frames carry an error code instead of the event and the id
+type Frame struct {
+	MessageType   byte
+	Flags         byte
+	Serialization byte
+	Event         Event
+	Id            string // session id, or connection id of connection events
+	ErrorCode     uint32 // code of error frames
+	Payload       []byte
+}
+
+func (f *Frame) Marshal() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(ProtocolVersion<<4 | HeaderSize)
+	buf.WriteByte(f.MessageType<<4 | f.Flags)
+	buf.WriteByte(f.Serialization<<4 | CompressionNone)
+	buf.WriteByte(0) // reserved
+
+	if f.MessageType == MessageTypeError {
+		binary.Write(&buf, binary.BigEndian, f.ErrorCode)
+	} else if f.Flags&FlagWithEvent != 0 {
+		binary.Write(&buf, binary.BigEndian, int32(f.Event))
+		if f.Event.hasId() {
+			binary.Write(&buf, binary.BigEndian, uint32(len(f.Id)))
+			buf.WriteString(f.Id)
+		}
+	}
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(f.Payload)))
+	buf.Write(f.Payload)
+
+	return buf.Bytes()
+}
+
+func ParseFrame(raw []byte) (*Frame, error) {
+	if len(raw) < 4 {
+		return nil, errors.New("message too short, expected at least 4 bytes")
+	}
+
+	headerSize := int(raw[0]&0x0F) * 4
+	if headerSize < 4 || len(raw) < headerSize {
+		return nil, errors.Errorf("invalid header size %d", headerSize)
+	}
+
+	f := &Frame{
+		MessageType:   raw[1] >> 4,
+		Flags:         raw[1] & 0x0F,
+		Serialization: raw[2] >> 4,
+	}
+
+	r := bytes.NewReader(raw[headerSize:])
+	if f.MessageType == MessageTypeError {
+		if err := binary.Read(r, binary.BigEndian, &f.ErrorCode); err != nil {
+			return nil, errors.Wrap(err, "failed to read error code")
+		}
+	} else if f.Flags&FlagWithEvent != 0 {
+		var event int32
+		if err := binary.Read(r, binary.BigEndian, &event); err != nil {
+			return nil, errors.Wrap(err, "failed to read event")
+		}
+		f.Event = Event(event)
+
+		if f.Event.hasId() {
+			id, err := readSized(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read id")
+			}
+			f.Id = string(id)
+		}
+	}
+
+	payload, err := readSized(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read payload")
+	}
+	f.Payload = payload
+
+	return f, nil
+}
+
+func readSized(r *bytes.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+
+	if int(size) > r.Len() {
+		return nil, errors.Errorf("size %d exceeds the remaining %d bytes", size, r.Len())
+	}
+
+	data := make([]byte, size)
+	r.Read(data)
+	return data, nil
+}
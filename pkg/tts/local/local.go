@@ -0,0 +1,292 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FormatPCM = "pcm" // raw 16-bit little endian mono
+	FormatWAV = "wav"
+)
+
+type LocalTtsConfig struct {
+	Command    string        // executable, e.g. piper
+	Args       []string      // e.g. --model zh_CN-huayan-medium.onnx --output-raw
+	Env        []string      // extra environment, e.g. ESPEAK_DATA_PATH=/usr/share
+	Format     string        // pcm or wav written to stdout
+	SampleRate int           // sample rate of pcm, the header of wav wins
+	Workers    int           // processes started ahead and waiting for text
+	Timeout    time.Duration // timeout of a sentence, 0 means unlimited
+}
+
+// Tts runs a local engine such as piper, espeak-ng or sherpa-onnx for every
+// sentence, the text is written to stdin and the audio read from stdout.
+// Engines load their model before reading stdin, so processes are started
+// ahead and kept warm to hide the loading time.
+type Tts struct {
+	cfg LocalTtsConfig
+
+	warm     chan *process
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *os.File
+	stderr *bytes.Buffer
+	exited chan struct{} // closed when the process exits
+	err    error         // exit error, valid once exited is closed
+}
+
+func NewTts(cfg LocalTtsConfig) (*Tts, error) {
+	if len(cfg.Command) == 0 {
+		return nil, errors.New("command of local TTS is empty")
+	}
+
+	if _, err := exec.LookPath(cfg.Command); err != nil {
+		return nil, errors.Wrapf(err, "command %s of local TTS is not found", cfg.Command)
+	}
+
+	switch cfg.Format {
+	case "":
+		cfg.Format = FormatPCM
+	case FormatPCM, FormatWAV:
+	default:
+		return nil, errors.Errorf("unknown output format %s of local TTS", cfg.Format)
+	}
+
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = tts.SampleRate
+	}
+
+	t := &Tts{
+		cfg:  cfg,
+		warm: make(chan *process, max(cfg.Workers, 0)),
+		done: make(chan struct{}),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		go t.refill()
+	}
+
+	return t, nil
+}
+
+func (t *Tts) GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error) {
+	body, err := t.StreamAudio(ctx, text, speed)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	pcm, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return pcm, nil
+}
+
+// StreamAudio returns the PCM converted to tts.SampleRate as the engine writes
+// it, speed is ignored since engines take it as a command line argument
+func (t *Tts) StreamAudio(ctx context.Context, text string, speed float32) (io.ReadCloser, error) {
+	p, err := t.take()
+	if err != nil {
+		return nil, err
+	}
+
+	var cancel context.CancelFunc = func() {}
+	if t.cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.cfg.Timeout)
+	}
+
+	// the process is killed when the sentence times out or is aborted
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.kill()
+		case <-p.exited:
+		}
+	}()
+
+	// engines such as piper read a sentence per line
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\n", " ")
+	if _, err := io.WriteString(p.stdin, text+"\n"); err != nil {
+		cancel()
+		p.kill()
+		return nil, errors.Wrap(err, "failed to write text to local TTS")
+	}
+	p.stdin.Close()
+
+	out := &output{p: p, ctx: ctx, cancel: cancel}
+	sampleRate := t.cfg.SampleRate
+	if t.cfg.Format == FormatWAV {
+		format, err := utils.ReadWavHeader(out)
+		if err != nil {
+			out.Close()
+			return nil, errors.Wrap(err, "failed to read WAV of local TTS")
+		}
+
+		if format.AudioFormat != 1 || format.Channels != 1 || format.BitsPerSample != 16 {
+			out.Close()
+			return nil, errors.Errorf("local TTS writes %d channels of %d bits, only 16 bits mono PCM is supported",
+				format.Channels, format.BitsPerSample)
+		}
+		sampleRate = int(format.SampleRate)
+	}
+
+	return utils.NewResampleReader(out, sampleRate, tts.SampleRate), nil
+}
+
+// Close stops the warm processes
+func (t *Tts) Close() error {
+	t.stopOnce.Do(func() {
+		close(t.done)
+	})
+
+	for {
+		select {
+		case p := <-t.warm:
+			p.kill()
+		default:
+			return nil
+		}
+	}
+}
+
+// take returns a warm process if any, a new one is started otherwise
+func (t *Tts) take() (*process, error) {
+	for {
+		select {
+		case p := <-t.warm:
+			go t.refill()
+
+			select {
+			case <-p.exited:
+				log.Error().Err(p.err).Msgf("Local TTS %s exited while idle: %s", t.cfg.Command, p.stderr.String())
+				continue
+			default:
+				return p, nil
+			}
+		default:
+			return t.start()
+		}
+	}
+}
+
+// refill starts a process waiting in the pool
+func (t *Tts) refill() {
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+
+	p, err := t.start()
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to start local TTS %s", t.cfg.Command)
+		return
+	}
+
+	select {
+	case t.warm <- p:
+	case <-t.done:
+		p.kill()
+	}
+}
+
+func (t *Tts) start() (*process, error) {
+	cmd := exec.Command(t.cfg.Command, t.cfg.Args...)
+	cmd.Env = append(os.Environ(), t.cfg.Env...)
+	cmd.WaitDelay = time.Second // children left behind may hold stderr open
+	setProcessGroup(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// an os pipe rather than StdoutPipe, so waiting for the exit does not
+	// close the audio still to be read
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = w
+
+	p := &process{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: &bytes.Buffer{},
+		exited: make(chan struct{}),
+	}
+	cmd.Stderr = p.stderr
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		stdout.Close()
+		return nil, errors.Wrapf(err, "failed to start %s", t.cfg.Command)
+	}
+
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+
+	return p, nil
+}
+
+func (p *process) kill() {
+	select {
+	case <-p.exited:
+	default:
+		killProcessGroup(p.cmd)
+	}
+}
+
+// output is the stdout of a process, the exit status is reported at the end
+type output struct {
+	p      *process
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (o *output) Read(b []byte) (int, error) {
+	n, err := o.p.stdout.Read(b)
+	if err != io.EOF {
+		return n, err
+	}
+
+	<-o.p.exited
+	if o.ctx.Err() != nil {
+		return n, errors.Wrap(o.ctx.Err(), "local TTS is stopped")
+	}
+	if o.p.err != nil {
+		return n, errors.Wrapf(o.p.err, "local TTS failed: %s", strings.TrimSpace(o.p.stderr.String()))
+	}
+
+	return n, io.EOF
+}
+
+func (o *output) Close() error {
+	o.cancel()
+	o.p.kill()
+	return o.p.stdout.Close()
+}
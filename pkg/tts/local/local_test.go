@@ -0,0 +1,107 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// script writes a shell script standing in for an engine
+func script(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "engine.sh")
+	assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755))
+	return path
+}
+
+func TestLocalPCM(t *testing.T) {
+	// echoes the text as audio
+	engine, err := NewTts(LocalTtsConfig{
+		Command: script(t, `read line; printf '%s' "$line"`),
+		Workers: 2,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	for i := 0; i < 3; i++ {
+		pcm, err := engine.GenerateAudio(context.Background(), "你好\n世界", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "你好 世界", string(pcm))
+	}
+}
+
+func TestLocalWAV(t *testing.T) {
+	// 100ms of 8kHz is resampled to 16kHz
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(0))
+	wav.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(8000), uint32(16000), uint16(2), uint16(16)} {
+		binary.Write(&wav, binary.LittleEndian, v)
+	}
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(1600))
+	wav.Write(make([]byte, 1600))
+
+	wavPath := filepath.Join(t.TempDir(), "out.wav")
+	assert.NoError(t, os.WriteFile(wavPath, wav.Bytes(), 0644))
+
+	engine, err := NewTts(LocalTtsConfig{
+		Command: script(t, `cat > /dev/null; cat "$1"`),
+		Args:    []string{wavPath},
+		Format:  FormatWAV,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	pcm, err := engine.GenerateAudio(context.Background(), "你好", 1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 3200, len(pcm), 4)
+}
+
+func TestLocalWarm(t *testing.T) {
+	// loading the model takes a while before stdin is read
+	engine, err := NewTts(LocalTtsConfig{
+		Command: script(t, `sleep 0.5; read line; printf '%s' "$line"`),
+		Workers: 1,
+	})
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	time.Sleep(800 * time.Millisecond)
+
+	startAt := time.Now()
+	pcm, err := engine.GenerateAudio(context.Background(), "warm", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "warm", string(pcm))
+	assert.Less(t, time.Since(startAt), 400*time.Millisecond, "the warm process is used")
+}
+
+func TestLocalFailures(t *testing.T) {
+	engine, err := NewTts(LocalTtsConfig{
+		Command: script(t, `sleep 5`),
+		Timeout: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	startAt := time.Now()
+	_, err = engine.GenerateAudio(context.Background(), "你好", 1)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(startAt), 2*time.Second)
+
+	engine, err = NewTts(LocalTtsConfig{
+		Command: script(t, `read line; echo "model not found" >&2; exit 1`),
+	})
+	assert.NoError(t, err)
+
+	_, err = engine.GenerateAudio(context.Background(), "你好", 1)
+	assert.ErrorContains(t, err, "model not found")
+
+	_, err = NewTts(LocalTtsConfig{Command: "/not/found"})
+	assert.Error(t, err)
+}
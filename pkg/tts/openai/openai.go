@@ -0,0 +1,117 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultBaseURL    = "https://api.openai.com/v1"
+	DefaultModel      = "tts-1"
+	DefaultVoice      = "alloy"
+	DefaultSampleRate = 24000 // sample rate of the pcm format of OpenAI
+)
+
+type SpeechConfig struct {
+	BaseURL    string        `json:"base_url"`    // ends before /audio/speech, e.g. https://api.openai.com/v1
+	APIKey     string        `json:"api_key"`     // sent as bearer token
+	Model      string        `json:"model"`       // e.g. tts-1
+	Voice      string        `json:"voice"`       // e.g. alloy
+	SampleRate int           `json:"sample_rate"` // sample rate of the returned pcm, converted to tts.SampleRate
+	Timeout    time.Duration `json:"timeout"`     // timeout of a request, the audio included
+}
+
+// Speech is any TTS compatible with the OpenAI /v1/audio/speech API, e.g.
+// OpenAI, SiliconFlow, LocalAI or openedai-speech
+type Speech struct {
+	cfg    SpeechConfig
+	client *http.Client
+}
+
+func NewSpeech(cfg SpeechConfig) *Speech {
+	if len(cfg.BaseURL) == 0 {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if len(cfg.Model) == 0 {
+		cfg.Model = DefaultModel
+	}
+	if len(cfg.Voice) == 0 {
+		cfg.Voice = DefaultVoice
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = DefaultSampleRate
+	}
+
+	return &Speech{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (s *Speech) GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error) {
+	body, err := s.StreamAudio(ctx, text, speed)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	pcm, err := io.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read TTS response body")
+	}
+
+	return pcm, nil
+}
+
+// StreamAudio returns the PCM converted to tts.SampleRate as it arrives
+func (s *Speech) StreamAudio(ctx context.Context, text string, speed float32) (io.ReadCloser, error) {
+	data := map[string]interface{}{
+		"model":           s.cfg.Model,
+		"input":           text,
+		"voice":           s.cfg.Voice,
+		"response_format": "pcm",
+		"speed":           speed,
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal TTS request data")
+	}
+
+	req, err := http.NewRequestWithContext(ctx,
+		http.MethodPost,
+		strings.TrimSuffix(s.cfg.BaseURL, "/")+"/audio/speech",
+		bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create TTS request")
+	}
+
+	if len(s.cfg.APIKey) != 0 {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send TTS request")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("TTS request failed with status code: %d, %s", resp.StatusCode, string(body))
+	}
+
+	return utils.NewResampleReader(resp.Body, s.cfg.SampleRate, tts.SampleRate), nil
+}
@@ -0,0 +1,54 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpeech(t *testing.T) {
+	var request map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/audio/speech", r.URL.Path)
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write(make([]byte, 3200)) // 100ms of 16kHz
+	}))
+	defer srv.Close()
+
+	s := NewSpeech(SpeechConfig{BaseURL: srv.URL + "/v1", APIKey: "key", SampleRate: 16000})
+	pcm, err := s.GenerateAudio(context.Background(), "你好", 1)
+	assert.NoError(t, err)
+	assert.Len(t, pcm, 3200)
+
+	assert.Equal(t, "你好", request["input"])
+	assert.Equal(t, DefaultModel, request["model"])
+	assert.Equal(t, DefaultVoice, request["voice"])
+	assert.Equal(t, "pcm", request["response_format"])
+}
+
+func TestSpeechResamples(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 4800)) // 100ms of 24kHz
+	}))
+	defer srv.Close()
+
+	s := NewSpeech(SpeechConfig{BaseURL: srv.URL})
+	pcm, err := s.GenerateAudio(context.Background(), "你好", 1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 3200, len(pcm), 4)
+}
+
+func TestSpeechFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid voice", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	_, err := NewSpeech(SpeechConfig{BaseURL: srv.URL}).GenerateAudio(context.Background(), "你好", 1)
+	assert.ErrorContains(t, err, "invalid voice")
+}
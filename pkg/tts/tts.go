@@ -1,6 +1,15 @@
 package tts
 
-import "context"
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+)
+
+// SampleRate of the PCM returned by providers, 16-bit little endian mono
+const SampleRate = 16000
 
 type TTSResponse struct {
 	IsStart bool   `json:"is_start"` // Indicates if this is the start of a TTS response
@@ -13,3 +22,93 @@ type TTSResponse struct {
 type TTS interface {
 	GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error)
 }
+
+// StreamTTS is implemented by providers able to deliver PCM while it is being
+// synthesized, so playback starts before the whole sentence is ready
+type StreamTTS interface {
+	TTS
+	StreamAudio(ctx context.Context, text string, speed float32) (io.ReadCloser, error)
+}
+
+// limits of Options
+const (
+	MinRate  float32 = 0.5
+	MaxRate  float32 = 2
+	MinGain  float32 = -20
+	MaxGain  float32 = 10
+	MinPitch float32 = -12
+	MaxPitch float32 = 12
+)
+
+// Options tune the speech of a device, the zero value speaks as the voice does
+type Options struct {
+	Rate  float32 `json:"rate"`  // speech rate, 1 or 0 is normal, e.g. 0.8 for elderly users
+	Gain  float32 `json:"gain"`  // volume in dB, negative is quieter
+	Pitch float32 `json:"pitch"` // in semitones, 0 keeps the pitch of the voice
+}
+
+// Speed is the speed passed to GenerateAudio and StreamAudio
+func (o Options) Speed() float32 {
+	if o.Rate <= 0 {
+		return 1
+	}
+	return o.Rate
+}
+
+// Clamp limits the options to what providers accept
+func (o Options) Clamp() Options {
+	if o.Rate != 0 {
+		o.Rate = max(MinRate, min(MaxRate, o.Rate))
+	}
+	o.Gain = max(MinGain, min(MaxGain, o.Gain))
+	o.Pitch = max(MinPitch, min(MaxPitch, o.Pitch))
+	return o
+}
+
+// TunableTTS is implemented by providers applying gain or pitch themselves
+type TunableTTS interface {
+	StreamTTS
+	// Tunes reports which of gain and pitch the provider applies
+	Tunes() (gain bool, pitch bool)
+	StreamAudioWith(ctx context.Context, text string, opts Options) (io.ReadCloser, error)
+}
+
+// Stream returns the PCM of text spoken with opts as a reader, the audio of
+// providers not supporting streaming is generated at once. Gain is applied to
+// the PCM if the provider can not apply it, pitch is left as is.
+func Stream(ctx context.Context, t TTS, text string, opts Options) (io.ReadCloser, error) {
+	var (
+		pcm  io.ReadCloser
+		err  error
+		gain = opts.Gain // applied to the PCM
+	)
+
+	switch p := t.(type) {
+	case TunableTTS:
+		tunesGain, tunesPitch := p.Tunes()
+		if tunesGain {
+			gain = 0
+		} else {
+			opts.Gain = 0
+		}
+		if !tunesPitch {
+			opts.Pitch = 0
+		}
+		pcm, err = p.StreamAudioWith(ctx, text, opts)
+	case StreamTTS:
+		pcm, err = p.StreamAudio(ctx, text, opts.Speed())
+	default:
+		var data []byte
+		data, err = t.GenerateAudio(ctx, text, opts.Speed())
+		pcm = io.NopCloser(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if gain != 0 {
+		pcm = utils.NewGainReader(pcm, gain)
+	}
+
+	return pcm, nil
+}
@@ -0,0 +1,15 @@
+package types
+
+import "time"
+
+// Turn is one question and answer exchanged with a device
+type Turn struct {
+	DeviceId   string    `json:"device_id"`   // 设备 ID
+	SessionId  string    `json:"session_id"`  // 会话 ID
+	Question   string    `json:"question"`    // ASR 识别文本
+	Answer     string    `json:"answer"`      // LLM 回答
+	AskedAt    time.Time `json:"asked_at"`    // 提问时间
+	AnsweredAt time.Time `json:"answered_at"` // 回答时间
+
+	ConversationId string `json:"conversation_id,omitempty"` // 智能体平台的远端会话 ID
+}
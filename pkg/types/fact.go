@@ -0,0 +1,13 @@
+package types
+
+import "time"
+
+// Fact is a durable piece of knowledge about the user of a device, e.g. the
+// name or an allergy, remembered across sessions
+type Fact struct {
+	Id        string    `json:"id"`
+	DeviceId  string    `json:"device_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
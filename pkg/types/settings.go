@@ -0,0 +1,17 @@
+package types
+
+import "time"
+
+// DeviceSettings overrides the defaults of a device, managed through the web UI
+type DeviceSettings struct {
+	DeviceId  string    `json:"device_id"`
+	Persona   string    `json:"persona"`    // persona of the device, empty uses the default persona
+	Profile   string    `json:"profile"`    // LLM profile of the device, empty uses the one of the persona
+	Knowledge []string  `json:"knowledge"`  // knowledge bases of the device, empty uses the ones of the persona
+	Tts       string    `json:"tts"`        // TTS provider of the device, empty uses the one of the persona
+	Voice     string    `json:"voice"`      // voice of the device, empty uses the one of the persona
+	Rate      float32   `json:"rate"`       // speech rate, 0 is normal, e.g. 0.8 for elderly users
+	Gain      float32   `json:"gain"`       // volume of speech in dB, negative is quieter
+	Pitch     float32   `json:"pitch"`      // pitch of speech in semitones, if the TTS provider supports it
+	UpdatedAt time.Time `json:"updated_at"` // last time the settings were saved
+}
@@ -0,0 +1,13 @@
+package types
+
+import "time"
+
+// Voice is a custom TTS voice cloned from reference audio, it is selected by
+// its name like the preset voices of the provider
+type Voice struct {
+	Name      string    `json:"name"`
+	Provider  string    `json:"provider"` // TTS provider the voice was created with
+	Uri       string    `json:"uri"`      // voice sent to the provider, e.g. speech:name:xxx:yyy
+	Text      string    `json:"text"`     // transcript of the reference audio
+	CreatedAt time.Time `json:"created_at"`
+}
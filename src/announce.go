@@ -0,0 +1,435 @@
+package src
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/media"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// AnnouncementKind is what an announcement makes the device do
+type AnnouncementKind string
+
+const (
+	AnnouncementText  AnnouncementKind = "text"  // spoken with the voice of the device
+	AnnouncementAudio AnnouncementKind = "audio" // pre-recorded asset played as is
+	AnnouncementAlert AnnouncementKind = "alert" // alert shown by the device, nothing is spoken
+)
+
+// DeliveryState is where an announcement is for one device
+type DeliveryState string
+
+const (
+	DeliveryQueued    DeliveryState = "queued"  // waiting for the device to connect
+	DeliveryPending   DeliveryState = "pending" // waiting for the announcements sent before it
+	DeliveryPlaying   DeliveryState = "playing"
+	DeliveryDelivered DeliveryState = "delivered" // played or shown by the device
+	DeliveryFailed    DeliveryState = "failed"
+	DeliveryExpired   DeliveryState = "expired" // queued for too long
+)
+
+var (
+	errDeviceOffline       = errors.New("device is offline")
+	errDeviceDisconnected  = errors.New("device disconnected")
+	errAnnouncementDropped = errors.New("dropped from the queue by newer announcements")
+)
+
+// Announcement is pushed by the server to devices without being asked. It
+// interrupts the conversation of the device and is played after the
+// announcements sent before it.
+type Announcement struct {
+	Kind    AnnouncementKind `json:"kind"`
+	Text    string           `json:"text"`              // spoken text, title of audio or message of alert
+	Asset   string           `json:"asset,omitempty"`   // audio file relative to the asset directory
+	Status  string           `json:"status,omitempty"`  // status of alert
+	Emotion string           `json:"emotion,omitempty"` // emotion of alert
+	Devices []string         `json:"devices,omitempty"` // the connected devices if empty
+	Queue   bool             `json:"queue,omitempty"`   // offline devices get it once they reconnect
+}
+
+// Delivery is the status of an announcement for one device
+type Delivery struct {
+	DeviceId  string        `json:"device_id"`
+	State     DeliveryState `json:"state"`
+	Error     string        `json:"error,omitempty"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// AnnouncementStatus is an announcement and its delivery to every device
+type AnnouncementStatus struct {
+	Id        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Announcement
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+// announcer keeps the status of announcements and those queued for offline
+// devices, the announcements waiting in sessions are guarded by its lock too
+type announcer struct {
+	cfg *config.AnnounceConfig
+
+	mu      sync.Mutex
+	records map[string]*announcement
+	order   []string               // ids of records, oldest first
+	queued  map[string][]*delivery // device id -> announcements waiting for it to connect
+}
+
+type announcement struct {
+	id           string
+	createdAt    time.Time
+	Announcement        // read only once created
+	path         string // asset of audio
+	deliveries   []*delivery
+}
+
+type delivery struct {
+	announcement *announcement
+	status       Delivery
+}
+
+func newAnnouncer(cfg *config.AnnounceConfig) *announcer {
+	if cfg == nil {
+		cfg = &config.AnnounceConfig{}
+	}
+
+	return &announcer{
+		cfg:     cfg,
+		records: make(map[string]*announcement),
+		queued:  make(map[string][]*delivery),
+	}
+}
+
+// Announce sends a to its devices and returns its status, which changes as
+// devices play it. Devices connecting later only get it if a.Queue is set.
+func (h *Hub) Announce(a Announcement) (*AnnouncementStatus, error) {
+	path, err := h.announcer.check(&a)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := a.Devices
+	if len(devices) == 0 {
+		h.sessionMap.Range(func(deviceId string, _ *Session) bool {
+			devices = append(devices, deviceId)
+			return true
+		})
+		sort.Strings(devices)
+	}
+
+	r := &announcement{
+		id:           uuid.New().String(),
+		createdAt:    time.Now(),
+		Announcement: a,
+		path:         path,
+	}
+
+	h.announcer.mu.Lock()
+	defer h.announcer.mu.Unlock()
+
+	h.announcer.add(r)
+	seen := make(map[string]bool)
+	for _, deviceId := range devices {
+		if len(deviceId) == 0 || seen[deviceId] {
+			continue
+		}
+		seen[deviceId] = true
+
+		d := &delivery{announcement: r, status: Delivery{DeviceId: deviceId}}
+		r.deliveries = append(r.deliveries, d)
+
+		s, ok := h.sessionMap.Get(deviceId)
+		switch {
+		case ok && s.announceReady:
+			h.announcer.push(s, d)
+		case a.Queue:
+			h.announcer.enqueue(d)
+		default:
+			d.update(DeliveryFailed, errDeviceOffline)
+		}
+	}
+
+	log.Info().Msgf("Announcement %s of kind %s sent to %d devices", r.id, a.Kind, len(r.deliveries))
+	return r.snapshot(), nil
+}
+
+// Announcement returns the status of the announcement id, false if it is
+// unknown or too old to be kept
+func (h *Hub) Announcement(id string) (*AnnouncementStatus, bool) {
+	h.announcer.mu.Lock()
+	defer h.announcer.mu.Unlock()
+
+	r, ok := h.announcer.records[id]
+	if !ok {
+		return nil, false
+	}
+
+	return r.snapshot(), true
+}
+
+// Announcements returns the status of the announcements kept, newest first
+func (h *Hub) Announcements() []*AnnouncementStatus {
+	h.announcer.mu.Lock()
+	defer h.announcer.mu.Unlock()
+
+	statuses := make([]*AnnouncementStatus, 0, len(h.announcer.order))
+	for i := len(h.announcer.order) - 1; i >= 0; i-- {
+		statuses = append(statuses, h.announcer.records[h.announcer.order[i]].snapshot())
+	}
+
+	return statuses
+}
+
+// check validates a and returns the path of its asset
+func (a *announcer) check(an *Announcement) (string, error) {
+	an.Text = strings.TrimSpace(an.Text)
+
+	switch an.Kind {
+	case AnnouncementText:
+		if len(an.Text) == 0 {
+			return "", errors.New("text of the announcement is empty")
+		}
+		return "", nil
+
+	case AnnouncementAlert:
+		if len(an.Text) == 0 && len(an.Status) == 0 {
+			return "", errors.New("alert has neither status nor message")
+		}
+		return "", nil
+
+	case AnnouncementAudio:
+		asset := filepath.FromSlash(an.Asset)
+		if !filepath.IsLocal(asset) {
+			return "", errors.Errorf("asset %s is not within the asset directory", an.Asset)
+		}
+		if !media.IsSupported(asset) {
+			return "", errors.Wrapf(media.ErrUnsupportedFormat, "asset %s", an.Asset)
+		}
+
+		path := filepath.Join(a.cfg.AssetDir, asset)
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return "", errors.Errorf("asset %s not found", an.Asset)
+		}
+
+		if len(an.Text) == 0 {
+			an.Text = strings.TrimSuffix(filepath.Base(asset), filepath.Ext(asset))
+		}
+		return path, nil
+	}
+
+	return "", errors.Errorf("unknown announcement kind %q", an.Kind)
+}
+
+// add keeps the status of r, the oldest announcements are forgotten
+func (a *announcer) add(r *announcement) {
+	a.records[r.id] = r
+	a.order = append(a.order, r.id)
+
+	for a.cfg.History > 0 && len(a.order) > a.cfg.History {
+		delete(a.records, a.order[0])
+		a.order = a.order[1:]
+	}
+}
+
+// push hands d to the session, which plays it after the ones before it
+func (a *announcer) push(s *Session, d *delivery) {
+	d.update(DeliveryPending, nil)
+	s.announcements = append(s.announcements, d)
+
+	select {
+	case s.announceWake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue keeps d until its device connects
+func (a *announcer) enqueue(d *delivery) {
+	d.update(DeliveryQueued, nil)
+
+	deviceId := d.status.DeviceId
+	a.queued[deviceId] = append(a.queued[deviceId], d)
+	if n := len(a.queued[deviceId]); a.cfg.MaxQueued > 0 && n > a.cfg.MaxQueued {
+		for _, dropped := range a.queued[deviceId][:n-a.cfg.MaxQueued] {
+			dropped.update(DeliveryExpired, errAnnouncementDropped)
+		}
+		a.queued[deviceId] = a.queued[deviceId][n-a.cfg.MaxQueued:]
+	}
+}
+
+// attach makes s receive announcements once hello is handled, those queued
+// for its device are handed to it
+func (a *announcer) attach(s *Session) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s.announceReady = true
+	for _, d := range a.queued[s.deviceId] {
+		if a.cfg.QueueTTL > 0 && time.Since(d.announcement.createdAt) > a.cfg.QueueTTL {
+			d.update(DeliveryExpired, nil)
+			continue
+		}
+		a.push(s, d)
+	}
+	delete(a.queued, s.deviceId)
+}
+
+// detach stops handing announcements to s when it ends, those it has not
+// started are queued again if their announcement asks for it
+func (a *announcer) detach(s *Session) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s.announceReady = false
+	for _, d := range s.announcements {
+		if d.announcement.Queue {
+			a.enqueue(d)
+		} else {
+			d.update(DeliveryFailed, errDeviceDisconnected)
+		}
+	}
+	s.announcements = nil
+}
+
+// next returns the next announcement of s, nil if there is none
+func (a *announcer) next(s *Session) *delivery {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(s.announcements) == 0 {
+		return nil
+	}
+
+	d := s.announcements[0]
+	s.announcements = s.announcements[1:]
+	d.update(DeliveryPlaying, nil)
+	return d
+}
+
+// finish records whether d has been delivered
+func (a *announcer) finish(d *delivery, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err != nil {
+		d.update(DeliveryFailed, err)
+		return
+	}
+	d.update(DeliveryDelivered, nil)
+}
+
+// update must be called with the lock of the announcer held
+func (d *delivery) update(state DeliveryState, err error) {
+	d.status.State = state
+	d.status.Error = ""
+	if err != nil {
+		d.status.Error = err.Error()
+	}
+	d.status.UpdatedAt = time.Now()
+}
+
+// snapshot must be called with the lock of the announcer held
+func (r *announcement) snapshot() *AnnouncementStatus {
+	status := &AnnouncementStatus{
+		Id:           r.id,
+		CreatedAt:    r.createdAt,
+		Announcement: r.Announcement,
+		Deliveries:   make([]Delivery, 0, len(r.deliveries)),
+	}
+	for _, d := range r.deliveries {
+		status.Deliveries = append(status.Deliveries, d.status)
+	}
+
+	return status
+}
+
+// nextAnnouncement plays the next announcement sent to the device unless one
+// is being played, alerts are shown right away. It reports whether an
+// announcement is being played and must only be called from the session loop.
+func (s *Session) nextAnnouncement(ttsResponseCh chan<- ttsTurnResponse) (bool, error) {
+	if s.turn != nil && s.turn.announcement != nil {
+		return true, nil
+	}
+
+	for {
+		d := s.hub.announcer.next(s)
+		if d == nil {
+			return false, nil
+		}
+
+		a := d.announcement
+		switch a.Kind {
+		case AnnouncementAlert:
+			err := s.cmdAlert(a.Status, a.Text, a.Emotion)
+			s.hub.announcer.finish(d, err)
+			if err != nil {
+				return false, err
+			}
+
+		case AnnouncementText:
+			t := s.beginTurn()
+			t.announcement = d
+			go s.speak(t, a.Text, ttsResponseCh)
+			return true, nil
+
+		case AnnouncementAudio:
+			params := downlinkAudioParams(s.deviceAudioParams)
+			stream, err := openMediaStream(&media.Track{Path: a.path}, int(params.SampleRate), int(params.FrameDuration))
+			if err != nil {
+				log.Error().Err(err).Msgf("Failed to open announcement %s for device %s", a.id, s.deviceId)
+				s.hub.announcer.finish(d, err)
+				continue
+			}
+
+			t := s.beginTurn()
+			t.announcement = d
+			go s.playAnnouncement(t, a.Text, stream, ttsResponseCh)
+			return true, nil
+		}
+	}
+}
+
+// playAnnouncement sends the frames of a pre-recorded announcement like those
+// of an answer, title is shown while it plays
+func (s *Session) playAnnouncement(t *turn, title string, stream *mediaStream, ttsResponseCh chan<- ttsTurnResponse) {
+	defer stream.Close()
+
+	if !sendTurn(t, ttsResponseCh, ttsTurnResponse{t.id, true, &tts.TTSResponse{
+		IsStart: true,
+		Text:    title,
+	}}) {
+		return
+	}
+
+	for {
+		frame, err := stream.next()
+		if err != nil {
+			if err != io.EOF {
+				// the device still stops playing what it got
+				log.Error().Err(err).Msgf("Failed to play announcement for device %s", s.deviceId)
+			}
+			break
+		}
+
+		if !sendTurn(t, ttsResponseCh, ttsTurnResponse{t.id, false, &tts.TTSResponse{
+			Text:  title,
+			Audio: frame,
+		}}) {
+			return
+		}
+	}
+
+	sendTurn(t, ttsResponseCh, ttsTurnResponse{t.id, false, &tts.TTSResponse{
+		IsEnd: true,
+		Text:  title,
+	}})
+}
@@ -0,0 +1,181 @@
+package src
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+
+	"github.com/cornelk/hashmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAnnounceHub(cfg *config.AnnounceConfig) *Hub {
+	return &Hub{
+		announcer:  newAnnouncer(cfg),
+		sessionMap: hashmap.New[string, *Session](),
+	}
+}
+
+// connect registers a session of deviceId which has handled hello
+func connect(h *Hub, deviceId string) *Session {
+	s := newSession(context.Background())
+	s.hub = h
+	s.deviceId = deviceId
+	h.addSession(s)
+	h.announcer.attach(s)
+	return s
+}
+
+func states(status *AnnouncementStatus) map[string]DeliveryState {
+	states := make(map[string]DeliveryState)
+	for _, d := range status.Deliveries {
+		states[d.DeviceId] = d.State
+	}
+	return states
+}
+
+func TestAnnounceValidates(t *testing.T) {
+	dir := t.TempDir()
+	writeWav(t, dir, "闭馆通知.wav", 60)
+	h := newTestAnnounceHub(&config.AnnounceConfig{AssetDir: dir})
+
+	tests := []struct {
+		name         string
+		announcement Announcement
+		ok           bool
+	}{
+		{"text", Announcement{Kind: AnnouncementText, Text: "该休息了"}, true},
+		{"empty text", Announcement{Kind: AnnouncementText, Text: "  "}, false},
+		{"alert", Announcement{Kind: AnnouncementAlert, Status: "提醒", Text: "电量低"}, true},
+		{"empty alert", Announcement{Kind: AnnouncementAlert}, false},
+		{"audio", Announcement{Kind: AnnouncementAudio, Asset: "闭馆通知.wav"}, true},
+		{"missing audio", Announcement{Kind: AnnouncementAudio, Asset: "开馆通知.wav"}, false},
+		{"audio outside", Announcement{Kind: AnnouncementAudio, Asset: "../闭馆通知.wav"}, false},
+		{"unsupported audio", Announcement{Kind: AnnouncementAudio, Asset: "闭馆通知.flac"}, false},
+		{"unknown kind", Announcement{Kind: "video", Text: "该休息了"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.Announce(tt.announcement)
+			assert.Equal(t, tt.ok, err == nil, "error: %v", err)
+		})
+	}
+
+	status, err := h.Announce(Announcement{Kind: AnnouncementAudio, Asset: "闭馆通知.wav"})
+	assert.NoError(t, err)
+	assert.Equal(t, "闭馆通知", status.Text, "audio is titled by its file")
+}
+
+func TestAnnounceDelivers(t *testing.T) {
+	h := newTestAnnounceHub(&config.AnnounceConfig{})
+	s := connect(h, "online")
+
+	status, err := h.Announce(Announcement{Kind: AnnouncementText, Text: "该休息了", Devices: []string{"online", "offline", "online"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]DeliveryState{"online": DeliveryPending, "offline": DeliveryFailed}, states(status))
+	assert.Len(t, s.announceWake, 1, "the session is woken up")
+
+	d := h.announcer.next(s)
+	assert.NotNil(t, d)
+	assert.Nil(t, h.announcer.next(s))
+	status, _ = h.Announcement(status.Id)
+	assert.Equal(t, DeliveryPlaying, states(status)["online"])
+
+	h.announcer.finish(d, nil)
+	status, _ = h.Announcement(status.Id)
+	assert.Equal(t, DeliveryDelivered, states(status)["online"])
+
+	// all connected devices
+	connect(h, "another")
+	status, err = h.Announce(Announcement{Kind: AnnouncementAlert, Status: "提醒"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]DeliveryState{"another": DeliveryPending, "online": DeliveryPending}, states(status))
+
+	_, ok := h.Announcement("unknown")
+	assert.False(t, ok)
+}
+
+func TestAnnounceQueues(t *testing.T) {
+	h := newTestAnnounceHub(&config.AnnounceConfig{MaxQueued: 2})
+
+	var ids []string
+	for _, text := range []string{"一", "二", "三"} {
+		status, err := h.Announce(Announcement{Kind: AnnouncementText, Text: text, Devices: []string{"device"}, Queue: true})
+		assert.NoError(t, err)
+		ids = append(ids, status.Id)
+	}
+
+	status, _ := h.Announcement(ids[0])
+	assert.Equal(t, DeliveryExpired, states(status)["device"], "the oldest is dropped")
+
+	s := connect(h, "device")
+	for _, id := range ids[1:] {
+		status, _ := h.Announcement(id)
+		assert.Equal(t, DeliveryPending, states(status)["device"])
+	}
+	assert.Equal(t, "二", h.announcer.next(s).announcement.Text)
+
+	// not started announcements are queued again on disconnection
+	h.announcer.detach(s)
+	status, _ = h.Announcement(ids[2])
+	assert.Equal(t, DeliveryQueued, states(status)["device"])
+
+	s = connect(h, "device")
+	assert.Equal(t, "三", h.announcer.next(s).announcement.Text)
+}
+
+func TestAnnounceAfterReconnect(t *testing.T) {
+	h := newTestAnnounceHub(&config.AnnounceConfig{})
+
+	old := connect(h, "device")
+	s := connect(h, "device")
+
+	// the previous connection ends after the device reconnected
+	h.announcer.detach(old)
+	h.removeSession(old)
+
+	status, err := h.Announce(Announcement{Kind: AnnouncementText, Text: "该休息了", Devices: []string{"device"}})
+	assert.NoError(t, err)
+	assert.Equal(t, DeliveryPending, states(status)["device"])
+	assert.Equal(t, "该休息了", h.announcer.next(s).announcement.Text)
+
+	h.removeSession(s)
+	status, err = h.Announce(Announcement{Kind: AnnouncementText, Text: "该休息了", Devices: []string{"device"}})
+	assert.NoError(t, err)
+	assert.Equal(t, DeliveryFailed, states(status)["device"])
+}
+
+func TestAnnounceQueueExpires(t *testing.T) {
+	h := newTestAnnounceHub(&config.AnnounceConfig{QueueTTL: time.Millisecond})
+
+	status, err := h.Announce(Announcement{Kind: AnnouncementText, Text: "该休息了", Devices: []string{"device"}, Queue: true})
+	assert.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	s := connect(h, "device")
+	assert.Nil(t, h.announcer.next(s))
+	status, _ = h.Announcement(status.Id)
+	assert.Equal(t, DeliveryExpired, states(status)["device"])
+}
+
+func TestAnnounceHistory(t *testing.T) {
+	h := newTestAnnounceHub(&config.AnnounceConfig{History: 2})
+
+	var ids []string
+	for _, text := range []string{"一", "二", "三"} {
+		status, err := h.Announce(Announcement{Kind: AnnouncementText, Text: text})
+		assert.NoError(t, err)
+		ids = append(ids, status.Id)
+	}
+
+	_, ok := h.Announcement(ids[0])
+	assert.False(t, ok, "the oldest is forgotten")
+
+	statuses := h.Announcements()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, ids[2], statuses[0].Id, "newest first")
+	assert.Empty(t, statuses[0].Deliveries, "no device is connected")
+}
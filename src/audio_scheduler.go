@@ -0,0 +1,180 @@
+package src
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// audioItem is an Opus frame or a command sent in order with the frames, a
+// drain command waits until the device has played the frames sent before it
+type audioItem struct {
+	frame []byte
+	cmd   func() error
+	drain bool
+}
+
+// AudioScheduler sends audio to the device at real-time pace, only lead worth
+// of frames is sent ahead of playback so small device buffers never overflow.
+// Commands such as sentence_start are queued with the frames, so the display
+// follows the speech.
+type AudioScheduler struct {
+	send func(frame []byte) error
+	lead time.Duration // audio sent ahead of playback
+
+	mu            sync.Mutex
+	frameDuration time.Duration
+	queue         []audioItem
+	paused        bool
+	playedUntil   time.Time     // when the device is done with the frames sent
+	wake          chan struct{} // signals new items or resume
+}
+
+func NewAudioScheduler(frameDuration, lead time.Duration, send func(frame []byte) error) *AudioScheduler {
+	return &AudioScheduler{
+		send:          send,
+		lead:          lead,
+		frameDuration: frameDuration,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// SetFrameDuration changes the duration of the frames queued from now on
+func (a *AudioScheduler) SetFrameDuration(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.frameDuration = d
+}
+
+// Enqueue queues a frame for the device
+func (a *AudioScheduler) Enqueue(frame []byte) {
+	a.push(audioItem{frame: frame})
+}
+
+// EnqueueCmd queues cmd after the frames queued so far, it is called as soon
+// as it is reached or once they are played if drain is set
+func (a *AudioScheduler) EnqueueCmd(cmd func() error, drain bool) {
+	a.push(audioItem{cmd: cmd, drain: drain})
+}
+
+// Pause holds the queued items until Resume
+func (a *AudioScheduler) Pause() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.paused = true
+}
+
+func (a *AudioScheduler) Resume() {
+	a.mu.Lock()
+	a.paused = false
+	a.mu.Unlock()
+
+	a.signal()
+}
+
+// Flush drops the queued items, e.g. when the answer is aborted, and returns
+// how many were dropped
+func (a *AudioScheduler) Flush() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := len(a.queue)
+	a.queue = nil
+	a.playedUntil = time.Time{}
+	return n
+}
+
+// Pending returns the number of queued items
+func (a *AudioScheduler) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.queue)
+}
+
+// Run delivers the queued items until ctx is done or sending fails
+func (a *AudioScheduler) Run(ctx context.Context) error {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		item, wait, ok := a.next(time.Now())
+		if ok {
+			if err := a.deliver(item); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var expired <-chan time.Time
+		if wait > 0 {
+			timer.Reset(wait)
+			expired = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-a.wake:
+		case <-expired:
+		}
+
+		timer.Stop()
+	}
+}
+
+// next pops the item due at now, otherwise it returns how long to wait for
+// it, 0 meaning until something is queued or resumed
+func (a *AudioScheduler) next(now time.Time) (audioItem, time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.paused || len(a.queue) == 0 {
+		return audioItem{}, 0, false
+	}
+
+	// the device ran out of audio, pacing restarts from now
+	if a.playedUntil.Before(now) {
+		a.playedUntil = now
+	}
+
+	head := a.queue[0]
+	switch {
+	case head.frame != nil:
+		if ahead := a.playedUntil.Sub(now); ahead > a.lead {
+			return audioItem{}, ahead - a.lead, false
+		}
+		a.playedUntil = a.playedUntil.Add(a.frameDuration)
+	case head.drain:
+		if ahead := a.playedUntil.Sub(now); ahead > 0 {
+			return audioItem{}, ahead, false
+		}
+	}
+
+	a.queue = a.queue[1:]
+	return head, 0, true
+}
+
+func (a *AudioScheduler) deliver(item audioItem) error {
+	if item.frame != nil {
+		return a.send(item.frame)
+	}
+	return item.cmd()
+}
+
+func (a *AudioScheduler) push(item audioItem) {
+	a.mu.Lock()
+	a.queue = append(a.queue, item)
+	a.mu.Unlock()
+
+	a.signal()
+}
+
+func (a *AudioScheduler) signal() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
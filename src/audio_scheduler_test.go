@@ -0,0 +1,101 @@
+package src
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sentLog struct {
+	mu    sync.Mutex
+	items []string
+	at    []time.Duration
+	start time.Time
+}
+
+func (l *sentLog) add(item string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = append(l.items, item)
+	l.at = append(l.at, time.Since(l.start))
+}
+
+func (l *sentLog) snapshot() ([]string, []time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string(nil), l.items...), append([]time.Duration(nil), l.at...)
+}
+
+func TestAudioSchedulerPaces(t *testing.T) {
+	sent := &sentLog{start: time.Now()}
+	a := NewAudioScheduler(20*time.Millisecond, 40*time.Millisecond, func(frame []byte) error {
+		sent.add(string(frame))
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+
+	a.EnqueueCmd(func() error { sent.add("start"); return nil }, false)
+	for _, frame := range []string{"1", "2", "3", "4", "5", "6"} {
+		a.Enqueue([]byte(frame))
+	}
+	a.EnqueueCmd(func() error { sent.add("stop"); return nil }, true)
+
+	assert.Eventually(t, func() bool { return a.Pending() == 0 }, time.Second, 5*time.Millisecond)
+	time.Sleep(10 * time.Millisecond) // the last item is delivered after it is popped
+
+	items, at := sent.snapshot()
+	assert.Equal(t, []string{"start", "1", "2", "3", "4", "5", "6", "stop"}, items)
+	// frames within the lead are sent at once, the rest at real-time pace
+	assert.Less(t, at[3], 20*time.Millisecond)
+	assert.GreaterOrEqual(t, at[6], 55*time.Millisecond)
+	// stop waits until the 120ms of audio are played
+	assert.GreaterOrEqual(t, at[7], 115*time.Millisecond)
+}
+
+func TestAudioSchedulerPauseAndFlush(t *testing.T) {
+	sent := &sentLog{start: time.Now()}
+	a := NewAudioScheduler(20*time.Millisecond, 0, func(frame []byte) error {
+		sent.add(string(frame))
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+
+	a.Pause()
+	a.Enqueue([]byte("1"))
+	a.Enqueue([]byte("2"))
+	time.Sleep(30 * time.Millisecond)
+	items, _ := sent.snapshot()
+	assert.Empty(t, items, "nothing is sent while paused")
+
+	a.Resume()
+	assert.Eventually(t, func() bool { return a.Pending() == 0 }, time.Second, time.Millisecond)
+
+	// frames of an aborted answer are dropped
+	for range 10 {
+		a.Enqueue([]byte("x"))
+	}
+	assert.Greater(t, a.Flush(), 5)
+	time.Sleep(30 * time.Millisecond)
+	items, _ = sent.snapshot()
+	assert.LessOrEqual(t, len(items), 4)
+	assert.Equal(t, []string{"1", "2"}, items[:2])
+}
+
+func TestDownlinkAudioParams(t *testing.T) {
+	params := downlinkAudioParams(HelloAudioParams{Format: "opus", SampleRate: 24000, Channels: 1, FrameDuration: 20})
+	assert.Equal(t, HelloAudioParams{Format: "opus", SampleRate: 24000, Channels: 1, FrameDuration: 20}, params)
+
+	params = downlinkAudioParams(HelloAudioParams{SampleRate: 44100, FrameDuration: 30})
+	assert.Equal(t, HelloAudioParams{Format: "opus", SampleRate: 16000, Channels: 1, FrameDuration: 60}, params)
+}
@@ -63,6 +63,8 @@ const (
 	CmdTypeLLM    string = "llm"
 	CmdTypeSystem string = "system"
 	CmdTypeAlert  string = "alert"
+	CmdTypeIot    string = "iot"
+	CmdTypeMcp    string = "mcp"
 )
 
 func (s *Session) cmdTTSStart() error {
@@ -73,13 +75,7 @@ func (s *Session) cmdTTSStart() error {
 	}
 	log.Debug().Msgf("cmdTTSStart: %+v", jsonData)
 
-	w, err := s.conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-	defer w.Close()
-
-	return json.NewEncoder(w).Encode(jsonData)
+	return s.sendSpeech(jsonData)
 }
 
 func (s *Session) cmdTTSStop() error {
@@ -90,13 +86,20 @@ func (s *Session) cmdTTSStop() error {
 	}
 	log.Debug().Msgf("cmdTTSStop: %+v", jsonData)
 
-	w, err := s.conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
+	return s.sendSpeech(jsonData)
+}
+
+// cmdTTSAbort stops the speech at once, it is written ahead of the messages
+// waiting for the writer
+func (s *Session) cmdTTSAbort() error {
+	jsonData := map[string]string{
+		"type":       CmdTypeTTS,
+		"state":      "stop",
+		"session_id": s.sessionId,
 	}
-	defer w.Close()
+	log.Debug().Msgf("cmdTTSAbort: %+v", jsonData)
 
-	return json.NewEncoder(w).Encode(jsonData)
+	return s.sendControl(jsonData)
 }
 
 func (s *Session) cmdTTSSentenceStart(text string) error {
@@ -108,13 +111,7 @@ func (s *Session) cmdTTSSentenceStart(text string) error {
 	}
 	log.Debug().Msgf("cmdTTSSentenceStart: %+v", jsonData)
 
-	w, err := s.conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-
-	defer w.Close()
-	return json.NewEncoder(w).Encode(jsonData)
+	return s.sendSpeech(jsonData)
 }
 
 func (s *Session) cmdSTT(text string) error {
@@ -125,13 +122,7 @@ func (s *Session) cmdSTT(text string) error {
 	}
 	log.Debug().Msgf("cmdSTT: %+v", jsonData)
 
-	w, err := s.conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-
-	defer w.Close()
-	return json.NewEncoder(w).Encode(jsonData)
+	return s.sendJSON(jsonData)
 }
 
 func (s *Session) cmdLLM(emotion string) error {
@@ -139,33 +130,22 @@ func (s *Session) cmdLLM(emotion string) error {
 		"type":       CmdTypeLLM,
 		"session_id": s.sessionId,
 		"emotion":    emotion,
+		"text":       emotionEmoji[Emotion(emotion)],
 	}
 	log.Debug().Msgf("cmdLLM: %+v", jsonData)
 
-	w, err := s.conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-
-	defer w.Close()
-	return json.NewEncoder(w).Encode(jsonData)
+	return s.sendJSON(jsonData)
 }
 
-func (s *Session) cmdSystem() error {
+func (s *Session) cmdSystem(command string) error {
 	jsonData := map[string]string{
 		"type":       CmdTypeSystem,
-		"command":    "reboot",
+		"command":    command,
 		"session_id": s.sessionId,
 	}
 	log.Debug().Msgf("cmdSystem: %+v", jsonData)
 
-	w, err := s.conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
-
-	defer w.Close()
-	return json.NewEncoder(w).Encode(jsonData)
+	return s.sendJSON(jsonData)
 }
 
 func (s *Session) cmdAlert(status, message, emotion string) error {
@@ -178,13 +158,35 @@ func (s *Session) cmdAlert(status, message, emotion string) error {
 	}
 	log.Debug().Msgf("cmdTTSAlert: %+v", jsonData)
 
-	w, err := s.conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
+	return s.sendControl(jsonData)
+}
+
+func (s *Session) cmdIot(name, method string, parameters map[string]any) error {
+	jsonData := map[string]interface{}{
+		"type":       CmdTypeIot,
+		"session_id": s.sessionId,
+		"commands": []map[string]interface{}{
+			{
+				"name":       name,
+				"method":     method,
+				"parameters": parameters,
+			},
+		},
+	}
+	log.Debug().Msgf("cmdIot: %+v", jsonData)
+
+	return s.sendJSON(jsonData)
+}
+
+func (s *Session) cmdMcp(payload any) error {
+	jsonData := map[string]interface{}{
+		"type":       CmdTypeMcp,
+		"session_id": s.sessionId,
+		"payload":    payload,
 	}
+	log.Debug().Msgf("cmdMcp: %+v", jsonData)
 
-	defer w.Close()
-	return json.NewEncoder(w).Encode(jsonData)
+	return s.sendControl(jsonData)
 }
 
 func (s *Session) cmdEmotion(emotion string) error {
@@ -192,12 +194,37 @@ func (s *Session) cmdEmotion(emotion string) error {
 }
 
 func (s *Session) cmdAudio(audio []byte) error {
-	w, err := s.conn.NextWriter(websocket.BinaryMessage)
+	return s.outbox.PushSpeech(websocket.BinaryMessage, audio)
+}
+
+// sendJSON queues a message for the writer after the audio queued before it
+func (s *Session) sendJSON(v any) error {
+	data, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
 
-	_, err = w.Write(audio)
+	return s.outbox.Push(websocket.TextMessage, data)
+}
+
+// sendSpeech queues a command of the speech, which is dropped with the audio
+// when the speech is interrupted
+func (s *Session) sendSpeech(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.outbox.PushSpeech(websocket.TextMessage, data)
+}
+
+// sendControl queues an out of band message, it is written ahead of the
+// messages waiting
+func (s *Session) sendControl(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return s.outbox.PushControl(data)
 }
@@ -0,0 +1,78 @@
+package src
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const emotionPromptTemplate = `Start every answer with exactly one emotion tag in square brackets that matches the mood of the answer, for example "[happy] 今天天气真好！".
+Available emotions: %s.`
+
+// emotionPrompt tells the model which emotions the device can display
+func emotionPrompt() string {
+	names := make([]string, 0, len(emotionEmoji))
+	for emotion := range emotionEmoji {
+		names = append(names, string(emotion))
+	}
+	sort.Strings(names)
+
+	return fmt.Sprintf(emotionPromptTemplate, strings.Join(names, ", "))
+}
+
+// parseEmotion looks for a leading [emotion] tag or emoji in answer, the
+// matched emotion is returned with the answer stripped of it. ok is false and
+// answer is returned untouched when nothing matches.
+func parseEmotion(answer string) (emotion Emotion, text string, ok bool) {
+	trimmed := strings.TrimLeftFunc(answer, unicode.IsSpace)
+
+	for _, brackets := range [][2]string{{"[", "]"}, {"【", "】"}} {
+		if !strings.HasPrefix(trimmed, brackets[0]) {
+			continue
+		}
+
+		end := strings.Index(trimmed, brackets[1])
+		if end < 0 {
+			continue
+		}
+
+		tag := strings.ToLower(strings.TrimSpace(trimmed[len(brackets[0]):end]))
+		if _, exists := emotionEmoji[Emotion(tag)]; exists {
+			return Emotion(tag), stripLeading(trimmed[end+len(brackets[1]):]), true
+		}
+	}
+
+	for e, emoji := range emotionEmoji {
+		if len(emoji) == 0 || !strings.HasPrefix(trimmed, emoji) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(trimmed[len(emoji):], "️") // variation selector
+		return e, stripLeading(rest), true
+	}
+
+	return "", answer, false
+}
+
+func stripLeading(text string) string {
+	return strings.TrimLeftFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ':' || r == '：'
+	})
+}
+
+// extractEmotion strips the emotion from answer, answers without one get the
+// configured fallback emotion
+func (s *Session) extractEmotion(answer string) (Emotion, string) {
+	emotion, text, ok := parseEmotion(answer)
+	if ok {
+		return emotion, text
+	}
+
+	fallback := EmotionNeutral
+	if cfg := s.hub.cfgLlm.Emotion; cfg != nil && len(cfg.Fallback) != 0 {
+		fallback = Emotion(cfg.Fallback)
+	}
+
+	return fallback, answer
+}
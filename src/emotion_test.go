@@ -0,0 +1,40 @@
+package src
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEmotion(t *testing.T) {
+	stubs := []struct {
+		answer  string
+		emotion Emotion
+		text    string
+		ok      bool
+	}{
+		{"[happy] 今天天气真好！", EmotionHappy, "今天天气真好！", true},
+		{"  [Sad]我有点难过", EmotionSad, "我有点难过", true},
+		{"【thinking】让我想想", EmotionThinking, "让我想想", true},
+		{"😂 太好笑了", EmotionLaughing, "太好笑了", true},
+		{"😊️你好", EmotionHappy, "你好", true},
+		{"[unknown] 你好", "", "[unknown] 你好", false},
+		{"你好 [happy]", "", "你好 [happy]", false},
+		{"[happy]", EmotionHappy, "", true},
+		{"", "", "", false},
+	}
+
+	for _, stub := range stubs {
+		emotion, text, ok := parseEmotion(stub.answer)
+		assert.Equal(t, stub.ok, ok, stub.answer)
+		assert.Equal(t, stub.emotion, emotion, stub.answer)
+		assert.Equal(t, stub.text, text, stub.answer)
+	}
+}
+
+func TestEmotionPrompt(t *testing.T) {
+	prompt := emotionPrompt()
+	for emotion := range emotionEmoji {
+		assert.Contains(t, prompt, string(emotion))
+	}
+}
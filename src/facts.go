@@ -0,0 +1,242 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type factArguments struct {
+	Id      string `json:"id"` // reference of the fact, e.g. 1
+	Content string `json:"content"`
+}
+
+// factRefs numbers the facts shown to LLM within a session, so it refers to
+// them by short references instead of copying their ids
+type factRefs struct {
+	mu  sync.Mutex
+	ids []string // reference n is the fact ids[n-1]
+}
+
+// add returns the reference of the fact id
+func (r *factRefs) add(id string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, known := range r.ids {
+		if known == id {
+			return strconv.Itoa(i + 1)
+		}
+	}
+
+	r.ids = append(r.ids, id)
+	return strconv.Itoa(len(r.ids))
+}
+
+// id returns the id of the fact ref refers to
+func (r *factRefs) id(ref string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, err := strconv.Atoi(ref)
+	if err != nil || n < 1 || n > len(r.ids) {
+		return "", false
+	}
+
+	return r.ids[n-1], true
+}
+
+// factsPrompt lists the most recently updated facts of the device for the
+// system prompt, numbered by refs, empty if facts are disabled
+func (h *Hub) factsPrompt(deviceId string, refs *factRefs) (string, error) {
+	cfg := h.cfgFacts
+	if cfg == nil || !cfg.Enable {
+		return "", nil
+	}
+
+	facts, err := h.repo.ListFacts(repo.WhereCondition{
+		"device_id": deviceId,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.MaxFacts > 0 && len(facts) > cfg.MaxFacts {
+		facts = facts[len(facts)-cfg.MaxFacts:]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(cfg.Prompt)
+	if len(facts) == 0 {
+		sb.WriteString("\n（暂无）")
+	}
+
+	for _, fact := range facts {
+		fmt.Fprintf(&sb, "\n- [%s] %s", refs.add(fact.Id), fact.Content)
+	}
+
+	return sb.String(), nil
+}
+
+// registerFactTools lets LLM save, update and forget facts of the device
+func (s *Session) registerFactTools(registry *ToolRegistry) {
+	cfg := s.hub.cfgFacts
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+
+	registry.Register(llm.Tool{
+		Name:        "remember_fact",
+		Description: "Remember a durable fact about the user for future conversations, e.g. name, birthday, preferences or allergies.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"content": map[string]any{"type": "string", "description": "the fact in one short sentence"},
+			},
+			"required": []string{"content"},
+		},
+	}, s.rememberFact)
+
+	registry.Register(llm.Tool{
+		Name:        "update_fact",
+		Description: "Replace a remembered fact about the user which has changed.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"id":      map[string]any{"type": "string", "description": "number of the fact, e.g. 1"},
+				"content": map[string]any{"type": "string", "description": "the new fact in one short sentence"},
+			},
+			"required": []string{"id", "content"},
+		},
+	}, s.updateFact)
+
+	registry.Register(llm.Tool{
+		Name:        "forget_fact",
+		Description: "Forget a remembered fact about the user.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"id": map[string]any{"type": "string", "description": "number of the fact, e.g. 1"},
+			},
+			"required": []string{"id"},
+		},
+	}, s.forgetFact)
+}
+
+func (s *Session) rememberFact(ctx context.Context, arguments string) (string, error) {
+	args, err := parseFactArguments(arguments)
+	if err != nil {
+		return "", err
+	}
+
+	if len(args.Content) == 0 {
+		return "", errors.New("content of the fact is empty")
+	}
+
+	now := time.Now()
+	fact := &types.Fact{
+		Id:        uuid.New().String(),
+		DeviceId:  s.deviceId,
+		Content:   args.Content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.hub.repo.SaveFact(fact); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("fact [%s] remembered", s.factRefs.add(fact.Id)), nil
+}
+
+func (s *Session) updateFact(ctx context.Context, arguments string) (string, error) {
+	args, err := parseFactArguments(arguments)
+	if err != nil {
+		return "", err
+	}
+
+	if len(args.Content) == 0 {
+		return "", errors.New("content of the fact is empty")
+	}
+
+	fact, err := s.findFact(args.Id)
+	if err != nil {
+		return "", err
+	}
+
+	updated := *fact
+	updated.Content = args.Content
+	updated.UpdatedAt = time.Now()
+	if err := s.hub.repo.SaveFact(&updated); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("fact [%s] updated", args.Id), nil
+}
+
+func (s *Session) forgetFact(ctx context.Context, arguments string) (string, error) {
+	args, err := parseFactArguments(arguments)
+	if err != nil {
+		return "", err
+	}
+
+	fact, err := s.findFact(args.Id)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.hub.repo.RemoveFacts(repo.WhereCondition{
+		"device_id": s.deviceId,
+		"id":        fact.Id,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("fact [%s] forgotten", args.Id), nil
+}
+
+// findFact looks the fact of reference ref up among the ones of the device
+// only
+func (s *Session) findFact(ref string) (*types.Fact, error) {
+	id, ok := s.factRefs.id(ref)
+	if !ok {
+		return nil, errors.Wrap(repo.ErrFactNotFound, ref)
+	}
+
+	facts, err := s.hub.repo.ListFacts(repo.WhereCondition{
+		"device_id": s.deviceId,
+		"id":        id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(facts) == 0 {
+		return nil, errors.Wrap(repo.ErrFactNotFound, ref)
+	}
+
+	return facts[0], nil
+}
+
+func parseFactArguments(arguments string) (*factArguments, error) {
+	var args factArguments
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return nil, errors.Wrapf(err, "invalid arguments %s", arguments)
+	}
+
+	args.Id = strings.Trim(strings.TrimSpace(args.Id), "[]")
+	args.Content = strings.TrimSpace(args.Content)
+	return &args, nil
+}
@@ -0,0 +1,125 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubToolLLM replays answers, recording the dialogues and tools of every call
+type stubToolLLM struct {
+	answers   []llm.Dialogue
+	dialogues [][]llm.Dialogue
+	tools     [][]llm.Tool
+}
+
+func (s *stubToolLLM) Response(ctx context.Context, dialogues []llm.Dialogue) (string, error) {
+	answer, err := s.Chat(ctx, dialogues, nil)
+	if err != nil {
+		return "", err
+	}
+	return answer.Content, nil
+}
+
+func (s *stubToolLLM) Chat(ctx context.Context, dialogues []llm.Dialogue, tools []llm.Tool) (*llm.Dialogue, error) {
+	s.dialogues = append(s.dialogues, append([]llm.Dialogue(nil), dialogues...))
+	s.tools = append(s.tools, tools)
+
+	if len(s.answers) == 0 {
+		return nil, fmt.Errorf("no more answers")
+	}
+
+	answer := s.answers[0]
+	s.answers = s.answers[1:]
+	return &answer, nil
+}
+
+func toolCall(id, name, arguments string) llm.Dialogue {
+	return llm.Dialogue{
+		Role:      llm.RoleAssistant,
+		ToolCalls: []llm.ToolCall{{Id: id, Name: name, Arguments: arguments}},
+	}
+}
+
+func TestFactTools(t *testing.T) {
+	h, err := New(config.DefaultConfig())
+	assert.NoError(t, err)
+	s := &Session{hub: h, deviceId: "device-1"}
+
+	stub := &stubToolLLM{answers: []llm.Dialogue{
+		toolCall("call_1", "remember_fact", `{"content":"名字叫小明"}`),
+		{Role: llm.RoleAssistant, Content: "好的小明，我记住了。"},
+	}}
+
+	tools := NewToolRegistry()
+	s.registerFactTools(tools)
+
+	processor := NewLlmProcessor(context.Background(), &config.LlmConfig{}, stub)
+	processor.SetTools(tools)
+
+	answer, err := processor.Push(context.Background(), "我叫小明")
+	assert.NoError(t, err)
+	assert.Equal(t, "好的小明，我记住了。", answer)
+	assert.Len(t, stub.tools[0], 3)
+
+	facts, _ := h.repo.ListFacts(repo.WhereCondition{"device_id": "device-1"})
+	if assert.Len(t, facts, 1) {
+		assert.Equal(t, "名字叫小明", facts[0].Content)
+	}
+
+	// the tool result is sent back with the id of the call
+	last := stub.dialogues[1][len(stub.dialogues[1])-1]
+	assert.Equal(t, llm.RoleTool, last.Role)
+	assert.Equal(t, "call_1", last.ToolCallId)
+	assert.Equal(t, "fact [1] remembered", last.Content, "facts are referred to by short numbers")
+
+	prompt, err := h.factsPrompt("device-1", &factRefs{})
+	assert.NoError(t, err)
+	assert.Contains(t, prompt, "- [1] 名字叫小明")
+
+	result := tools.Call(context.Background(), llm.ToolCall{Name: "update_fact", Arguments: `{"id":"[1]","content":"名字叫小红"}`})
+	assert.Contains(t, result, "updated")
+	facts, _ = h.repo.ListFacts(repo.WhereCondition{"device_id": "device-1"})
+	assert.Equal(t, "名字叫小红", facts[0].Content)
+
+	result = tools.Call(context.Background(), llm.ToolCall{Name: "forget_fact", Arguments: `{"id":"missing"}`})
+	assert.Contains(t, result, "error")
+
+	other := &Session{hub: h, deviceId: "device-2"}
+	other.factRefs.add(facts[0].Id)
+	_, err = other.forgetFact(context.Background(), `{"id":"1"}`)
+	assert.ErrorIs(t, err, repo.ErrFactNotFound, "facts of other devices are out of reach")
+
+	result = tools.Call(context.Background(), llm.ToolCall{Name: "forget_fact", Arguments: `{"id":"1"}`})
+	assert.Contains(t, result, "forgotten")
+	facts, _ = h.repo.ListFacts(repo.WhereCondition{"device_id": "device-1"})
+	assert.Empty(t, facts)
+}
+
+func TestToolRoundsBounded(t *testing.T) {
+	answers := make([]llm.Dialogue, 0)
+	for i := 0; i < maxToolRounds; i++ {
+		answers = append(answers, toolCall(fmt.Sprintf("call_%d", i), "echo", `{}`))
+	}
+	answers = append(answers, llm.Dialogue{Role: llm.RoleAssistant, Content: "done"})
+	stub := &stubToolLLM{answers: answers}
+
+	tools := NewToolRegistry()
+	tools.Register(llm.Tool{Name: "echo"}, func(ctx context.Context, arguments string) (string, error) {
+		return arguments, nil
+	})
+
+	processor := NewLlmProcessor(context.Background(), &config.LlmConfig{}, stub)
+	processor.SetTools(tools)
+
+	answer, err := processor.Push(context.Background(), "hi")
+	assert.NoError(t, err)
+	assert.Equal(t, "done", answer)
+	assert.Nil(t, stub.tools[maxToolRounds], "the last round has to answer")
+}
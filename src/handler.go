@@ -2,6 +2,9 @@ package src
 
 import (
 	"encoding/binary"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
 
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
@@ -33,16 +36,70 @@ func (s *Session) handleHello(raw []byte) error {
 		Type:        MessageTypeHello,
 		SessionId:   s.sessionId,
 		Transport:   TransportTypeWebsocket,
-		AudioParams: msg.AudioParams,
+		AudioParams: downlinkAudioParams(msg.AudioParams),
+	}
+
+	if err := s.applyAudioParams(); err != nil {
+		return err
 	}
 
-	w, err := s.conn.NextWriter(websocket.TextMessage)
+	data, err := sonic.Marshal(resp)
 	if err != nil {
 		return err
 	}
-	defer w.Close()
+	if err := s.outbox.Push(websocket.TextMessage, data); err != nil {
+		return err
+	}
+
+	s.fire(SessionEventHello)
+
+	// commands need the session id, so announcements wait for hello
+	s.hub.announcer.attach(s)
 
-	return sonic.ConfigDefault.NewEncoder(w).Encode(resp)
+	if s.deviceSupportMCP {
+		return s.mcpInitialize()
+	}
+	return nil
+}
+
+// downlinkAudioParams are the params of the audio sent to the device, the ones
+// of hello if Opus supports them
+func downlinkAudioParams(params HelloAudioParams) HelloAudioParams {
+	downlink := HelloAudioParams{
+		Format:        "opus",
+		SampleRate:    tts.SampleRate,
+		Channels:      1,
+		FrameDuration: defaultOpusFrameDuration,
+	}
+
+	if opusSampleRates[int(params.SampleRate)] {
+		downlink.SampleRate = params.SampleRate
+	}
+
+	if _, ok := opusFrameSizes[int(params.FrameDuration)]; ok {
+		downlink.FrameDuration = params.FrameDuration
+	}
+
+	return downlink
+}
+
+// applyAudioParams makes the encoder and the scheduler follow the audio params
+// negotiated in hello, the defaults are used until it is received
+func (s *Session) applyAudioParams() error {
+	params := downlinkAudioParams(s.deviceAudioParams)
+	frameDuration := time.Duration(params.FrameDuration) * time.Millisecond
+
+	if s.scheduler == nil {
+		s.scheduler = NewAudioScheduler(frameDuration, s.hub.cfgTts.PlaybackLead, s.cmdAudio)
+	} else {
+		s.scheduler.SetFrameDuration(frameDuration)
+	}
+
+	if s.ttsProcessor == nil {
+		return nil
+	}
+
+	return s.ttsProcessor.SetAudioParams(int(params.SampleRate), int(params.FrameDuration))
 }
 
 func (s *Session) handleListenStart(raw []byte) error {
@@ -58,15 +115,11 @@ func (s *Session) handleListenStart(raw []byte) error {
 	if err := s.resetState(msg.Mode); err != nil {
 		return err
 	}
-
-	s.cmdAlert("status", "fffffff", string(EmotionHappy))
-
-	s.cmdSTT("foobar4")
-
-	return s.cmdEmotion(string(EmotionAngry))
+	return s.fire(SessionEventListenStart)
 }
 
 func (s *Session) handleListenStop(raw []byte) error {
+	s.fire(SessionEventListenStop)
 	return nil
 }
 
@@ -113,7 +166,7 @@ func (s *Session) handleAbort(raw []byte) error {
 		return ErrSessionIdMismatch
 	}
 
-	return nil
+	return s.abortTurn(msg.Reason)
 }
 
 func (s *Session) handleIotDescribe(raw []byte) error {
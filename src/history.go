@@ -0,0 +1,108 @@
+package src
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+// restore turns of recent sessions of the device, so reconnecting does not
+// lose the context of the conversation
+func (s *Session) restoreHistory() error {
+	cfg := s.hub.cfgHistory
+	if !cfg.Enable || cfg.ResumeWindow <= 0 {
+		return nil
+	}
+
+	turns, err := s.hub.repo.ListTurns(repo.WhereCondition{
+		"device_id": s.deviceId,
+		"after":     time.Now().Add(-cfg.ResumeWindow),
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.MaxTurns > 0 && len(turns) > cfg.MaxTurns {
+		turns = turns[len(turns)-cfg.MaxTurns:]
+	}
+
+	log.Info().Msgf("Restored %d turns of history for device %s", len(turns), s.deviceId)
+	s.llmProcessor.Restore(turns)
+	return nil
+}
+
+func (s *Session) saveTurn(question, answer string, askedAt time.Time) {
+	cfg := s.hub.cfgHistory
+	if !cfg.Enable {
+		return
+	}
+
+	err := s.hub.repo.AppendTurn(&types.Turn{
+		DeviceId:   s.deviceId,
+		SessionId:  s.sessionId,
+		Question:   question,
+		Answer:     answer,
+		AskedAt:    askedAt,
+		AnsweredAt: time.Now(),
+
+		ConversationId: s.llmProcessor.ConversationId(),
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to save turn for device %s", s.deviceId)
+		return
+	}
+
+	if cfg.Retention > 0 {
+		err = s.hub.repo.RemoveTurns(repo.WhereCondition{
+			"device_id": s.deviceId,
+			"before":    time.Now().Add(-cfg.Retention),
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to remove expired turns for device %s", s.deviceId)
+		}
+	}
+}
+
+func (s *Session) isForgetCommand(text string) bool {
+	normalized := normalizeCommand(text)
+	if len(normalized) == 0 {
+		return false
+	}
+
+	for _, phrase := range s.hub.cfgHistory.ForgetPhrases {
+		phrase = normalizeCommand(phrase)
+		if len(phrase) != 0 && strings.Contains(normalized, phrase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forget both the persisted turns and the dialogues in memory
+func (s *Session) forgetHistory() error {
+	log.Info().Msgf("Forgetting conversation history of device %s", s.deviceId)
+
+	s.llmProcessor.Reset()
+	return s.hub.repo.RemoveTurns(repo.WhereCondition{
+		"device_id": s.deviceId,
+	})
+}
+
+// lower case and drop punctuations and spaces, ASR output is not stable on them
+func normalizeCommand(text string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r) {
+			continue
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
@@ -2,11 +2,18 @@ package src
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/kb"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/failover"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/media"
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/cache"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/local"
 	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
 
 	"github.com/cloudwego/hertz/pkg/app"
@@ -16,44 +23,165 @@ import (
 )
 
 type Hub struct {
-	cfgOta *config.OtaConfig
-	cfgAsr *config.AsrConfig // ASR configuration
-	cfgLlm *config.LlmConfig // LLM configuration, if needed
-	cfgTts *config.TtsConfig // TTS configuration, if needed
-
-	repo       repo.Respository
-	sessionMap *hashmap.Map[string, *Session]
+	cfgOta     *config.OtaConfig
+	cfgAsr     *config.AsrConfig     // ASR configuration
+	cfgLlm     *config.LlmConfig     // LLM configuration, if needed
+	cfgTts     *config.TtsConfig     // TTS configuration, if needed
+	cfgHistory *config.HistoryConfig // conversation history configuration
+
+	cfgFacts       *config.FactsConfig              // long-term facts configuration
+	cfgKnowledge   *config.KnowledgeConfig          // knowledge base configuration
+	cfgPersonas    map[string]*config.PersonaConfig // persona name -> persona
+	defaultPersona string                           // persona of devices without one
+	cfgVision      *config.VisionConfig             // photo explaining configuration
+	cfgMedia       *config.MediaConfig              // local music and stories configuration
+
+	intentRouter *IntentRouter  // local command intents
+	knowledge    *kb.Manager    // knowledge bases shared by devices
+	vision       llm.VisionLLM  // nil if vision is disabled
+	localTts     *local.Tts     // warm processes of the local TTS engine, nil if not configured
+	ttsCache     *cache.Cache   // audio of synthesized sentences, nil if disabled
+	media        *media.Library // local music and stories, nil if disabled
+	announcer    *announcer     // announcements pushed to devices
+
+	repo         repo.Respository
+	sessionMu    sync.Mutex // serializes adding and removing sessions, not needed to read them
+	sessionMap   *hashmap.Map[string, *Session]
+	llmHealthMap *hashmap.Map[string, *failover.Health] // provider name -> health shared by sessions
+
+	sessionCounters *sessionCounters // transitions of sessions since startup
 }
 
-func New(cfgOta *config.OtaConfig,
-	cfgAsr *config.AsrConfig,
-	cfgLlm *config.LlmConfig,
-	cfgTts *config.TtsConfig,
-) (*Hub, error) {
+func New(cfg *config.Config) (*Hub, error) {
 	h := &Hub{
-		cfgOta:     cfgOta,
-		cfgAsr:     cfgAsr,
-		cfgLlm:     cfgLlm,
-		cfgTts:     cfgTts,
+		cfgOta:     cfg.Ota,
+		cfgAsr:     cfg.Asr,
+		cfgLlm:     cfg.Llm,
+		cfgTts:     cfg.Tts,
+		cfgHistory: cfg.History,
+
+		cfgFacts:       cfg.Facts,
+		cfgKnowledge:   cfg.Knowledge,
+		cfgPersonas:    cfg.Personas,
+		defaultPersona: cfg.DefaultPersona,
+		cfgVision:      cfg.Vision,
+		cfgMedia:       cfg.Media,
+
+		announcer: newAnnouncer(cfg.Announce),
+
 		repo:       repo.NewInMemoryRepository(),
 		sessionMap: hashmap.New[string, *Session](),
+
+		llmHealthMap: hashmap.New[string, *failover.Health](),
+
+		sessionCounters: newSessionCounters(),
 	}
 
-	if cfgOta == nil {
+	if cfg.Ota == nil {
 		return nil, errors.New("ota configuration cannot be nil")
 	}
 
-	if cfgAsr == nil {
+	if cfg.Asr == nil {
 		return nil, errors.New("asr configuration cannot be nil")
 	}
 
-	if cfgAsr.Doubao == nil {
+	if cfg.Asr.Doubao == nil {
 		return nil, errors.New("doubao ASR configuration cannot be nil")
 	}
 
+	if cfg.Llm == nil {
+		return nil, errors.New("llm configuration cannot be nil")
+	}
+
+	if cfg.History == nil {
+		h.cfgHistory = &config.HistoryConfig{}
+	}
+
+	if cfg.Tts == nil {
+		h.cfgTts = &config.TtsConfig{}
+	}
+
+	if cfg.Vision == nil {
+		h.cfgVision = &config.VisionConfig{}
+	}
+	h.vision = newVisionLLM(h.cfgVision)
+
+	var err error
+	h.intentRouter, err = NewIntentRouter(cfg.Intent)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.checkLlmProfiles(); err != nil {
+		return nil, err
+	}
+
+	h.localTts, err = newLocalTts(h.cfgTts.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.checkTtsProviders(); err != nil {
+		return nil, err
+	}
+
+	h.ttsCache, err = newTtsCache(h.cfgTts.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	h.knowledge, err = newKnowledgeManager(cfg.Knowledge)
+	if err != nil {
+		return nil, err
+	}
+
+	h.media, err = newMediaLibrary(cfg.Media)
+	if err != nil {
+		return nil, err
+	}
+
 	return h, nil
 }
 
+// Repository returns the repository shared by devices
+func (h *Hub) Repository() repo.Respository {
+	return h.repo
+}
+
+// location of the devices, used when speaking time and date
+func (h *Hub) location() *time.Location {
+	if len(h.cfgOta.Timezone) == 0 {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(h.cfgOta.Timezone)
+	if err != nil {
+		return time.Local
+	}
+
+	return loc
+}
+
+// addSession makes s the session of its device, replacing the one of a
+// previous connection
+func (h *Hub) addSession(s *Session) {
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+
+	h.sessionMap.Set(s.deviceId, s)
+}
+
+// removeSession removes s when it ends, unless its device has reconnected
+// meanwhile and the new session replaced it
+func (h *Hub) removeSession(s *Session) {
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+
+	if current, ok := h.sessionMap.Get(s.deviceId); ok && current == s {
+		h.sessionMap.Del(s.deviceId)
+	}
+}
+
 func (h *Hub) Run(ctx context.Context) error {
 	time.Sleep(100000 * time.Second) // Simulate long-running process
 	// 启动 Hub 的逻辑
@@ -62,6 +190,9 @@ func (h *Hub) Run(ctx context.Context) error {
 
 func (h *Hub) Shutdown(ctx context.Context) error {
 	// 停止 Hub 的逻辑
+	if h.localTts != nil {
+		h.localTts.Close()
+	}
 	return nil
 }
 
@@ -70,6 +201,7 @@ func (h *Hub) Hook(srv *server.Hertz) {
 
 	srv.GET("/health", utils.HealthCheck())
 	srv.POST("/xiaozhi/ota/", otaHandler(h))
+	srv.POST(VisionExplainPath, visionHandler(h))
 
 	// https: //github.com/cloudwego/hertz/issues/121
 	srv.GET("/xiaozhi/ws/", wsHandler(h))
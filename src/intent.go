@@ -0,0 +1,252 @@
+package src
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	IntentActionReply  = "reply"  // speak the reply only
+	IntentActionSystem = "system" // send a system command, e.g. reboot
+	IntentActionAlert  = "alert"  // show an alert on the device
+	IntentActionAbort  = "abort"  // stop speaking
+	IntentActionIot    = "iot"    // send an IoT command, e.g. set volume
+	IntentActionSpeech = "speech" // change the speech rate, gain or pitch
+)
+
+var weekdays = [...]string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+type intentRule struct {
+	config.IntentRule
+	patterns []*regexp.Regexp
+	keywords []string
+	reply    *template.Template
+}
+
+// IntentRouter matches recognized text against configured rules, so simple
+// commands are handled locally without a LLM round trip
+type IntentRouter struct {
+	rules []*intentRule
+}
+
+type Intent struct {
+	rule   *intentRule
+	Name   string
+	Action string
+	Text   string            // recognized text
+	Groups map[string]string // named groups of the matched pattern
+}
+
+// data available to reply templates
+type intentReplyData struct {
+	Text    string
+	Groups  map[string]string
+	Now     time.Time
+	Time    string // e.g. 15点04分
+	Date    string // e.g. 1月2日
+	Weekday string // e.g. 星期一
+}
+
+func NewIntentRouter(cfg *config.IntentConfig) (*IntentRouter, error) {
+	router := &IntentRouter{}
+	if cfg == nil || !cfg.Enable {
+		return router, nil
+	}
+
+	for _, rule := range cfg.Rules {
+		r := &intentRule{IntentRule: rule}
+
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern of intent %s", rule.Name)
+			}
+			r.patterns = append(r.patterns, re)
+		}
+
+		for _, keyword := range rule.Keywords {
+			if keyword = normalizeIntent(keyword); len(keyword) != 0 {
+				r.keywords = append(r.keywords, keyword)
+			}
+		}
+
+		if len(r.patterns) == 0 && len(r.keywords) == 0 {
+			return nil, errors.Errorf("intent %s has neither patterns nor keywords", rule.Name)
+		}
+
+		switch rule.Action {
+		case IntentActionReply:
+			if len(rule.Reply) == 0 {
+				return nil, errors.Errorf("intent %s replies nothing", rule.Name)
+			}
+		case IntentActionSystem:
+			if len(rule.Command) == 0 {
+				return nil, errors.Errorf("intent %s has no system command", rule.Name)
+			}
+		case IntentActionIot:
+			if rule.Iot == nil || len(rule.Iot.Name) == 0 || len(rule.Iot.Method) == 0 {
+				return nil, errors.Errorf("intent %s has no IoT command", rule.Name)
+			}
+		case IntentActionSpeech:
+			if rule.Speech == nil {
+				return nil, errors.Errorf("intent %s has no speech change", rule.Name)
+			}
+		case IntentActionAlert, IntentActionAbort:
+		default:
+			return nil, errors.Errorf("unknown action %q of intent %s", rule.Action, rule.Name)
+		}
+
+		if len(rule.Reply) != 0 {
+			tmpl, err := template.New(rule.Name).Parse(rule.Reply)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid reply of intent %s", rule.Name)
+			}
+			r.reply = tmpl
+		}
+
+		router.rules = append(router.rules, r)
+	}
+
+	return router, nil
+}
+
+// Match returns the intent of the first matched rule, or nil if text should be
+// answered by LLM
+func (r *IntentRouter) Match(text string) *Intent {
+	normalized := normalizeIntent(text)
+	if r == nil || len(normalized) == 0 {
+		return nil
+	}
+
+	for _, rule := range r.rules {
+		intent := &Intent{
+			rule:   rule,
+			Name:   rule.Name,
+			Action: rule.Action,
+			Text:   text,
+			Groups: make(map[string]string),
+		}
+
+		for _, re := range rule.patterns {
+			match := re.FindStringSubmatch(normalized)
+			if match == nil {
+				continue
+			}
+
+			for i, name := range re.SubexpNames() {
+				if len(name) != 0 {
+					intent.Groups[name] = match[i]
+				}
+			}
+			return intent
+		}
+
+		for _, keyword := range rule.keywords {
+			if strings.Contains(normalized, keyword) {
+				return intent
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reply renders the reply template of the intent, empty if it has none
+func (i *Intent) Reply(now time.Time) (string, error) {
+	if i.rule.reply == nil {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	err := i.rule.reply.Execute(&sb, intentReplyData{
+		Text:    i.Text,
+		Groups:  i.Groups,
+		Now:     now,
+		Time:    now.Format("15点04分"),
+		Date:    now.Format("1月2日"),
+		Weekday: weekdays[now.Weekday()],
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to render reply of intent %s", i.Name)
+	}
+
+	return sb.String(), nil
+}
+
+// handleIntent runs the action of intent, the reply is spoken through the same
+// path as LLM answers
+func (s *Session) handleIntent(t *turn, intent *Intent, llmResponseCh chan<- llmTurnResponse) error {
+	log.Info().Msgf("Intent %s matched for device %s: %s", intent.Name, s.deviceId, intent.Text)
+
+	rule := intent.rule
+	switch intent.Action {
+	case IntentActionSystem:
+		if err := s.cmdSystem(rule.Command); err != nil {
+			return err
+		}
+	case IntentActionAlert:
+		if err := s.cmdAlert(rule.Status, rule.Message, rule.Emotion); err != nil {
+			return err
+		}
+	case IntentActionIot:
+		if err := s.cmdIot(rule.Iot.Name, rule.Iot.Method, rule.Iot.Parameters); err != nil {
+			return err
+		}
+	case IntentActionSpeech:
+		if err := s.adjustSpeech(rule.Speech); err != nil {
+			return err
+		}
+	case IntentActionAbort:
+		// playback of the previous turn was already stopped when this turn began
+		if err := s.cmdTTSAbort(); err != nil {
+			return err
+		}
+	}
+
+	reply, err := intent.Reply(time.Now().In(s.hub.location()))
+	if err != nil {
+		return err
+	}
+
+	if len(reply) != 0 {
+		go func() {
+			sendTurn(t, llmResponseCh, llmTurnResponse{t.id, &llm.LLMResponse{
+				Question: intent.Text,
+				Answer:   reply,
+				Err:      nil,
+			}})
+		}()
+	}
+
+	return nil
+}
+
+// lower case, punctuations become spaces and spaces are collapsed, so patterns
+// do not depend on how ASR punctuates
+func normalizeIntent(text string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r) {
+			space = true
+			continue
+		}
+
+		if space && sb.Len() != 0 {
+			sb.WriteByte(' ')
+		}
+		space = false
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,106 @@
+package src
+
+import (
+	"testing"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntentRouterDefaults(t *testing.T) {
+	router, err := NewIntentRouter(config.DefaultConfig().Intent)
+	assert.NoError(t, err)
+
+	stubs := []struct {
+		text   string
+		intent string
+	}{
+		{"现在几点了？", "time"},
+		{"What time is it?", "time"},
+		{"今天星期几", "date"},
+		{"重启一下。", "reboot"},
+		{"Reboot", "reboot"},
+		{"别说了！", "stop"},
+		{"Stop talking.", "stop"},
+		{"把音量调到高", "volume_high"},
+		{"Set the volume to high", "volume_high"},
+		{"声音调低", "volume_low"},
+		{"大声点", ""},
+		{"说慢一点", "slower"},
+		{"慢点说", "slower"},
+		{"Speak slower", "slower"},
+		{"说快点", "faster"},
+		{"说话轻一点", "softer"},
+		{"恢复正常语速", "normal_speech"},
+		{"给我讲个故事", ""},
+		{"几点钟开始的比赛呢", ""},
+		{"", ""},
+	}
+
+	for _, stub := range stubs {
+		intent := router.Match(stub.text)
+		if len(stub.intent) == 0 {
+			assert.Nil(t, intent, stub.text)
+			continue
+		}
+
+		if assert.NotNil(t, intent, stub.text) {
+			assert.Equal(t, stub.intent, intent.Name, stub.text)
+		}
+	}
+}
+
+func TestIntentReply(t *testing.T) {
+	router, err := NewIntentRouter(&config.IntentConfig{
+		Enable: true,
+		Rules: []config.IntentRule{
+			{
+				Name:     "weather",
+				Patterns: []string{`^(?P<city>\p{Han}+)天气怎么样$`},
+				Action:   IntentActionReply,
+				Reply:    "{{.Groups.city}}的天气我还查不到，现在是{{.Time}}，{{.Weekday}}。",
+			},
+			{
+				Name:     "hello",
+				Keywords: []string{"Hello there"},
+				Action:   IntentActionReply,
+				Reply:    "你好",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	intent := router.Match("北京天气怎么样？")
+	if assert.NotNil(t, intent) {
+		reply, err := intent.Reply(time.Date(2025, 1, 6, 9, 5, 0, 0, time.Local))
+		assert.NoError(t, err)
+		assert.Equal(t, "北京的天气我还查不到，现在是09点05分，星期一。", reply)
+	}
+
+	intent = router.Match("Well, hello, there!")
+	if assert.NotNil(t, intent) {
+		assert.Equal(t, "hello", intent.Name)
+	}
+}
+
+func TestIntentRouterInvalidRules(t *testing.T) {
+	stubs := []config.IntentRule{
+		{Name: "bad pattern", Patterns: []string{"("}, Action: IntentActionAbort},
+		{Name: "no matcher", Action: IntentActionAbort},
+		{Name: "no reply", Keywords: []string{"hi"}, Action: IntentActionReply},
+		{Name: "no command", Keywords: []string{"hi"}, Action: IntentActionSystem},
+		{Name: "no iot", Keywords: []string{"hi"}, Action: IntentActionIot},
+		{Name: "unknown", Keywords: []string{"hi"}, Action: "dance"},
+	}
+
+	for _, stub := range stubs {
+		_, err := NewIntentRouter(&config.IntentConfig{Enable: true, Rules: []config.IntentRule{stub}})
+		assert.Error(t, err, stub.Name)
+	}
+
+	router, err := NewIntentRouter(&config.IntentConfig{Enable: false, Rules: stubs})
+	assert.NoError(t, err)
+	assert.Nil(t, router.Match("hi"))
+}
@@ -0,0 +1,108 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/kb"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+func newKnowledgeManager(cfg *config.KnowledgeConfig) (*kb.Manager, error) {
+	m := kb.NewManager()
+	if cfg == nil {
+		return m, nil
+	}
+
+	for _, baseCfg := range cfg.Bases {
+		base := kb.NewKnowledgeBase(baseCfg.Name, baseCfg.Dir, cfg.ChunkSize)
+		if err := base.Load(); err != nil {
+			return nil, errors.Wrapf(err, "failed to load knowledge base %s", baseCfg.Name)
+		}
+
+		if err := m.Add(base); err != nil {
+			return nil, err
+		}
+		log.Info().Msgf("Knowledge base %s loaded with %d documents", baseCfg.Name, len(base.Sources()))
+	}
+
+	return m, nil
+}
+
+// Knowledge returns the knowledge bases shared by all devices
+func (h *Hub) Knowledge() *kb.Manager {
+	return h.knowledge
+}
+
+func (h *Hub) KnowledgeConfig() *config.KnowledgeConfig {
+	return h.cfgKnowledge
+}
+
+// knowledgeRetriever returns a function rendering the passages of the named
+// knowledge bases relevant to a question, nil if there is nothing to search
+func (h *Hub) knowledgeRetriever(names []string) func(question string) string {
+	cfg := h.cfgKnowledge
+	if len(names) == 0 || cfg == nil || cfg.TopK <= 0 {
+		return nil
+	}
+
+	return func(question string) string {
+		results := h.knowledge.Search(names, question, cfg.TopK, cfg.MinScore)
+		if len(results) == 0 {
+			return ""
+		}
+
+		return knowledgePrompt(cfg.Prompt, results)
+	}
+}
+
+// knowledgePrompt lists the passages with their sources, so the answer can
+// tell where it comes from
+func knowledgePrompt(intro string, results []kb.Result) string {
+	var sb strings.Builder
+	sb.WriteString(intro)
+
+	for i, r := range results {
+		source := r.Passage.Source
+		if len(r.Passage.Title) != 0 {
+			source = fmt.Sprintf("%s（%s）", source, r.Passage.Title)
+		}
+		fmt.Fprintf(&sb, "\n\n[%d] 来源：%s\n%s", i+1, source, r.Passage.Text)
+	}
+
+	return strings.TrimSpace(sb.String())
+}
+
+// withReference inserts reference as a system dialogue right before the
+// question, it is sent for this turn only and never kept in the dialogues
+func withReference(dialogues []llm.Dialogue, reference string) []llm.Dialogue {
+	if len(dialogues) == 0 {
+		return dialogues
+	}
+
+	last := len(dialogues) - 1
+	withRef := make([]llm.Dialogue, 0, len(dialogues)+1)
+	withRef = append(withRef, dialogues[:last]...)
+	withRef = append(withRef, llm.Dialogue{Role: llm.RoleSystem, Content: reference})
+	withRef = append(withRef, dialogues[last])
+
+	return withRef
+}
+
+// withReferenceInQuestion prepends reference to the question for agent
+// platforms, which only receive the latest user dialogue
+func withReferenceInQuestion(dialogues []llm.Dialogue, reference string) []llm.Dialogue {
+	if len(dialogues) == 0 {
+		return dialogues
+	}
+
+	last := len(dialogues) - 1
+	withRef := append([]llm.Dialogue(nil), dialogues...)
+	withRef[last].Content = reference + "\n\n问题：" + dialogues[last].Content
+
+	return withRef
+}
@@ -0,0 +1,72 @@
+package src
+
+import (
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/kb"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePersona(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Personas = map[string]*config.PersonaConfig{
+		"support": {SystemPrompt: "你是客服。", Knowledge: []string{"product"}},
+		"teacher": {SystemPrompt: "你是老师。"},
+	}
+	cfg.DefaultPersona = "support"
+
+	h, err := New(cfg)
+	assert.NoError(t, err)
+
+	p := h.resolvePersona("device-1")
+	assert.Equal(t, "support", p.Name)
+	assert.Equal(t, "你是客服。", p.SystemPrompt)
+	assert.Equal(t, []string{"product"}, p.Knowledge)
+
+	h.repo.SaveDeviceSettings(&types.DeviceSettings{DeviceId: "device-1", Persona: "teacher", Knowledge: []string{"math"}})
+	p = h.resolvePersona("device-1")
+	assert.Equal(t, "你是老师。", p.SystemPrompt)
+	assert.Equal(t, []string{"math"}, p.Knowledge)
+
+	h.repo.SaveDeviceSettings(&types.DeviceSettings{DeviceId: "device-1", Persona: "missing"})
+	p = h.resolvePersona("device-1")
+	assert.Equal(t, cfg.Llm.SystemPrompt, p.SystemPrompt)
+	assert.Empty(t, p.Knowledge)
+}
+
+func TestKnowledgeReference(t *testing.T) {
+	h, err := New(config.DefaultConfig())
+	assert.NoError(t, err)
+
+	base := kb.NewKnowledgeBase("product", "", 0)
+	assert.NoError(t, base.Ingest("manual.md", []byte("# 充电\n\n使用 Type-C 接口充电，约两小时充满。")))
+	assert.NoError(t, h.Knowledge().Add(base))
+
+	assert.Nil(t, h.knowledgeRetriever(nil))
+
+	retrieve := h.knowledgeRetriever([]string{"product"})
+	reference := retrieve("充电要多久")
+	assert.Contains(t, reference, "[1] 来源：manual.md（充电）\n使用 Type-C 接口充电，约两小时充满。")
+	assert.Empty(t, retrieve("今天天气怎么样"))
+
+	dialogues := withReference([]llm.Dialogue{
+		{Role: llm.RoleSystem, Content: "system"},
+		{Role: llm.RoleUser, Content: "充电要多久"},
+	}, reference)
+	if assert.Len(t, dialogues, 3) {
+		assert.Equal(t, llm.RoleSystem, dialogues[1].Role)
+		assert.Equal(t, reference, dialogues[1].Content)
+		assert.Equal(t, "充电要多久", dialogues[2].Content)
+	}
+
+	question := []llm.Dialogue{{Role: llm.RoleUser, Content: "充电要多久"}}
+	dialogues = withReferenceInQuestion(question, reference)
+	if assert.Len(t, dialogues, 1) {
+		assert.Equal(t, reference+"\n\n问题：充电要多久", dialogues[0].Content)
+	}
+	assert.Equal(t, "充电要多久", question[0].Content, "the kept dialogues are untouched")
+}
@@ -2,51 +2,210 @@ package src
 
 import (
 	"context"
+	"strings"
+	"sync"
 
 	"github.com/huairu-tech-com/xiaozhi-gogo/config"
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
-	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/openai"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/rs/zerolog/log"
 )
 
 type LlmProcessor struct {
 	ctx       context.Context
+	lock      sync.Mutex // serializes turns, dialogues are shared between them
 	dialogues []llm.Dialogue
+	knowledge func(question string) string // reference of a question, e.g. knowledge base passages
+	tools     *ToolRegistry                // tools LLM may call
+	window    *llm.Window                  // keeps dialogues within the token budget
 
 	llmSrv llm.LLM
 }
 
 func NewLlmProcessor(ctx context.Context,
-	llmConfig *config.DeepseekConfig,
+	llmConfig *config.LlmConfig,
+	llmSrv llm.LLM,
 ) *LlmProcessor {
 	c := &LlmProcessor{
 		ctx:       ctx,
 		dialogues: make([]llm.Dialogue, 0),
+		llmSrv:    llmSrv,
+	}
+
+	systemPrompt := llmConfig.SystemPrompt
+	if llmConfig.Emotion != nil && llmConfig.Emotion.Enable {
+		systemPrompt = strings.TrimSpace(systemPrompt + "\n\n" + emotionPrompt())
 	}
 
-	c.llmSrv = openai.NewOpenAI(
-		llmConfig.ApiKey,
-		llmConfig.BaseUrl,
-		llmConfig.Model)
+	if len(systemPrompt) != 0 {
+		c.dialogues = append(c.dialogues, llm.Dialogue{
+			Role:    llm.RoleSystem,
+			Content: systemPrompt,
+		})
+	}
+
+	var windowConfig llm.WindowConfig
+	if llmConfig.Context != nil {
+		windowConfig = llm.WindowConfig{
+			MaxTokens:        llmConfig.Context.MaxTokens,
+			KeepTurns:        llmConfig.Context.KeepTurns,
+			Summarize:        llmConfig.Context.Summarize,
+			SummaryMaxTokens: llmConfig.Context.SummaryMaxTokens,
+		}
+	}
+	// summarizing through an agent platform would pollute its conversation
+	var summarizer llm.LLM = c.llmSrv
+	if _, ok := c.llmSrv.(llm.Conversational); ok {
+		summarizer = nil
+	}
+	c.window = llm.NewWindow(windowConfig, summarizer)
 
 	return c
 }
 
-func (c *LlmProcessor) Push(question string) (string, error) {
+// Push asks question within ctx, which is cancelled when the user interrupts
+// the turn. The conversation is only changed once the question is answered,
+// so the next question does not follow an unanswered one and no turn is lost
+// to the budget. Trimmed turns are summarized in the background.
+func (c *LlmProcessor) Push(ctx context.Context, question string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	dialogue := llm.Dialogue{
 		Role:    llm.RoleUser,
 		Content: question,
 	}
-	c.dialogues = append(c.dialogues, dialogue)
+	kept, trimmed := c.window.Trim(append(c.dialogues[:len(c.dialogues):len(c.dialogues)], dialogue))
 
-	response, err := c.llmSrv.Response(c.ctx, c.dialogues)
+	dialogues := c.window.WithSummary(kept)
+	if c.knowledge != nil {
+		if reference := c.knowledge(question); len(reference) != 0 {
+			if _, ok := c.llmSrv.(llm.Conversational); ok {
+				dialogues = withReferenceInQuestion(dialogues, reference)
+			} else {
+				dialogues = withReference(dialogues, reference)
+			}
+		}
+	}
+
+	response, produced, err := c.respond(ctx, dialogues)
 	if err != nil {
 		return "", err
 	}
 
-	c.dialogues = append(c.dialogues, llm.Dialogue{
-		Role:    llm.RoleAssistant,
-		Content: response,
-	})
-
+	c.dialogues = append(kept, produced...)
+	if len(trimmed) != 0 {
+		go func() {
+			if err := c.window.Summarize(c.ctx, trimmed); err != nil {
+				log.Warn().Err(err).Msgf("Failed to summarize %d trimmed turns", len(trimmed))
+			}
+		}()
+	}
 	return response, nil
 }
+
+// respond returns the answer and the dialogues produced for it, which are the
+// tool calls and their results followed by the answer if tools are used
+func (c *LlmProcessor) respond(ctx context.Context, dialogues []llm.Dialogue) (string, []llm.Dialogue, error) {
+	toolLLM, ok := c.llmSrv.(llm.ToolLLM)
+	if !ok || len(c.tools.Tools()) == 0 {
+		response, err := c.llmSrv.Response(ctx, dialogues)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return response, []llm.Dialogue{{Role: llm.RoleAssistant, Content: response}}, nil
+	}
+
+	produced := make([]llm.Dialogue, 0)
+	for round := 0; ; round++ {
+		tools := c.tools.Tools()
+		if round == maxToolRounds {
+			tools = nil
+		}
+
+		answer, err := toolLLM.Chat(ctx, dialogues, tools)
+		if err != nil {
+			return "", nil, err
+		}
+
+		dialogues = append(dialogues, *answer)
+		produced = append(produced, *answer)
+		if len(answer.ToolCalls) == 0 {
+			return answer.Content, produced, nil
+		}
+
+		for _, call := range answer.ToolCalls {
+			result := llm.Dialogue{
+				Role:       llm.RoleTool,
+				Content:    c.tools.Call(ctx, call),
+				ToolCallId: call.Id,
+			}
+			dialogues = append(dialogues, result)
+			produced = append(produced, result)
+		}
+	}
+}
+
+// SetTools sets the tools LLM may call, they are used only if the provider
+// supports function calling
+func (c *LlmProcessor) SetTools(tools *ToolRegistry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.tools = tools
+}
+
+// SetKnowledge sets how the reference of a question is found, nil disables it
+func (c *LlmProcessor) SetKnowledge(knowledge func(question string) string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.knowledge = knowledge
+}
+
+// Restore appends turns of previous sessions after the system prompt, and
+// resumes the remote conversation of agent platforms
+func (c *LlmProcessor) Restore(turns []*types.Turn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, turn := range turns {
+		c.dialogues = append(c.dialogues,
+			llm.Dialogue{Role: llm.RoleUser, Content: turn.Question},
+			llm.Dialogue{Role: llm.RoleAssistant, Content: turn.Answer},
+		)
+	}
+
+	if conversational, ok := c.llmSrv.(llm.Conversational); ok && len(turns) != 0 {
+		conversational.SetConversationId(turns[len(turns)-1].ConversationId)
+	}
+}
+
+// ConversationId returns the remote conversation id if the provider keeps one
+func (c *LlmProcessor) ConversationId() string {
+	if conversational, ok := c.llmSrv.(llm.Conversational); ok {
+		return conversational.ConversationId()
+	}
+
+	return ""
+}
+
+// Reset drops everything but the system prompt
+func (c *LlmProcessor) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	i := 0
+	for i < len(c.dialogues) && c.dialogues[i].Role == llm.RoleSystem {
+		i += 1
+	}
+
+	c.dialogues = c.dialogues[:i]
+	c.window.Reset()
+
+	if conversational, ok := c.llmSrv.(llm.Conversational); ok {
+		conversational.SetConversationId("")
+	}
+}
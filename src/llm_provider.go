@@ -0,0 +1,221 @@
+package src
+
+import (
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/anthropic"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/dify"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/failover"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/ollama"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/openai"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	LlmProviderDeepseek  = "deepseek"
+	LlmProviderOpenAI    = "openai"
+	LlmProviderOllama    = "ollama"
+	LlmProviderAnthropic = "anthropic"
+	LlmProviderDify      = "dify"
+	LlmProviderFailover  = "failover"
+)
+
+// newLlmService builds the LLM client of a profile or a provider for a
+// device, an empty name means deepseek which was the only one supported at
+// first
+func (h *Hub) newLlmService(provider string, deviceId string) (llm.LLM, error) {
+	llmConfig := h.cfgLlm
+
+	if profile, ok := llmConfig.Profiles[provider]; ok && profile != nil {
+		return h.newLlmProfile(profile, deviceId)
+	}
+
+	switch provider {
+	case "", LlmProviderDeepseek, LlmProviderOpenAI:
+		if llmConfig.Deepseek == nil {
+			return nil, errors.New("deepseek LLM configuration cannot be nil")
+		}
+
+		return openai.NewOpenAI(
+			llmConfig.Deepseek.ApiKey,
+			llmConfig.Deepseek.BaseUrl,
+			llmConfig.Deepseek.Model), nil
+
+	case LlmProviderOllama:
+		if llmConfig.Ollama == nil {
+			return nil, errors.New("ollama LLM configuration cannot be nil")
+		}
+
+		return ollama.NewOllama(ollama.OllamaConfig{
+			BaseURL:   llmConfig.Ollama.BaseUrl,
+			Model:     llmConfig.Ollama.Model,
+			KeepAlive: llmConfig.Ollama.KeepAlive,
+			Options:   llmConfig.Ollama.Options,
+		}), nil
+
+	case LlmProviderAnthropic:
+		if llmConfig.Anthropic == nil {
+			return nil, errors.New("anthropic LLM configuration cannot be nil")
+		}
+
+		return anthropic.NewAnthropic(anthropic.AnthropicConfig{
+			BaseURL:   llmConfig.Anthropic.BaseUrl,
+			APIKey:    llmConfig.Anthropic.ApiKey,
+			Model:     llmConfig.Anthropic.Model,
+			MaxTokens: llmConfig.Anthropic.MaxTokens,
+			Version:   llmConfig.Anthropic.Version,
+		}), nil
+
+	case LlmProviderDify:
+		if llmConfig.Dify == nil {
+			return nil, errors.New("dify LLM configuration cannot be nil")
+		}
+
+		return dify.NewDify(dify.DifyConfig{
+			BaseURL: llmConfig.Dify.BaseUrl,
+			APIKey:  llmConfig.Dify.ApiKey,
+			User:    deviceId,
+			Inputs:  llmConfig.Dify.Inputs,
+		}), nil
+
+	case LlmProviderFailover:
+		return h.newLlmFailover(deviceId)
+	}
+
+	return nil, errors.Errorf("unknown LLM provider %s", provider)
+}
+
+// newLlmProfile builds the LLM client of a profile, generation parameters are
+// applied by every provider
+func (h *Hub) newLlmProfile(profile *config.LlmProfileConfig, deviceId string) (llm.LLM, error) {
+	gen := llm.GenerationConfig{
+		Temperature: profile.Temperature,
+		TopP:        profile.TopP,
+		MaxTokens:   profile.MaxTokens,
+		Stop:        profile.Stop,
+		Timeout:     profile.Timeout,
+		Headers:     profile.Headers,
+	}
+
+	switch profile.Provider {
+	case "", LlmProviderDeepseek, LlmProviderOpenAI:
+		return openai.NewOpenAIWithConfig(openai.OpenAIConfig{
+			ModelName:  profile.Model,
+			BaseURL:    profile.BaseUrl,
+			APIKey:     profile.ApiKey,
+			Generation: gen,
+		}), nil
+
+	case LlmProviderOllama:
+		return ollama.NewOllama(ollama.OllamaConfig{
+			BaseURL:    profile.BaseUrl,
+			Model:      profile.Model,
+			Options:    profile.Options,
+			Generation: gen,
+		}), nil
+
+	case LlmProviderAnthropic:
+		return anthropic.NewAnthropic(anthropic.AnthropicConfig{
+			BaseURL:    profile.BaseUrl,
+			APIKey:     profile.ApiKey,
+			Model:      profile.Model,
+			Generation: gen,
+		}), nil
+
+	case LlmProviderDify:
+		return dify.NewDify(dify.DifyConfig{
+			BaseURL:    profile.BaseUrl,
+			APIKey:     profile.ApiKey,
+			User:       deviceId,
+			Inputs:     profile.Options,
+			Generation: gen,
+		}), nil
+
+	case LlmProviderFailover:
+		return h.newLlmFailover(deviceId)
+	}
+
+	return nil, errors.Errorf("unknown LLM provider %s", profile.Provider)
+}
+
+// isLlmFailover reports whether the profile or provider is a failover chain
+func (h *Hub) isLlmFailover(name string) bool {
+	if profile, ok := h.cfgLlm.Profiles[name]; ok && profile != nil {
+		return profile.Provider == LlmProviderFailover
+	}
+
+	return name == LlmProviderFailover
+}
+
+// HasLlmProfile reports whether name is a configured profile
+func (h *Hub) HasLlmProfile(name string) bool {
+	profile, ok := h.cfgLlm.Profiles[name]
+	return ok && profile != nil
+}
+
+func (h *Hub) newLlmFailover(deviceId string) (llm.LLM, error) {
+	cfg := h.cfgLlm.Failover
+	if cfg == nil || len(cfg.Providers) == 0 {
+		return nil, errors.New("failover LLM configuration needs at least one provider")
+	}
+
+	providers := make([]failover.Provider, 0, len(cfg.Providers))
+	for _, name := range cfg.Providers {
+		if h.isLlmFailover(name) {
+			return nil, errors.New("failover LLM provider can not contain itself")
+		}
+
+		srv, err := h.newLlmService(name, deviceId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to build failover provider %s", name)
+		}
+
+		providers = append(providers, failover.Provider{
+			Name:   name,
+			LLM:    srv,
+			Health: h.llmHealth(name),
+		})
+	}
+
+	chain := failover.NewChain(failover.FailoverConfig{
+		MaxRetries:     cfg.MaxRetries,
+		Backoff:        cfg.Backoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		AttemptTimeout: cfg.AttemptTimeout,
+		Deadline:       cfg.Deadline,
+	}, providers...)
+
+	// agent platforms behind the chain keep their conversation id
+	if chain.Conversational() {
+		return &failover.ConversationalChain{Chain: chain}, nil
+	}
+
+	return chain, nil
+}
+
+// llmHealth returns the breaker and counters of a provider, shared by all
+// sessions so a broken provider is skipped everywhere
+func (h *Hub) llmHealth(name string) *failover.Health {
+	threshold, cooldown := 0, time.Duration(0)
+	if h.cfgLlm.Failover != nil {
+		threshold = h.cfgLlm.Failover.BreakerThreshold
+		cooldown = h.cfgLlm.Failover.BreakerCooldown
+	}
+
+	health, _ := h.llmHealthMap.GetOrInsert(name, failover.NewHealth(name, threshold, cooldown))
+	return health
+}
+
+// LlmStats returns the counters of every provider used by failover chains
+func (h *Hub) LlmStats() []failover.Stats {
+	stats := make([]failover.Stats, 0)
+	h.llmHealthMap.Range(func(_ string, health *failover.Health) bool {
+		stats = append(stats, health.Stats())
+		return true
+	})
+
+	return stats
+}
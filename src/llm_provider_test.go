@@ -0,0 +1,68 @@
+package src
+
+import (
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/anthropic"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/openai"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLlmProfiles(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Llm.Profile = "voice"
+	cfg.Llm.Profiles = map[string]*config.LlmProfileConfig{
+		"voice": {Provider: "deepseek", Model: "deepseek-chat", MaxTokens: 256},
+		"story": {Provider: "anthropic", Model: "claude-test", MaxTokens: 4096},
+	}
+	cfg.Personas = map[string]*config.PersonaConfig{
+		"storyteller": {Profile: "story"},
+	}
+
+	h, err := New(cfg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "voice", h.resolvePersona("device-1").Profile)
+	srv, err := h.newLlmService("voice", "device-1")
+	assert.NoError(t, err)
+	assert.IsType(t, &openai.OpenAI{}, srv)
+
+	h.repo.SaveDeviceSettings(&types.DeviceSettings{DeviceId: "device-1", Persona: "storyteller"})
+	assert.Equal(t, "story", h.resolvePersona("device-1").Profile)
+	srv, err = h.newLlmService("story", "device-1")
+	assert.NoError(t, err)
+	assert.IsType(t, &anthropic.Anthropic{}, srv)
+
+	h.repo.SaveDeviceSettings(&types.DeviceSettings{DeviceId: "device-1", Persona: "storyteller", Profile: "voice"})
+	assert.Equal(t, "voice", h.resolvePersona("device-1").Profile, "device settings win")
+
+	// profiles are optional, the provider is used without them
+	h, err = New(config.DefaultConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "deepseek", h.resolvePersona("device-1").Profile)
+}
+
+func TestLlmProfilesChecked(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Llm.Profile = "missing"
+	_, err := New(cfg)
+	assert.Error(t, err)
+
+	cfg = config.DefaultConfig()
+	cfg.Personas = map[string]*config.PersonaConfig{"teacher": {Profile: "missing"}}
+	_, err = New(cfg)
+	assert.Error(t, err)
+
+	cfg = config.DefaultConfig()
+	cfg.Llm.Profiles = map[string]*config.LlmProfileConfig{
+		"chain": {Provider: "failover"},
+	}
+	cfg.Llm.Failover.Providers = []string{"chain"}
+	h, err := New(cfg)
+	assert.NoError(t, err)
+	_, err = h.newLlmService("chain", "device-1")
+	assert.Error(t, err, "failover can not contain itself")
+}
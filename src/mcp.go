@@ -0,0 +1,62 @@
+package src
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	mcpJsonRpcVersion   = "2.0"
+	mcpInitializeId     = 1
+	mcpInitializeMethod = "initialize"
+)
+
+type McpVisionCapability struct {
+	Url   string `json:"url"`   // URL of the vision explain endpoint
+	Token string `json:"token"` // bearer token of the endpoint
+}
+
+type McpCapabilities struct {
+	Vision *McpVisionCapability `json:"vision,omitempty"` // photo explaining of camera equipped devices
+}
+
+type McpInitializeParams struct {
+	Capabilities McpCapabilities `json:"capabilities"`
+}
+
+type McpRequest struct {
+	JsonRpc string `json:"jsonrpc"`
+	Id      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// mcpInitialize starts the MCP session of devices declaring the mcp feature in
+// hello, the capabilities of the server, e.g. vision, are advertised here
+func (s *Session) mcpInitialize() error {
+	var params McpInitializeParams
+	if s.hub.visionEnabled() {
+		params.Capabilities.Vision = &McpVisionCapability{
+			Url:   s.hub.cfgVision.Url,
+			Token: s.hub.visionToken(),
+		}
+	}
+
+	return s.cmdMcp(McpRequest{
+		JsonRpc: mcpJsonRpcVersion,
+		Id:      mcpInitializeId,
+		Method:  mcpInitializeMethod,
+		Params:  params,
+	})
+}
+
+// handleMcp receives the answers of the device to MCP requests, they are only
+// logged for now
+func (s *Session) handleMcp(raw []byte) error {
+	msg, err := MessageFromBytes[Mcp](raw)
+	if err != nil {
+		return err
+	}
+
+	log.Debug().Msgf("MCP message of device %s: %s", s.deviceId, string(msg.Payload))
+	return nil
+}
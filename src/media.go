@@ -0,0 +1,467 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/media"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// frames of a track queued ahead in the scheduler, about what is lost when the
+// playback is interrupted and resumed
+const mediaQueuedFrames = 10
+
+var errNothingPlayed = errors.New("nothing has been played")
+
+type mediaArguments struct {
+	Query string `json:"query"`
+}
+
+// newMediaLibrary indexes the media directory, nil if media is disabled
+func newMediaLibrary(cfg *config.MediaConfig) (*media.Library, error) {
+	if cfg == nil || !cfg.Enable {
+		return nil, nil
+	}
+
+	library := media.NewLibrary(cfg.Dir)
+	if err := library.Scan(); err != nil {
+		return nil, errors.Wrapf(err, "failed to index media directory %s", cfg.Dir)
+	}
+
+	log.Info().Msgf("Media library %s indexed with %d tracks", cfg.Dir, len(library.Tracks()))
+	return library, nil
+}
+
+// MediaPlayer plays tracks of the media library on a device. The playback is
+// paused whenever the user talks to the device and can be resumed from about
+// where it stopped, a track starts once the answer announcing it is spoken.
+type MediaPlayer struct {
+	library   *media.Library
+	scheduler *AudioScheduler
+	onStart   func(track *media.Track) error // the device starts playing
+	onStop    func() error                   // the device is done playing
+
+	mu      sync.Mutex
+	track   *media.Track       // current track, nil if none was played
+	stream  *mediaStream       // position in track, nil if it starts over
+	pending bool               // track starts or resumes with Start
+	playing bool               // frames of track are being sent
+	gen     uint64             // incremented by every Start
+	cancel  context.CancelFunc // stops the producer
+	done    chan struct{}      // closed when the producer returns
+}
+
+func NewMediaPlayer(library *media.Library, scheduler *AudioScheduler, onStart func(track *media.Track) error, onStop func() error) *MediaPlayer {
+	return &MediaPlayer{
+		library:   library,
+		scheduler: scheduler,
+		onStart:   onStart,
+		onStop:    onStop,
+	}
+}
+
+// Play makes track the current one, it starts with Start
+func (p *MediaPlayer) Play(track *media.Track) {
+	p.Pause()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closeStream()
+	p.track = track
+	p.pending = true
+}
+
+// Next plays the track following the current one in its category
+func (p *MediaPlayer) Next() (*media.Track, error) {
+	current, _ := p.Current()
+	if current == nil {
+		return nil, errNothingPlayed
+	}
+
+	next := p.library.Next(current)
+	if next == nil {
+		return nil, errors.Errorf("no track follows %s", current.Title)
+	}
+
+	p.Play(next)
+	return next, nil
+}
+
+// Resume continues the current track with Start, a finished track starts over
+func (p *MediaPlayer) Resume() (*media.Track, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.track == nil {
+		return nil, errNothingPlayed
+	}
+
+	p.pending = !p.playing
+	return p.track, nil
+}
+
+// Pause stops sending frames and reports whether the track was playing, the
+// frames already queued in the scheduler are left to the caller
+func (p *MediaPlayer) Pause() bool {
+	p.mu.Lock()
+	cancel, done, playing := p.cancel, p.done, p.playing
+	p.cancel, p.done = nil, nil
+	p.pending, p.playing = false, false
+	p.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	return playing
+}
+
+// Current returns the current track and whether it is playing
+func (p *MediaPlayer) Current() (*media.Track, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.track, p.playing
+}
+
+// Start sends the frames of the track played or resumed since the last call,
+// encoded for the device
+func (p *MediaPlayer) Start(ctx context.Context, sampleRate, frameDuration int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.pending {
+		return nil
+	}
+	p.pending = false
+
+	if p.stream == nil {
+		stream, err := openMediaStream(p.track, sampleRate, frameDuration)
+		if err != nil {
+			return err
+		}
+		p.stream = stream
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	p.playing = true
+	p.gen++
+
+	go p.produce(ctx, p.track, p.stream, p.gen, p.done, time.Duration(frameDuration)*time.Millisecond)
+	return nil
+}
+
+// Close stops the playback at the end of the session
+func (p *MediaPlayer) Close() {
+	p.Pause()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closeStream()
+}
+
+// produce keeps a few frames of stream queued in the scheduler, which paces
+// them, until the track ends or ctx is cancelled by Pause
+func (p *MediaPlayer) produce(ctx context.Context, track *media.Track, stream *mediaStream, gen uint64, done chan struct{}, frameDuration time.Duration) {
+	defer close(done)
+
+	p.scheduler.EnqueueCmd(func() error {
+		return p.onStart(track)
+	}, false)
+
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+
+	for {
+		if p.scheduler.Pending() >= mediaQueuedFrames {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		frame, err := stream.next()
+		if err != nil {
+			if err != io.EOF {
+				log.Error().Err(err).Msgf("Failed to play %s", track.Id)
+			}
+			p.finish(gen)
+			return
+		}
+
+		p.scheduler.Enqueue(frame)
+	}
+}
+
+// finish rewinds the track once its last frame is queued, the device stops
+// playing when it has been played
+func (p *MediaPlayer) finish(gen uint64) {
+	p.mu.Lock()
+	if p.gen == gen {
+		p.closeStream()
+	}
+	p.mu.Unlock()
+
+	p.scheduler.EnqueueCmd(func() error {
+		p.mu.Lock()
+		if p.gen == gen {
+			p.playing = false
+		}
+		p.mu.Unlock()
+
+		return p.onStop()
+	}, true)
+}
+
+func (p *MediaPlayer) closeStream() {
+	if p.stream != nil {
+		p.stream.Close()
+		p.stream = nil
+	}
+}
+
+// mediaStream encodes a track for the device frame by frame
+type mediaStream struct {
+	pcm     io.ReadCloser // resampled to the device
+	encoder *OpusEncoder
+	buf     []byte
+	frames  [][]byte // encoded but not yet returned
+	eof     bool
+}
+
+func openMediaStream(track *media.Track, sampleRate, frameDuration int) (*mediaStream, error) {
+	pcm, rate, err := media.Open(track.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := NewOpusEncoder(sampleRate, 1, frameDuration)
+	if err != nil {
+		pcm.Close()
+		return nil, err
+	}
+
+	return &mediaStream{
+		pcm:     utils.NewResampleReader(pcm, rate, sampleRate),
+		encoder: encoder,
+		buf:     make([]byte, 4096),
+	}, nil
+}
+
+// next returns the next Opus frame, io.EOF after the last one
+func (m *mediaStream) next() ([]byte, error) {
+	for len(m.frames) == 0 {
+		if m.eof {
+			return nil, io.EOF
+		}
+
+		n, err := m.pcm.Read(m.buf)
+		if n > 0 {
+			frames, err := m.encoder.Write(m.buf[:n])
+			if err != nil {
+				return nil, err
+			}
+			m.frames = append(m.frames, frames...)
+		}
+
+		if err == io.EOF {
+			m.eof = true
+			last, err := m.encoder.Flush()
+			if err != nil {
+				return nil, err
+			}
+			if len(last) != 0 {
+				m.frames = append(m.frames, last)
+			}
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to read media")
+		}
+	}
+
+	frame := m.frames[0]
+	m.frames = m.frames[1:]
+	return frame, nil
+}
+
+func (m *mediaStream) Close() {
+	m.pcm.Close()
+	m.encoder.Close()
+}
+
+// startMedia starts the track played or resumed during the turn, once its
+// answer has been spoken
+func (s *Session) startMedia() {
+	if s.player == nil {
+		return
+	}
+
+	params := downlinkAudioParams(s.deviceAudioParams)
+	if err := s.player.Start(s.ctx, int(params.SampleRate), int(params.FrameDuration)); err != nil {
+		log.Error().Err(err).Msgf("Failed to start media for device %s", s.deviceId)
+	}
+}
+
+// interruptMedia pauses the playback when the user talks or the device aborts
+func (s *Session) interruptMedia() error {
+	if s.player == nil || !s.player.Pause() {
+		return nil
+	}
+
+	s.scheduler.Flush()
+	s.outbox.DropSpeech()
+	if err := s.cmdTTSAbort(); err != nil {
+		return err
+	}
+	s.fire(SessionEventAbort)
+	return nil
+}
+
+// registerMediaTools lets LLM search and play the media library, the playback
+// is always paused when a turn begins so pausing only confirms it
+func (s *Session) registerMediaTools(registry *ToolRegistry) {
+	if s.player == nil {
+		return
+	}
+
+	query := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{"type": "string", "description": "words of the title or category, e.g. 小星星 or 睡前故事, empty for anything"},
+		},
+	}
+
+	registry.Register(llm.Tool{
+		Name:        "search_media",
+		Description: "Search the local library of songs, nursery rhymes and stories, returns the matching titles.",
+		Parameters:  query,
+	}, s.searchMedia)
+
+	registry.Register(llm.Tool{
+		Name:        "play_media",
+		Description: "Play the best match of the local library of songs, nursery rhymes and stories. It starts right after your answer, so announce it in a few words.",
+		Parameters:  query,
+	}, s.playMedia)
+
+	noArguments := map[string]any{"type": "object", "properties": map[string]any{}}
+	registry.Register(llm.Tool{
+		Name:        "pause_media",
+		Description: "Pause the song or story being played.",
+		Parameters:  noArguments,
+	}, s.pauseMedia)
+
+	registry.Register(llm.Tool{
+		Name:        "resume_media",
+		Description: "Resume the paused song or story right after your answer.",
+		Parameters:  noArguments,
+	}, s.resumeMedia)
+
+	registry.Register(llm.Tool{
+		Name:        "next_media",
+		Description: "Play the next song or story of the same category right after your answer.",
+		Parameters:  noArguments,
+	}, s.nextMedia)
+}
+
+func (s *Session) searchMedia(ctx context.Context, arguments string) (string, error) {
+	args, err := parseMediaArguments(arguments)
+	if err != nil {
+		return "", err
+	}
+
+	tracks := s.player.library.Search(args.Query, s.hub.cfgMedia.MaxResults)
+	if len(tracks) == 0 {
+		return "no track found", nil
+	}
+
+	var sb strings.Builder
+	for _, track := range tracks {
+		fmt.Fprintf(&sb, "- %s\n", describeTrack(track))
+	}
+
+	return sb.String(), nil
+}
+
+func (s *Session) playMedia(ctx context.Context, arguments string) (string, error) {
+	args, err := parseMediaArguments(arguments)
+	if err != nil {
+		return "", err
+	}
+
+	tracks := s.player.library.Search(args.Query, 1)
+	if len(tracks) == 0 {
+		return "no track found", nil
+	}
+
+	s.player.Play(tracks[0])
+	return fmt.Sprintf("%s will be played after your answer", describeTrack(tracks[0])), nil
+}
+
+func (s *Session) pauseMedia(ctx context.Context, arguments string) (string, error) {
+	track, _ := s.player.Current()
+	if track == nil {
+		return "", errNothingPlayed
+	}
+
+	s.player.Pause()
+	return fmt.Sprintf("%s paused", describeTrack(track)), nil
+}
+
+func (s *Session) resumeMedia(ctx context.Context, arguments string) (string, error) {
+	track, err := s.player.Resume()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s will be resumed after your answer", describeTrack(track)), nil
+}
+
+func (s *Session) nextMedia(ctx context.Context, arguments string) (string, error) {
+	track, err := s.player.Next()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s will be played after your answer", describeTrack(track)), nil
+}
+
+func describeTrack(track *media.Track) string {
+	if len(track.Category) == 0 {
+		return "《" + track.Title + "》"
+	}
+	return fmt.Sprintf("《%s》(%s)", track.Title, track.Category)
+}
+
+func parseMediaArguments(arguments string) (*mediaArguments, error) {
+	var args mediaArguments
+	if len(strings.TrimSpace(arguments)) == 0 {
+		return &args, nil
+	}
+
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return nil, errors.Wrapf(err, "invalid arguments %s", arguments)
+	}
+
+	args.Query = strings.TrimSpace(args.Query)
+	return &args, nil
+}
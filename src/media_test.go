@@ -0,0 +1,128 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/media"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeWav writes ms of 16kHz mono silence to dir/id
+func writeWav(t *testing.T, dir, id string, ms int) {
+	pcm := make([]byte, 16000*2*ms/1000)
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(16000), uint32(32000), uint16(2), uint16(16)} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+
+	path := filepath.Join(dir, filepath.FromSlash(id))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func newTestPlayer(t *testing.T, sent *sentLog) (*MediaPlayer, *AudioScheduler) {
+	dir := t.TempDir()
+	writeWav(t, dir, "儿歌/小星星.wav", 240)
+	writeWav(t, dir, "儿歌/两只老虎.wav", 3000)
+	library := media.NewLibrary(dir)
+	assert.NoError(t, library.Scan())
+
+	scheduler := NewAudioScheduler(60*time.Millisecond, 100*time.Millisecond, func(frame []byte) error {
+		sent.add("frame")
+		return nil
+	})
+
+	player := NewMediaPlayer(library, scheduler, func(track *media.Track) error {
+		sent.add("start " + track.Title)
+		return nil
+	}, func() error {
+		sent.add("stop")
+		return nil
+	})
+	t.Cleanup(player.Close)
+
+	return player, scheduler
+}
+
+func TestMediaPlayerPlays(t *testing.T) {
+	sent := &sentLog{start: time.Now()}
+	player, scheduler := newTestPlayer(t, sent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.Run(ctx)
+
+	track := player.library.Search("小星星", 1)[0]
+	player.Play(track)
+	_, playing := player.Current()
+	assert.False(t, playing, "waits for the answer to be spoken")
+
+	assert.NoError(t, player.Start(ctx, 16000, 60))
+	assert.Eventually(t, func() bool {
+		items, _ := sent.snapshot()
+		return len(items) != 0 && items[len(items)-1] == "stop"
+	}, time.Second, 5*time.Millisecond)
+
+	items, _ := sent.snapshot()
+	assert.Equal(t, []string{"start 小星星", "frame", "frame", "frame", "frame", "stop"}, items)
+	_, playing = player.Current()
+	assert.False(t, playing)
+
+	// the next track of the category
+	next, err := player.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "两只老虎", next.Title)
+}
+
+func TestMediaPlayerPauseResume(t *testing.T) {
+	sent := &sentLog{start: time.Now()}
+	player, scheduler := newTestPlayer(t, sent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.Run(ctx)
+
+	_, err := player.Resume()
+	assert.ErrorIs(t, err, errNothingPlayed)
+
+	player.Play(player.library.Search("两只老虎", 1)[0])
+	assert.NoError(t, player.Start(ctx, 16000, 60))
+	assert.Eventually(t, func() bool { return scheduler.Pending() >= mediaQueuedFrames }, time.Second, 5*time.Millisecond)
+
+	// frames are produced ahead of the scheduler by a few frames only
+	assert.True(t, player.Pause())
+	scheduler.Flush()
+	assert.False(t, player.Pause())
+	items, _ := sent.snapshot()
+	played := len(items)
+	assert.Less(t, played, 10)
+
+	track, err := player.Resume()
+	assert.NoError(t, err)
+	assert.Equal(t, "两只老虎", track.Title)
+	assert.NoError(t, player.Start(ctx, 16000, 60))
+	_, playing := player.Current()
+	assert.True(t, playing)
+
+	// resumed after the frames produced so far, not from the beginning
+	assert.Eventually(t, func() bool {
+		items, _ := sent.snapshot()
+		return len(items) != 0 && items[len(items)-1] == "stop"
+	}, 5*time.Second, 10*time.Millisecond)
+	items, _ = sent.snapshot()
+	assert.Less(t, len(items)-played, 50+2, "3s are 50 frames")
+}
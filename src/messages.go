@@ -1,6 +1,8 @@
 package src
 
 import (
+	"encoding/json"
+
 	"github.com/bytedance/sonic"
 )
 
@@ -20,6 +22,7 @@ const (
 	MessageTypeIOTDescribe      MessageType = "iot_describe"
 	MessageTypeIOTStates        MessageType = "iot_states"
 	MessageTypeLlm              MessageType = "llm"
+	MessageTypeMcp              MessageType = "mcp"
 )
 
 type AudioMode string
@@ -103,6 +106,10 @@ func (m MetaMessage) MessageType() MessageType {
 		return MessageTypeAbort
 	}
 
+	if m.Type == "mcp" {
+		return MessageTypeMcp
+	}
+
 	panic("invalid message type: " + m.Type)
 }
 func MessageFromBytes[T any](raw []byte) (*T, error) {
@@ -200,5 +207,14 @@ type IotStates struct {
 	MetaMessage
 	SEssionId string `json:"session_id"` // 会话ID
 }
+
+// MCP JSON-RPC message, payload is kept raw since it is either a request or a
+// response
+type Mcp struct {
+	MetaMessage
+	SessionId string          `json:"session_id"` // 会话ID
+	Payload   json.RawMessage `json:"payload"`    // JSON-RPC 消息
+}
+
 type DownHello struct {
 }
@@ -63,3 +63,21 @@ func TestIotDescribeMessageRecognize(t *testing.T) {
 	assert.Equal(t, MessageTypeIOTDescribe, m.MessageType(), "expected message type to be IOTDescribe")
 	assert.NotEmpty(t, m.MetaMessage.IotDescribe, "expected descriptors to be non-empty")
 }
+
+var mcpResponse = []byte(`
+{
+	"session_id": "<会话ID>",
+	"type": "mcp",
+	"payload": {"jsonrpc": "2.0", "id": 1, "result": {"serverInfo": {"name": "xiaozhi"}}}
+}
+`)
+
+func TestMcpMessageRecognize(t *testing.T) {
+	m, err := MessageFromBytes[MetaMessage](mcpResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, MessageTypeMcp, m.MessageType(), "expected message type to be MCP")
+
+	mcp, err := MessageFromBytes[Mcp](mcpResponse)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 1, "result": {"serverInfo": {"name": "xiaozhi"}}}`, string(mcp.Payload))
+}
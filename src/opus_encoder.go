@@ -0,0 +1,133 @@
+package src
+
+import (
+	"fmt"
+	"time"
+
+	opus "github.com/qrtc/opus-go"
+)
+
+// milliseconds of an Opus frame sent to devices not negotiating one
+const defaultOpusFrameDuration = 60
+
+// frame durations devices may negotiate in hello
+var opusFrameSizes = map[int]opus.FrameSizeType{
+	10: opus.Framesize10Ms,
+	20: opus.Framesize20Ms,
+	40: opus.Framesize40Ms,
+	60: opus.Framesize60Ms,
+}
+
+var opusSampleRates = map[int]bool{8000: true, 12000: true, 16000: true, 24000: true, 48000: true}
+
+// OpusEncoder encodes PCM as it arrives, a frame is emitted as soon as enough
+// samples of it have been written, the rest is kept for the next write
+type OpusEncoder struct {
+	encoder       *opus.OpusEncoder
+	sampleRate    int
+	frameDuration int    // milliseconds of a frame
+	frameBytes    int    // bytes of PCM of a frame
+	pending       []byte // samples not filling a frame yet
+}
+
+// NewOpusEncoder creates the encoder of frames of frameDuration milliseconds,
+// 0 means 60ms
+func NewOpusEncoder(sampleRate int, channels int, frameDuration int) (*OpusEncoder, error) {
+	// 检查采样率是否支持
+	if !opusSampleRates[sampleRate] {
+		return nil, fmt.Errorf("采样率 %dHz 不被Opus支持，仅支持8000/12000/16000/24000/48000Hz", sampleRate)
+	}
+
+	if frameDuration == 0 {
+		frameDuration = defaultOpusFrameDuration
+	}
+	frameSize, ok := opusFrameSizes[frameDuration]
+	if !ok {
+		return nil, fmt.Errorf("帧时长 %dms 不被支持，仅支持10/20/40/60ms", frameDuration)
+	}
+
+	encoder, err := opus.CreateOpusEncoder(&opus.OpusEncoderConfig{
+		SampleRate:    sampleRate,
+		MaxChannels:   channels,
+		Application:   opus.AppVoIP,
+		FrameDuration: frameSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
+	}
+
+	// 16位采样，每个样本 2 字节
+	return &OpusEncoder{
+		encoder:       encoder,
+		sampleRate:    sampleRate,
+		frameDuration: frameDuration,
+		frameBytes:    sampleRate * frameDuration / 1000 * 2 * channels,
+	}, nil
+}
+
+// FrameDuration is the time a frame plays on the device
+func (e *OpusEncoder) FrameDuration() time.Duration {
+	return time.Duration(e.frameDuration) * time.Millisecond
+}
+
+// Reset drops the samples not encoded yet, e.g. of an interrupted answer
+func (e *OpusEncoder) Reset() {
+	e.pending = nil
+}
+
+// Write appends pcm and returns the frames completed by it
+func (e *OpusEncoder) Write(pcm []byte) ([][]byte, error) {
+	e.pending = append(e.pending, pcm...)
+
+	var packets [][]byte
+	for len(e.pending) >= e.frameBytes {
+		packet, err := e.encode(e.pending[:e.frameBytes])
+		if err != nil {
+			return packets, err
+		}
+		e.pending = e.pending[e.frameBytes:]
+
+		if len(packet) != 0 {
+			packets = append(packets, packet)
+		}
+	}
+
+	// keep the backing array from growing with every write
+	if len(e.pending) == 0 {
+		e.pending = nil
+	}
+
+	return packets, nil
+}
+
+// Flush pads the remaining samples with silence to a last frame, nil if there
+// is none
+func (e *OpusEncoder) Flush() ([]byte, error) {
+	// 确保PCM数据长度是完整的样本
+	remaining := len(e.pending) - len(e.pending)%2
+	if remaining == 0 {
+		e.pending = nil
+		return nil, nil
+	}
+
+	frame := make([]byte, e.frameBytes)
+	copy(frame, e.pending[:remaining])
+	e.pending = nil
+
+	return e.encode(frame)
+}
+
+func (e *OpusEncoder) encode(frame []byte) ([]byte, error) {
+	// Opus编码后的数据通常比PCM小
+	out := make([]byte, len(frame))
+	n, err := e.encoder.Encode(frame, out)
+	if err != nil {
+		return nil, fmt.Errorf("Opus编码失败: %v", err)
+	}
+
+	return out[:n], nil
+}
+
+func (e *OpusEncoder) Close() {
+	e.encoder.Close()
+}
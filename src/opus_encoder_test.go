@@ -0,0 +1,93 @@
+package src
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpusEncoderIncremental(t *testing.T) {
+	encoder, err := NewOpusEncoder(16000, 1, 60)
+	assert.NoError(t, err)
+	defer encoder.Close()
+
+	// a 60ms frame of 16kHz mono is 1920 bytes
+	packets, err := encoder.Write(make([]byte, 1000))
+	assert.NoError(t, err)
+	assert.Empty(t, packets)
+
+	packets, err = encoder.Write(make([]byte, 1000))
+	assert.NoError(t, err)
+	assert.Len(t, packets, 1)
+
+	packets, err = encoder.Write(make([]byte, 1920*2))
+	assert.NoError(t, err)
+	assert.Len(t, packets, 2)
+
+	// the remaining 80 bytes are padded to a last frame
+	packet, err := encoder.Flush()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, packet)
+
+	packet, err = encoder.Flush()
+	assert.NoError(t, err)
+	assert.Nil(t, packet)
+
+	_, err = NewOpusEncoder(44100, 1, 60)
+	assert.Error(t, err)
+
+	_, err = NewOpusEncoder(16000, 1, 30)
+	assert.Error(t, err)
+}
+
+// stubStreamTTS delivers the PCM in chunks, like a chunked HTTP response
+type stubStreamTTS struct {
+	chunks [][]byte
+}
+
+func (s *stubStreamTTS) GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error) {
+	var pcm []byte
+	for _, chunk := range s.chunks {
+		pcm = append(pcm, chunk...)
+	}
+	return pcm, nil
+}
+
+func (s *stubStreamTTS) StreamAudio(ctx context.Context, text string, speed float32) (io.ReadCloser, error) {
+	r, w := io.Pipe()
+	go func() {
+		for _, chunk := range s.chunks {
+			w.Write(chunk)
+		}
+		w.Close()
+	}()
+	return r, nil
+}
+
+func TestTtsProcessorStreams(t *testing.T) {
+	stub := &stubStreamTTS{chunks: [][]byte{
+		make([]byte, 2000),
+		make([]byte, 100),
+		make([]byte, 3000),
+	}}
+	processor := NewTtsProcessor(context.Background(), &config.TtsConfig{}, stub)
+	defer processor.Close()
+
+	var frames int
+	err := processor.Speak(context.Background(), "你好", func(string) error { return nil }, func(opus []byte) error {
+		frames++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, frames) // 5100 bytes are 2 full frames and a padded one
+
+	// the error of onFrame stops synthesis
+	err = processor.Speak(context.Background(), "你好", func(string) error { return nil }, func(opus []byte) error {
+		return context.Canceled
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -50,11 +50,17 @@ type Firmware struct {
 	Url     string `json:"url"`     // URL to download the firmware
 }
 
+type Vision struct {
+	URL   string `json:"url"`   // URL of the vision explain endpoint
+	Token string `json:"token"` // bearer token of the endpoint
+}
+
 type OtaResponse struct {
-	MQTT       *MQTT      `json:"mqtt,omitempty"` // MQTT configuration
-	Websocket  Websocket  `json:"websocket"`      // WebSocket configuration
-	ServerTime ServerTime `json:"server_time"`    // Server time information
-	Firmware   Firmware   `json:"firmware"`       // Firmware information
+	MQTT       *MQTT      `json:"mqtt,omitempty"`   // MQTT configuration
+	Websocket  Websocket  `json:"websocket"`        // WebSocket configuration
+	ServerTime ServerTime `json:"server_time"`      // Server time information
+	Firmware   Firmware   `json:"firmware"`         // Firmware information
+	Vision     *Vision    `json:"vision,omitempty"` // Vision configuration of camera equipped devices
 }
 
 func otaHandler(h *Hub) app.HandlerFunc {
@@ -121,6 +127,13 @@ func otaHandler(h *Hub) app.HandlerFunc {
 			Url:     h.cfgOta.FirmwareUrl,
 		}
 
+		if h.visionEnabled() {
+			response.Vision = &Vision{
+				URL:   h.cfgVision.Url,
+				Token: h.visionToken(),
+			}
+		}
+
 		ctx.Header("Content-Type", "application/json")
 
 		json.NewEncoder(os.Stdout).Encode(response)
@@ -0,0 +1,153 @@
+package src
+
+import (
+	"sync"
+
+	"github.com/hertz-contrib/websocket"
+	"github.com/pkg/errors"
+)
+
+var ErrOutboxClosed = errors.New("session is closed")
+
+// outboundMessage is a websocket message waiting for the writer
+type outboundMessage struct {
+	messageType int
+	data        []byte
+	speech      bool // audio or command of the speech, dropped when it is interrupted
+}
+
+// Outbox queues the messages of a session for its only writer, websocket
+// connections do not allow concurrent writers. Messages are written in the
+// order they are pushed, so subtitles and the stop of the speech released by
+// the audio scheduler follow the audio before them. Out of band control
+// messages, e.g. alerts and aborts, are written ahead of the queue.
+type Outbox struct {
+	mu      sync.Mutex
+	control []outboundMessage // out of band, written first
+	queue   []outboundMessage
+	closed  bool
+	wake    chan struct{} // signals new messages or close
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Push queues a message after the ones pushed before it
+func (o *Outbox) Push(messageType int, data []byte) error {
+	return o.push(outboundMessage{messageType: messageType, data: data}, false)
+}
+
+// PushSpeech queues audio or a command of the speech, which DropSpeech drops
+// if it has not been written yet
+func (o *Outbox) PushSpeech(messageType int, data []byte) error {
+	return o.push(outboundMessage{messageType: messageType, data: data, speech: true}, false)
+}
+
+// PushControl queues a text message ahead of the messages waiting
+func (o *Outbox) PushControl(data []byte) error {
+	return o.push(outboundMessage{messageType: websocket.TextMessage, data: data}, true)
+}
+
+func (o *Outbox) push(msg outboundMessage, control bool) error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return ErrOutboxClosed
+	}
+
+	if control {
+		o.control = append(o.control, msg)
+	} else {
+		o.queue = append(o.queue, msg)
+	}
+	o.mu.Unlock()
+
+	o.signal()
+	return nil
+}
+
+// DropSpeech drops the speech not written yet, e.g. when the answer is
+// aborted, and returns how many messages were dropped
+func (o *Outbox) DropSpeech() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.dropSpeech()
+}
+
+func (o *Outbox) dropSpeech() int {
+	kept := o.queue[:0]
+	for _, msg := range o.queue {
+		if !msg.speech {
+			kept = append(kept, msg)
+		}
+	}
+
+	n := len(o.queue) - len(kept)
+	clear(o.queue[len(kept):])
+	o.queue = kept
+	return n
+}
+
+// Close refuses new messages, Run writes the messages still queued but the
+// speech and returns
+func (o *Outbox) Close() {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+
+	o.signal()
+}
+
+// Run writes the queued messages with write until Close or write fails
+func (o *Outbox) Run(write func(messageType int, data []byte) error) error {
+	for {
+		msg, ok, closed := o.next()
+		if closed {
+			return nil
+		}
+		if !ok {
+			<-o.wake
+			continue
+		}
+
+		if err := write(msg.messageType, msg.data); err != nil {
+			o.Close()
+			return err
+		}
+	}
+}
+
+// next returns the next message to write, control messages first. Once the
+// outbox is closed the speech is dropped and closed is set when no message
+// is left.
+func (o *Outbox) next() (msg outboundMessage, ok bool, closed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.control) != 0 {
+		msg, o.control = o.control[0], o.control[1:]
+		return msg, true, false
+	}
+
+	if o.closed {
+		o.dropSpeech()
+	}
+
+	if len(o.queue) != 0 {
+		msg, o.queue = o.queue[0], o.queue[1:]
+		return msg, true, false
+	}
+
+	return msg, false, o.closed
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
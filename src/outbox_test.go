@@ -0,0 +1,87 @@
+package src
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hertz-contrib/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// writtenLog records the messages written by the writer goroutine
+type writtenLog struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (w *writtenLog) write(messageType int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.messages = append(w.messages, string(data))
+	return nil
+}
+
+func (w *writtenLog) get() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]string(nil), w.messages...)
+}
+
+func TestOutboxOrder(t *testing.T) {
+	o := NewOutbox()
+	assert.NoError(t, o.PushSpeech(websocket.TextMessage, []byte("sentence 1")))
+	assert.NoError(t, o.PushSpeech(websocket.BinaryMessage, []byte("frame 1")))
+	assert.NoError(t, o.PushSpeech(websocket.TextMessage, []byte("sentence 2")))
+	assert.NoError(t, o.PushSpeech(websocket.BinaryMessage, []byte("frame 2")))
+	assert.NoError(t, o.Push(websocket.TextMessage, []byte("stt")))
+	assert.NoError(t, o.PushControl([]byte("alert")))
+
+	var written writtenLog
+	done := make(chan error)
+	go func() { done <- o.Run(written.write) }()
+
+	assert.Eventually(t, func() bool { return len(written.get()) == 6 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"alert", "sentence 1", "frame 1", "sentence 2", "frame 2", "stt"}, written.get(),
+		"only out of band messages skip the queue")
+
+	// messages pushed later wake the writer
+	assert.NoError(t, o.PushSpeech(websocket.TextMessage, []byte("stop")))
+	assert.Eventually(t, func() bool { return len(written.get()) == 7 }, time.Second, time.Millisecond)
+
+	o.Close()
+	assert.NoError(t, <-done)
+	assert.ErrorIs(t, o.Push(websocket.TextMessage, []byte("late")), ErrOutboxClosed)
+}
+
+func TestOutboxDropSpeech(t *testing.T) {
+	o := NewOutbox()
+	assert.NoError(t, o.PushSpeech(websocket.BinaryMessage, []byte("frame 1")))
+	assert.NoError(t, o.Push(websocket.TextMessage, []byte("stt")))
+	assert.NoError(t, o.PushSpeech(websocket.TextMessage, []byte("sentence")))
+	assert.NoError(t, o.PushSpeech(websocket.BinaryMessage, []byte("frame 2")))
+	assert.Equal(t, 3, o.DropSpeech())
+	assert.NoError(t, o.PushControl([]byte("stop")))
+
+	// closing writes the messages left and drops the speech
+	assert.NoError(t, o.PushSpeech(websocket.BinaryMessage, []byte("frame 3")))
+	o.Close()
+
+	var written writtenLog
+	assert.NoError(t, o.Run(written.write))
+	assert.Equal(t, []string{"stop", "stt"}, written.get())
+}
+
+func TestOutboxWriteFails(t *testing.T) {
+	o := NewOutbox()
+	assert.NoError(t, o.Push(websocket.TextMessage, []byte("hello")))
+
+	err := o.Run(func(int, []byte) error {
+		return errors.New("broken pipe")
+	})
+	assert.EqualError(t, err, "broken pipe")
+	assert.ErrorIs(t, o.Push(websocket.TextMessage, []byte("late")), ErrOutboxClosed, "the session is closed")
+}
@@ -0,0 +1,129 @@
+package src
+
+import (
+	"sort"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Persona is what a device behaves like, resolved from its settings, the
+// configured personas and the llm configuration in that order
+type Persona struct {
+	Name         string   `json:"name"`
+	SystemPrompt string   `json:"system_prompt"`
+	Profile      string   `json:"profile"` // LLM profile, or the provider if no profile is configured
+	Knowledge    []string `json:"knowledge"`
+	Tts          string   `json:"tts"`   // TTS provider
+	Voice        string   `json:"voice"` // preset or custom voice of the TTS provider
+
+	Speech tts.Options `json:"speech"` // rate, gain and pitch of the device
+}
+
+func (h *Hub) resolvePersona(deviceId string) *Persona {
+	p := &Persona{
+		Name:         h.defaultPersona,
+		SystemPrompt: h.cfgLlm.SystemPrompt,
+		Profile:      h.cfgLlm.Profile,
+		Tts:          h.cfgTts.Provider,
+	}
+
+	settings, err := h.repo.FindDeviceSettings(repo.WhereCondition{
+		"device_id": deviceId,
+	})
+	if err != nil && err != repo.ErrSettingsNotFound {
+		log.Error().Err(err).Msgf("Failed to find settings of device %s", deviceId)
+	}
+
+	if settings != nil && len(settings.Persona) != 0 {
+		p.Name = settings.Persona
+	}
+
+	if cfg, ok := h.cfgPersonas[p.Name]; ok && cfg != nil {
+		if len(cfg.SystemPrompt) != 0 {
+			p.SystemPrompt = cfg.SystemPrompt
+		}
+		if len(cfg.Profile) != 0 {
+			p.Profile = cfg.Profile
+		}
+		p.Knowledge = cfg.Knowledge
+		if len(cfg.Tts) != 0 {
+			p.Tts = cfg.Tts
+		}
+		if len(cfg.Voice) != 0 {
+			p.Voice = cfg.Voice
+		}
+	} else if len(p.Name) != 0 {
+		log.Warn().Msgf("Persona %s of device %s is not configured", p.Name, deviceId)
+	}
+
+	if settings != nil && len(settings.Knowledge) != 0 {
+		p.Knowledge = settings.Knowledge
+	}
+
+	if settings != nil && len(settings.Profile) != 0 {
+		p.Profile = settings.Profile
+	}
+
+	if settings != nil && len(settings.Tts) != 0 {
+		p.Tts = settings.Tts
+	}
+
+	if settings != nil && len(settings.Voice) != 0 {
+		p.Voice = settings.Voice
+	}
+
+	if settings != nil {
+		p.Speech = speechOf(settings)
+	}
+
+	if len(p.Profile) == 0 {
+		p.Profile = h.cfgLlm.Provider
+	}
+
+	return p
+}
+
+// Personas returns the configured personas
+func (h *Hub) Personas() []*Persona {
+	personas := make([]*Persona, 0, len(h.cfgPersonas))
+	for name, cfg := range h.cfgPersonas {
+		if cfg == nil {
+			continue
+		}
+
+		personas = append(personas, &Persona{
+			Name:         name,
+			SystemPrompt: cfg.SystemPrompt,
+			Profile:      cfg.Profile,
+			Knowledge:    cfg.Knowledge,
+			Tts:          cfg.Tts,
+			Voice:        cfg.Voice,
+		})
+	}
+
+	sort.Slice(personas, func(i, j int) bool {
+		return personas[i].Name < personas[j].Name
+	})
+
+	return personas
+}
+
+// checkLlmProfiles makes sure the profiles referenced by the configuration
+// exist, a typo would otherwise surface only when a device connects
+func (h *Hub) checkLlmProfiles() error {
+	if len(h.cfgLlm.Profile) != 0 && !h.HasLlmProfile(h.cfgLlm.Profile) {
+		return errors.Errorf("default LLM profile %s is not configured", h.cfgLlm.Profile)
+	}
+
+	for name, cfg := range h.cfgPersonas {
+		if cfg != nil && len(cfg.Profile) != 0 && !h.HasLlmProfile(cfg.Profile) {
+			return errors.Errorf("LLM profile %s of persona %s is not configured", cfg.Profile, name)
+		}
+	}
+
+	return nil
+}
@@ -3,24 +3,28 @@ package src
 import (
 	"context"
 	"fmt"
-	"net"
-	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/asr"
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/media"
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/hertz-contrib/websocket"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 )
 
 type ClientMessageHandler func([]byte) error
 
+// a device not reading its messages for that long is disconnected
+const writeTimeout = 10 * time.Second
+
 type Session struct {
 	conn *websocket.Conn
 	hub  *Hub
@@ -46,6 +50,24 @@ type Session struct {
 	asrProcessor *AsrProcessor
 	llmProcessor *LlmProcessor
 	ttsProcessor *TtsProcessor
+	scheduler    *AudioScheduler // paces audio and tts commands sent to the device
+	player       *MediaPlayer    // plays the media library, nil if disabled
+
+	outbox *Outbox // messages for the writer goroutine
+
+	speechMu sync.Mutex
+	speech   tts.Options // changed by voice commands and the admin API
+
+	factRefs factRefs // short references of the facts shown to LLM
+
+	announceWake  chan struct{} // signaled when announcements are handed to the session
+	announceReady bool          // hello is handled, guarded by the lock of the announcer
+	announcements []*delivery   // not started yet, guarded by the lock of the announcer
+
+	// the following are only accessed by the session loop
+	turn     *turn  // current turn, nil if the session is idle
+	turnSeq  uint64 // id of the last turn
+	speaking bool   // audio of the current turn is being sent
 
 	msgHandlers map[MessageType]ClientMessageHandler
 	ctx         context.Context
@@ -54,16 +76,24 @@ type Session struct {
 
 func newSession(ctx context.Context) *Session {
 	s := &Session{
-		msgHandlers: make(map[MessageType]ClientMessageHandler),
+		msgHandlers:  make(map[MessageType]ClientMessageHandler),
+		outbox:       NewOutbox(),
+		announceWake: make(chan struct{}, 1),
 	}
 
-	s.resetState(AudioModeNone)
+	s.state = newSessionState(s, kSessionStateConnecting)
+	s.state.ValidTransitions = sessionTransitions()
+	for kind := range s.state.ValidTransitions {
+		s.state.OnEnterCallbacks[kind] = []TransitionCallback{logTransition, countTransition}
+	}
 
 	s.msgHandlers[MessageTypeRawAudio] = s.handleAudio
 	s.msgHandlers[MessageTypeHello] = s.handleHello
 	s.msgHandlers[MessageTypeListenStart] = s.handleListenStart
 	s.msgHandlers[MessageTypeListenStop] = s.handleListenStop
 	s.msgHandlers[MessageTypeListenDetect] = s.handleListenDetect
+	s.msgHandlers[MessageTypeAbort] = s.handleAbort
+	s.msgHandlers[MessageTypeMcp] = s.handleMcp
 
 	s.ctx, s.cancel = context.WithCancel(ctx)
 
@@ -84,56 +114,166 @@ func (s *Session) populateDevice() error {
 }
 
 func (s *Session) loop() error {
-	var (
-		err      error
-		mt       int
-		rawBytes []byte
-	)
+	var err error
 
-	defer func() {
-		if (s.ctx.Err() != nil || err != nil) && s.cancel != nil {
+	// the writer is the only one writing to conn, it is stopped once the
+	// messages queued so far but the speech are written
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		if err := s.outbox.Run(s.write); err != nil {
+			log.Error().Err(err).Msgf("Failed to write to device %s: %v", s.deviceId, err)
 			s.cancel()
 		}
 	}()
 
+	inboundCh := make(chan inboundMessage)
+	go s.read(inboundCh)
+
+	defer func() {
+		if s.turn != nil {
+			if d := s.turn.announcement; d != nil {
+				s.hub.announcer.finish(d, errDeviceDisconnected)
+			}
+			s.turn.cancel()
+		}
+		s.hub.announcer.detach(s)
+		s.cancel() // stops the reader and the producers of the session
+
+		s.outbox.Close()
+		<-writerDone
+	}()
+
 	asrResponseCh := make(chan *asr.AsrResponse, 10) // buffered channel for ASR responses
 	s.asrProcessor, err = NewAsrProcessor(s.ctx, s.hub.cfgAsr, asrResponseCh)
 	if err != nil {
 		return err
 	}
-	llmResponseCh := make(chan *llm.LLMResponse, 10) // buffered channel for LLM responses
-	s.llmProcessor = NewLlmProcessor(s.ctx, s.hub.cfgLlm.Deepseek)
-	ttsResponseCh := make(chan *tts.TTSResponse, 10) // buffered channel for TTS responses
-	s.ttsProcessor = NewTtsProcessor(s.ctx, s.hub.cfgTts.CosyVoice)
+	llmResponseCh := make(chan llmTurnResponse, 10) // buffered channel for LLM responses
+	persona := s.hub.resolvePersona(s.deviceId)
+	llmSrv, err := s.hub.newLlmService(persona.Profile, s.deviceId)
+	if err != nil {
+		return err
+	}
+	llmConfig := *s.hub.cfgLlm
+	llmConfig.SystemPrompt = persona.SystemPrompt
+	if facts, err := s.hub.factsPrompt(s.deviceId, &s.factRefs); err != nil {
+		log.Error().Err(err).Msgf("Failed to list facts of device %s: %v", s.deviceId, err)
+	} else if len(facts) != 0 {
+		llmConfig.SystemPrompt = strings.TrimSpace(llmConfig.SystemPrompt + "\n\n" + facts)
+	}
+	s.llmProcessor = NewLlmProcessor(s.ctx, &llmConfig, llmSrv)
+	s.llmProcessor.SetKnowledge(s.hub.knowledgeRetriever(persona.Knowledge))
+
+	tools := NewToolRegistry()
+	s.registerFactTools(tools)
+	s.llmProcessor.SetTools(tools)
+	if err := s.restoreHistory(); err != nil {
+		log.Error().Err(err).Msgf("Failed to restore history for device %s: %v", s.deviceId, err)
+	}
+	ttsResponseCh := make(chan ttsTurnResponse, 10) // buffered channel for TTS responses
+	ttsSrv, err := s.hub.newTtsService(persona.Tts, persona.Voice, s.deviceId)
+	if err != nil {
+		return err
+	}
+	s.ttsProcessor = NewTtsProcessor(s.ctx, s.hub.cfgTts, ttsSrv)
+	s.setSpeech(persona.Speech)
+	defer s.ttsProcessor.Close()
+	if s.hub.ttsCache != nil {
+		s.ttsProcessor.SetCache(s.hub.ttsCache, s.hub.ttsCacheScope(persona.Tts, persona.Voice))
+	}
+	if err := s.applyAudioParams(); err != nil {
+		return err
+	}
+	if s.hub.media != nil {
+		s.player = NewMediaPlayer(s.hub.media, s.scheduler, func(track *media.Track) error {
+			if err := s.cmdTTSStart(); err != nil {
+				return err
+			}
+			s.fire(SessionEventTTSStart)
+			return s.cmdTTSSentenceStart("《" + track.Title + "》")
+		}, func() error {
+			s.fire(SessionEventTTSStop)
+			return s.cmdTTSStop()
+		})
+		defer s.player.Close()
+		s.registerMediaTools(tools)
+	}
+
+	playedCh := make(chan uint64, 1) // turns whose audio has been played
+	go func() {
+		if err := s.scheduler.Run(s.ctx); err != nil && s.ctx.Err() == nil {
+			log.Error().Err(err).Msgf("Failed to send audio to device %s: %v", s.deviceId, err)
+			s.cancel()
+		}
+	}()
 
 	for {
 		select {
 		case <-s.ctx.Done():
 			return s.ctx.Err()
 		case r := <-asrResponseCh:
+			if !r.IsFinish && len(r.Text) != 0 && s.speaking {
+				// the user talks over the answer
+				if err := s.abortTurn("barge_in"); err != nil {
+					return err
+				}
+				continue
+			}
+
 			if r.IsFinish && len(r.Text) != 0 {
+				s.fire(SessionEventAsrFinal)
+				t := s.beginTurn()
 				if err := s.cmdSTT(r.Text); err != nil {
 					log.Error().Err(err).Msgf("Failed to send STT command for device %s: %v", s.deviceId, err)
 					return err
 				}
 
+				if s.isForgetCommand(r.Text) {
+					go func() {
+						if err := s.forgetHistory(); err != nil {
+							log.Error().Err(err).Msgf("Failed to forget history for device %s: %v", s.deviceId, err)
+						}
+
+						sendTurn(t, llmResponseCh, llmTurnResponse{t.id, &llm.LLMResponse{
+							Question: r.Text,
+							Answer:   s.hub.cfgHistory.ForgetReply,
+							Err:      nil,
+						}})
+					}()
+					continue
+				}
+
+				if intent := s.hub.intentRouter.Match(r.Text); intent != nil {
+					if err := s.handleIntent(t, intent, llmResponseCh); err != nil {
+						log.Error().Err(err).Msgf("Failed to handle intent %s for device %s: %v", intent.Name, s.deviceId, err)
+						return err
+					}
+					continue
+				}
+
 				go func() {
-					resp, err := s.llmProcessor.Push(r.Text)
+					askedAt := time.Now()
+					resp, err := s.llmProcessor.Push(t.ctx, r.Text)
+					if t.ctx.Err() != nil {
+						return // aborted, nothing to answer
+					}
 					if err != nil {
 						log.Error().Err(err).Msgf("Failed to ask conversation for device %s: %v", s.deviceId, err)
-						llmResponseCh <- &llm.LLMResponse{
+						sendTurn(t, llmResponseCh, llmTurnResponse{t.id, &llm.LLMResponse{
 							Question: r.Text,
 							Answer:   "",
 							Err:      err,
-						}
+						}})
 						return
 					}
 
-					llmResponseCh <- &llm.LLMResponse{
+					s.saveTurn(r.Text, resp, askedAt)
+					sendTurn(t, llmResponseCh, llmTurnResponse{t.id, &llm.LLMResponse{
 						Question: r.Text,
 						Answer:   resp,
 						Err:      nil,
-					}
+					}})
 				}()
 
 				if err := s.cmdEmotion("thinking"); err != nil {
@@ -143,114 +283,245 @@ func (s *Session) loop() error {
 			}
 
 		case r := <-llmResponseCh:
-			fmt.Printf("LLM response received: %s", r.Answer)
-			if err := s.cmdTTSSentenceStart(r.Answer); err != nil {
-				return err
+			if !s.isCurrentTurn(r.turn) {
+				continue
 			}
+			t := s.turn
 
-			go func() {
-				resp, err := s.ttsProcessor.Push(r.Answer)
-				if err != nil {
-					ttsResponseCh <- &tts.TTSResponse{
-						Text:  r.Answer,
-						Audio: nil,
-						Err:   err,
+			if r.Err != nil {
+				// all providers failed, speak the fallback rather than keep the device waiting
+				if len(s.hub.cfgLlm.FallbackAnswer) == 0 {
+					if err := s.failTurn("llm_failed"); err != nil {
+						return err
 					}
+					continue
 				}
+				r.Answer = s.hub.cfgLlm.FallbackAnswer
+			}
 
-				opusData := make([]byte, 0)
-				for _, opus := range resp {
-					opusData = append(opusData, opus...)
-				}
+			emotion, answer := s.extractEmotion(r.Answer)
+			if err := s.cmdEmotion(string(emotion)); err != nil {
+				return err
+			}
 
-				os.WriteFile("/tmp/opus.opus", opusData, 0644)
+			r.Answer = answer
+			if len(r.Answer) == 0 {
+				s.startMedia()
+				continue
+			}
 
-				for i, opus := range resp {
-					ttsResponseCh <- &tts.TTSResponse{
-						IsEnd:   i == len(resp)-1,
-						IsStart: i == 0,
-						Text:    r.Answer,
-						Audio:   opus,
-						Err:     nil,
-					}
-				}
-			}()
+			log.Debug().Msgf("LLM response received for device %s: %s", s.deviceId, r.Answer)
+
+			go s.speak(t, r.Answer, ttsResponseCh)
 
 		case r, ok := <-ttsResponseCh:
 			if !ok {
 				return nil
 			}
 
-			if r.Err != nil {
-				return fmt.Errorf("failed to process TTS response: %w", r.Err)
+			if !s.isCurrentTurn(r.turn) {
+				continue // queued audio of an aborted turn
 			}
 
-			if r.IsStart {
-				if err := s.cmdTTSStart(); err != nil {
-					return err
+			if r.Err != nil {
+				// only the answer is lost, the device may ask again
+				log.Error().Err(r.Err).Msgf("Failed to synthesize answer of turn %d for device %s", r.turn, s.deviceId)
+				if d := s.turn.announcement; d != nil {
+					s.hub.announcer.finish(d, r.Err)
+					s.turn.announcement = nil
 				}
-
-				if err := s.cmdEmotion("happy"); err != nil {
+				if err := s.abortTurn("tts_failed"); err != nil {
 					return err
 				}
+				continue
 			}
 
-			println(len(r.Audio), r.IsEnd, r.Text)
-			if err := s.cmdAudio(r.Audio); err != nil {
-				return err
+			if r.IsStart {
+				s.scheduler.EnqueueCmd(s.cmdTTSStart, false)
+				s.speaking = true
+				s.fire(SessionEventTTSStart)
 			}
 
-			if r.IsEnd {
-				if err := s.cmdTTSStop(); err != nil {
-					return err
-				}
+			if r.sentence {
+				sentence := r.Text
+				s.scheduler.EnqueueCmd(func() error {
+					return s.cmdTTSSentenceStart(sentence)
+				}, false)
 			}
 
-		default:
-			s.conn.SetReadDeadline(time.Now().Add(time.Millisecond * 50))
-			mt, rawBytes, err = s.conn.ReadMessage()
-			if err != nil {
-				if ne, ok := err.(net.Error); ok && ne.Timeout() {
-					continue // ignore timeout errors
-				}
+			if len(r.Audio) != 0 {
+				s.scheduler.Enqueue(r.Audio)
+			}
 
-				log.Error().Err(err).Msgf("Failed to read message from device %s: %v", s.deviceId, err)
-				return err
+			if r.IsEnd {
+				// the device leaves speaking on stop, so it waits for the audio to be played
+				id := r.turn
+				s.scheduler.EnqueueCmd(func() error {
+					if err := s.cmdTTSStop(); err != nil {
+						return err
+					}
+					select {
+					case playedCh <- id:
+					case <-s.ctx.Done():
+					}
+					return nil
+				}, true)
 			}
 
-			var messagePayloadType MessageType = MessageTypeNone
-			if mt == websocket.TextMessage {
-				log.Debug().Msgf("XZ -> Server[T] %s: %s", s.deviceId, string(rawBytes))
+		case id := <-playedCh:
+			if s.isCurrentTurn(id) && s.speaking {
+				s.speaking = false
+				s.fire(SessionEventTTSStop)
+				if d := s.turn.announcement; d != nil {
+					s.turn.announcement = nil
+					s.hub.announcer.finish(d, nil)
+				}
 
-				var meta *MetaMessage
-				meta, err = MessageFromBytes[MetaMessage](rawBytes)
+				// announcements sent meanwhile come before the media
+				announcing, err := s.nextAnnouncement(ttsResponseCh)
 				if err != nil {
-					log.Error().Err(err).Msgf("Failed to parse message from device %s: %v, content is %s", s.deviceId, err, string(rawBytes))
 					return err
 				}
-				messagePayloadType = meta.MessageType()
+				if !announcing {
+					s.startMedia()
+				}
 			}
 
-			if mt == websocket.BinaryMessage {
-				// log.Debug().Msgf("XZ -> Server[B] %s len(message) is %d", s.deviceId, len(rawBytes))
-
-				messagePayloadType = MessageTypeRawAudio
+		case <-s.announceWake:
+			if _, err := s.nextAnnouncement(ttsResponseCh); err != nil {
+				return err
 			}
 
-			handler, ok := s.msgHandlers[messagePayloadType]
-			if !ok {
-				log.Error().Msgf("No handler found for message type %s from device %s", messagePayloadType, s.deviceId)
-				return fmt.Errorf("no handler found for message type %s from device %s", messagePayloadType, s.deviceId)
+		case msg := <-inboundCh:
+			if msg.err != nil {
+				log.Error().Err(msg.err).Msgf("Failed to read message from device %s: %v", s.deviceId, msg.err)
+				return msg.err
 			}
 
-			if err = handler(rawBytes); err != nil {
-				log.Error().Err(err).Msgf("Failed to handle message type %s from device %s: %v", messagePayloadType, s.deviceId, err)
-				return fmt.Errorf("failed to handle message type %s from device %s: %v", messagePayloadType, s.deviceId, err)
+			if err := s.handleMessage(msg.messageType, msg.data); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+// inboundMessage is a message read from the device, err ends the reader
+type inboundMessage struct {
+	messageType int
+	data        []byte
+	err         error
+}
+
+// read delivers the messages of the device to the session loop until reading
+// fails, which happens when conn is closed, or the session ends
+func (s *Session) read(inboundCh chan<- inboundMessage) {
+	for {
+		mt, data, err := s.conn.ReadMessage()
+		select {
+		case inboundCh <- inboundMessage{mt, data, err}:
+		case <-s.ctx.Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// write is only called by the writer goroutine, a device which stops reading
+// fails it after writeTimeout
+func (s *Session) write(messageType int, data []byte) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+
+	return s.conn.WriteMessage(messageType, data)
+}
+
+// handleMessage dispatches a message of the device to its handler
+func (s *Session) handleMessage(mt int, rawBytes []byte) error {
+	var messagePayloadType MessageType = MessageTypeNone
+	if mt == websocket.TextMessage {
+		log.Debug().Msgf("XZ -> Server[T] %s: %s", s.deviceId, string(rawBytes))
+
+		meta, err := MessageFromBytes[MetaMessage](rawBytes)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to parse message from device %s: %v, content is %s", s.deviceId, err, string(rawBytes))
+			return err
+		}
+		messagePayloadType = meta.MessageType()
+	}
+
+	if mt == websocket.BinaryMessage {
+		// log.Debug().Msgf("XZ -> Server[B] %s len(message) is %d", s.deviceId, len(rawBytes))
+
+		messagePayloadType = MessageTypeRawAudio
+	}
+
+	handler, ok := s.msgHandlers[messagePayloadType]
+	if !ok {
+		log.Error().Msgf("No handler found for message type %s from device %s", messagePayloadType, s.deviceId)
+		return fmt.Errorf("no handler found for message type %s from device %s", messagePayloadType, s.deviceId)
+	}
+
+	if err := handler(rawBytes); err != nil {
+		log.Error().Err(err).Msgf("Failed to handle message type %s from device %s: %v", messagePayloadType, s.deviceId, err)
+		return fmt.Errorf("failed to handle message type %s from device %s: %v", messagePayloadType, s.deviceId, err)
+	}
+
+	return nil
+}
+
+// speak synthesizes answer for turn t, the audio goes through the session
+// loop so it is dropped as soon as the turn is aborted
+func (s *Session) speak(t *turn, answer string, ttsResponseCh chan<- ttsTurnResponse) {
+	s.ttsProcessor.SetOptions(s.speechOptions())
+	started := false
+	err := s.ttsProcessor.Speak(t.ctx, answer, func(sentence string) error {
+		ok := sendTurn(t, ttsResponseCh, ttsTurnResponse{t.id, true, &tts.TTSResponse{
+			IsStart: !started,
+			Text:    sentence,
+			Audio:   nil,
+			Err:     nil,
+		}})
+		if !ok {
+			return t.ctx.Err()
+		}
+		started = true
+		return nil
+	}, func(opus []byte) error {
+		if !sendTurn(t, ttsResponseCh, ttsTurnResponse{t.id, false, &tts.TTSResponse{
+			Text:  answer,
+			Audio: opus,
+			Err:   nil,
+		}}) {
+			return t.ctx.Err()
+		}
+		return nil
+	})
+	if t.ctx.Err() != nil {
+		return // aborted, drop the audio
+	}
+	if err != nil {
+		sendTurn(t, ttsResponseCh, ttsTurnResponse{t.id, false, &tts.TTSResponse{
+			Text:  answer,
+			Audio: nil,
+			Err:   err,
+		}})
+		return
+	}
+
+	if started {
+		sendTurn(t, ttsResponseCh, ttsTurnResponse{t.id, false, &tts.TTSResponse{
+			IsEnd: true,
+			Text:  answer,
+			Audio: nil,
+			Err:   nil,
+		}})
+	}
+}
+
 // TODO
 func (s *Session) isAuthenticated() bool {
 	return true
@@ -269,31 +540,34 @@ func (s *Session) isSessionIdMatch(sessionId string) bool {
 	return s.sessionId == sessionId
 }
 
+// resetState applies the audio mode of listen start, which decides whether the
+// device listens again after speaking
 func (s *Session) resetState(newState AudioMode) error {
 	s.deviceAudioMode = newState
-	if s.deviceAudioMode == AudioModeNone {
-		s.state = newSessionState(s, kSessionStateIdle)
+	s.state.SetMode(newState)
+	return nil
+}
+
+// fire moves the state machine, events the current state does not expect are
+// logged and counted since the device and the server disagree on the state,
+// failures of the callbacks are returned
+func (s *Session) fire(event SessionEvent) error {
+	if s.state == nil {
+		return nil
 	}
 
-	// https://github.com/78/xiaozhi-esp32/blob/main/docs/websocket.md
-	if s.deviceAudioMode == AudioModeAuto {
-		s.state = newSessionState(s, kSessionStateListening)
-		s.state.ValidTransitions[kSessionStateIdle] = []SessionStateKind{kSessionStateConnecting}
-		s.state.ValidTransitions[kSessionStateConnecting] = []SessionStateKind{kSessionStateListening, kSessionStateIdle}
-		s.state.ValidTransitions[kSessionStateListening] = []SessionStateKind{kSessionStateSpeaking, kSessionStateIdle}
-		s.state.ValidTransitions[kSessionStateSpeaking] = []SessionStateKind{kSessionStateListening, kSessionStateIdle}
+	_, _, err := s.state.Fire(event)
+	if err == nil {
+		return nil
+	}
 
-		s.state.OnEnterCallbacks[kSessionStateIdle] = []TransitionCallback{
-			logTransition,
-		}
+	log.Warn().Err(err).Msgf("Session of device %s: %v", s.deviceId, err)
+	if !errors.Is(err, ErrInvalidSessionEvent) {
+		return err
 	}
 
-	if s.deviceAudioMode == AudioModeManual {
-		s.state = newSessionState(s, kSessionStateIdle)
-		s.state.ValidTransitions[kSessionStateIdle] = []SessionStateKind{kSessionStateConnecting, kSessionStateSpeaking, kSessionStateListening}
-		s.state.ValidTransitions[kSessionStateConnecting] = []SessionStateKind{kSessionStateListening, kSessionStateIdle}
-		s.state.ValidTransitions[kSessionStateListening] = []SessionStateKind{kSessionStateIdle}
-		s.state.ValidTransitions[kSessionStateSpeaking] = []SessionStateKind{kSessionStateIdle}
+	if s.hub != nil {
+		s.hub.sessionCounters.invalidEvent()
 	}
 	return nil
 }
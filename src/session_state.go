@@ -1,6 +1,11 @@
 package src
 
 import (
+	stderrors "errors"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/samber/lo"
@@ -15,30 +20,84 @@ const (
 	kSessionStateSpeaking   SessionStateKind = "speaking"
 )
 
+// SessionEvent is what happens to the session, it moves the state depending
+// on the current one and the audio mode of the device
+type SessionEvent string
+
+const (
+	SessionEventHello       SessionEvent = "hello"
+	SessionEventListenStart SessionEvent = "listen_start"
+	SessionEventListenStop  SessionEvent = "listen_stop"
+	SessionEventAsrFinal    SessionEvent = "asr_final"
+	SessionEventTTSStart    SessionEvent = "tts_start"
+	SessionEventTTSStop     SessionEvent = "tts_stop"
+	SessionEventAbort       SessionEvent = "abort"
+)
+
+var ErrInvalidSessionEvent = errors.New("invalid session event")
+
 type TransitionCallback func(s *Session, from SessionStateKind, to SessionStateKind) error
 
+// SessionState is the state machine of a session, it is safe for concurrent
+// use since audio commands are sent by the scheduler
 type SessionState struct {
-	s    *Session         // session is used to access session properties
-	kind SessionStateKind // kind can not be assign directly, use methods to change it
+	s *Session // session is used to access session properties
+
+	mu    sync.Mutex       // guards the fields below, held while callbacks run
+	kind  SessionStateKind // kind can not be assign directly, use methods to change it
+	since time.Time        // when kind was entered
+	mode  AudioMode        // audio mode of the last listen start
 
 	// the following transitions are valid for this state
 	ValidTransitions map[SessionStateKind][]SessionStateKind
-	OnEnterCallbacks map[SessionStateKind][]TransitionCallback // callbacks for transitions, key is from state
-	OnExitCallbacks  map[SessionStateKind][]TransitionCallback // callbacks for transitions, key is to state
-
+	OnEnterCallbacks map[SessionStateKind][]TransitionCallback // run once the key state is entered
+	OnExitCallbacks  map[SessionStateKind][]TransitionCallback // run before the key state is left, failing keeps it
 }
 
 func newSessionState(s *Session, kind SessionStateKind) *SessionState {
 	return &SessionState{
 		s:                s,
 		kind:             kind,
+		since:            time.Now(),
+		mode:             AudioModeNone,
 		ValidTransitions: make(map[SessionStateKind][]SessionStateKind),
 		OnEnterCallbacks: make(map[SessionStateKind][]TransitionCallback),
 		OnExitCallbacks:  make(map[SessionStateKind][]TransitionCallback),
 	}
 }
 
+// Kind returns the current state and since when the session is in it
+func (s *SessionState) Kind() (SessionStateKind, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.kind, s.since
+}
+
+// Mode returns the audio mode of the last listen start
+func (s *SessionState) Mode() AudioMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.mode
+}
+
+// SetMode changes the audio mode, which decides where speaking leads to
+func (s *SessionState) SetMode(mode AudioMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mode = mode
+}
+
 func (s *SessionState) IsValidTransition(to SessionStateKind) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isValidTransition(to)
+}
+
+func (s *SessionState) isValidTransition(to SessionStateKind) bool {
 	validTransitions, ok := s.ValidTransitions[s.kind]
 	if !ok {
 		return false
@@ -47,37 +106,224 @@ func (s *SessionState) IsValidTransition(to SessionStateKind) bool {
 	return lo.Contains(validTransitions, to)
 }
 
+// TransitTo moves to newState. The exit callbacks of the current state run
+// first and if any fails the state is kept, the enter callbacks of newState
+// run once it is entered. Callbacks must not use the state machine.
 func (s *SessionState) TransitTo(newState SessionStateKind) error {
-	if !s.IsValidTransition(newState) {
-		return errors.Errorf("invalid transition from %s to %s", s.kind, newState)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.transitTo(newState)
+}
+
+func (s *SessionState) transitTo(newState SessionStateKind) error {
+	from := s.kind
+	if !s.isValidTransition(newState) {
+		return errors.Errorf("invalid transition from %s to %s", from, newState)
+	}
+
+	var errs []error
+	for _, callback := range s.OnExitCallbacks[from] {
+		if err := callback(s.s, from, newState); err != nil {
+			errs = append(errs, errors.Wrapf(err, "callback for transition from %s to %s failed", from, newState))
+		}
+	}
+	if len(errs) != 0 {
+		return stderrors.Join(errs...)
+	}
+
+	s.kind = newState
+	s.since = time.Now()
+
+	for _, callback := range s.OnEnterCallbacks[newState] {
+		if err := callback(s.s, from, newState); err != nil {
+			errs = append(errs, errors.Wrapf(err, "callback for transition to %s failed", newState))
+		}
 	}
 
-	var err error
-	callbacks, ok := s.OnEnterCallbacks[s.kind]
+	return stderrors.Join(errs...)
+}
+
+// Fire moves the state as event requires and returns the state before and
+// after it. Events which do not apply to the current state are invalid and
+// leave it unchanged, events leading to the current state change nothing.
+func (s *SessionState) Fire(event SessionEvent) (SessionStateKind, SessionStateKind, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from := s.kind
+	to, ok := nextSessionState(from, event, s.mode)
 	if !ok {
-		return nil
+		return from, from, errors.Wrapf(ErrInvalidSessionEvent, "%s in state %s", event, from)
+	}
+
+	if to == from {
+		return from, to, nil
 	}
 
-	for _, callback := range callbacks {
-		callbackErr := callback(s.s, s.kind, newState)
-		err = errors.Wrapf(callbackErr, "callback for transition from %s to %s failed", s.kind, newState)
+	if err := s.transitTo(to); err != nil {
+		return from, s.kind, err
 	}
-	if err != nil {
-		return err
+	return from, to, nil
+}
+
+// nextSessionState returns the state event leads to from state from, false
+// if event is not expected in it
+func nextSessionState(from SessionStateKind, event SessionEvent, mode AudioMode) (SessionStateKind, bool) {
+	// the device keeps listening after speaking in auto and realtime modes
+	afterSpeaking := kSessionStateIdle
+	if mode == AudioModeAuto || mode == AudioModeRealtime {
+		afterSpeaking = kSessionStateListening
 	}
 
-	s.kind = newState
+	switch event {
+	case SessionEventHello:
+		return kSessionStateIdle, true // hello again starts over
+
+	case SessionEventListenStart:
+		return kSessionStateListening, from != kSessionStateConnecting
+
+	case SessionEventListenStop:
+		return kSessionStateIdle, from == kSessionStateListening || from == kSessionStateIdle
 
-	callbacks, ok = s.OnExitCallbacks[newState]
-	for _, callback := range callbacks {
-		callbackErr := callback(s.s, s.kind, newState)
-		err = errors.Wrapf(callbackErr, "callback for transition to %s failed", newState)
+	case SessionEventAsrFinal:
+		if from != kSessionStateListening && from != kSessionStateIdle {
+			return from, false
+		}
+		if mode == AudioModeManual {
+			return kSessionStateIdle, true // the question is complete
+		}
+		return from, true
+
+	case SessionEventTTSStart:
+		return kSessionStateSpeaking, from != kSessionStateConnecting
+
+	case SessionEventTTSStop, SessionEventAbort:
+		if from != kSessionStateSpeaking {
+			return from, event == SessionEventAbort // nothing to abort
+		}
+		return afterSpeaking, true
 	}
 
-	return err
+	return from, false
+}
+
+// sessionTransitions are the valid transitions of the session, no state
+// leads back to connecting
+func sessionTransitions() map[SessionStateKind][]SessionStateKind {
+	return map[SessionStateKind][]SessionStateKind{
+		kSessionStateConnecting: {kSessionStateIdle},
+		kSessionStateIdle:       {kSessionStateListening, kSessionStateSpeaking},
+		kSessionStateListening:  {kSessionStateIdle, kSessionStateSpeaking},
+		kSessionStateSpeaking:   {kSessionStateIdle, kSessionStateListening},
+	}
 }
 
 func logTransition(s *Session, from SessionStateKind, to SessionStateKind) error {
-	log.Info().Msgf("Session %s transitioned from %s to %s", s.sessionId, from, to)
+	log.Debug().Msgf("Session of device %s transitioned from %s to %s", s.deviceId, from, to)
 	return nil
 }
+
+// SessionInfo describes the session of a connected device
+type SessionInfo struct {
+	DeviceId   string           `json:"device_id"`
+	ClientId   string           `json:"client_id"`
+	State      SessionStateKind `json:"state"`
+	StateSince time.Time        `json:"state_since"`
+	AudioMode  AudioMode        `json:"audio_mode"`
+}
+
+// SessionMetrics counts the states of sessions
+type SessionMetrics struct {
+	Connected     int                        `json:"connected"`
+	States        map[SessionStateKind]int   `json:"states"`         // connected devices per state
+	Transitions   map[SessionStateKind]int64 `json:"transitions"`    // times states were entered since startup
+	InvalidEvents int64                      `json:"invalid_events"` // events ignored since startup
+}
+
+// sessionCounters counts transitions of all sessions since startup
+type sessionCounters struct {
+	mu          sync.Mutex
+	transitions map[SessionStateKind]int64
+	invalid     int64
+}
+
+func newSessionCounters() *sessionCounters {
+	return &sessionCounters{transitions: make(map[SessionStateKind]int64)}
+}
+
+func (c *sessionCounters) entered(kind SessionStateKind) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.transitions[kind]++
+}
+
+func (c *sessionCounters) invalidEvent() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalid++
+}
+
+func countTransition(s *Session, from SessionStateKind, to SessionStateKind) error {
+	if s.hub != nil {
+		s.hub.sessionCounters.entered(to)
+	}
+	return nil
+}
+
+// Sessions returns the sessions of the connected devices sorted by device id
+func (h *Hub) Sessions() []SessionInfo {
+	sessions := make([]SessionInfo, 0)
+	h.sessionMap.Range(func(deviceId string, s *Session) bool {
+		kind, since := s.state.Kind()
+		sessions = append(sessions, SessionInfo{
+			DeviceId:   deviceId,
+			ClientId:   s.clientId,
+			State:      kind,
+			StateSince: since,
+			AudioMode:  s.state.Mode(),
+		})
+		return true
+	})
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].DeviceId < sessions[j].DeviceId
+	})
+	return sessions
+}
+
+// SessionMetrics returns the states of the connected devices and the
+// transitions since startup
+func (h *Hub) SessionMetrics() *SessionMetrics {
+	metrics := &SessionMetrics{
+		States:      make(map[SessionStateKind]int),
+		Transitions: make(map[SessionStateKind]int64),
+	}
+
+	for _, s := range h.Sessions() {
+		metrics.Connected++
+		metrics.States[s.State]++
+	}
+
+	if c := h.sessionCounters; c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for kind, n := range c.transitions {
+			metrics.Transitions[kind] = n
+		}
+		metrics.InvalidEvents = c.invalid
+	}
+
+	return metrics
+}
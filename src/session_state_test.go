@@ -0,0 +1,125 @@
+package src
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cornelk/hashmap"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionStateEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   AudioMode
+		events []SessionEvent
+		want   []SessionStateKind
+	}{
+		{
+			"auto",
+			AudioModeAuto,
+			[]SessionEvent{SessionEventHello, SessionEventListenStart, SessionEventAsrFinal, SessionEventTTSStart, SessionEventTTSStop},
+			[]SessionStateKind{kSessionStateIdle, kSessionStateListening, kSessionStateListening, kSessionStateSpeaking, kSessionStateListening},
+		},
+		{
+			"manual",
+			AudioModeManual,
+			[]SessionEvent{SessionEventHello, SessionEventListenStart, SessionEventListenStop, SessionEventAsrFinal, SessionEventTTSStart, SessionEventTTSStop},
+			[]SessionStateKind{kSessionStateIdle, kSessionStateListening, kSessionStateIdle, kSessionStateIdle, kSessionStateSpeaking, kSessionStateIdle},
+		},
+		{
+			"abort",
+			AudioModeRealtime,
+			[]SessionEvent{SessionEventHello, SessionEventTTSStart, SessionEventAbort, SessionEventAbort},
+			[]SessionStateKind{kSessionStateIdle, kSessionStateSpeaking, kSessionStateListening, kSessionStateListening},
+		},
+		{
+			"invalid",
+			AudioModeManual,
+			[]SessionEvent{SessionEventListenStart, SessionEventTTSStart, SessionEventHello, SessionEventTTSStop, SessionEventTTSStart, SessionEventListenStop},
+			[]SessionStateKind{kSessionStateConnecting, kSessionStateConnecting, kSessionStateIdle, kSessionStateIdle, kSessionStateSpeaking, kSessionStateSpeaking},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSession(context.Background())
+			s.state.SetMode(tt.mode)
+
+			var got []SessionStateKind
+			for _, event := range tt.events {
+				s.fire(event)
+				kind, _ := s.state.Kind()
+				got = append(got, kind)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSessionStateTransitTo(t *testing.T) {
+	s := newSession(context.Background())
+	state := s.state
+
+	var entered []string
+	state.OnEnterCallbacks[kSessionStateIdle] = []TransitionCallback{
+		func(*Session, SessionStateKind, SessionStateKind) error {
+			entered = append(entered, "first")
+			return errors.New("first failed")
+		},
+		func(*Session, SessionStateKind, SessionStateKind) error {
+			entered = append(entered, "second")
+			return errors.New("second failed")
+		},
+	}
+
+	err := state.TransitTo(kSessionStateIdle)
+	assert.ErrorContains(t, err, "first failed")
+	assert.ErrorContains(t, err, "second failed")
+	assert.Equal(t, []string{"first", "second"}, entered, "every callback runs")
+	kind, _ := state.Kind()
+	assert.Equal(t, kSessionStateIdle, kind, "the state is entered without callbacks of the previous state")
+
+	state.OnExitCallbacks[kSessionStateIdle] = []TransitionCallback{
+		func(*Session, SessionStateKind, SessionStateKind) error {
+			return errors.New("busy")
+		},
+	}
+	assert.ErrorContains(t, state.TransitTo(kSessionStateListening), "busy")
+	kind, _ = state.Kind()
+	assert.Equal(t, kSessionStateIdle, kind, "failed exit keeps the state")
+
+	assert.Error(t, state.TransitTo(kSessionStateConnecting), "no state leads back to connecting")
+}
+
+func TestSessionMetrics(t *testing.T) {
+	h := &Hub{
+		sessionMap:      hashmap.New[string, *Session](),
+		sessionCounters: newSessionCounters(),
+	}
+
+	for _, deviceId := range []string{"b", "a"} {
+		s := newSession(context.Background())
+		s.hub = h
+		s.deviceId = deviceId
+		h.sessionMap.Set(deviceId, s)
+		s.fire(SessionEventHello)
+		if deviceId == "a" {
+			s.fire(SessionEventTTSStart)
+			s.fire(SessionEventListenStop) // not expected while speaking
+		}
+	}
+
+	sessions := h.Sessions()
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "a", sessions[0].DeviceId)
+	assert.Equal(t, kSessionStateSpeaking, sessions[0].State)
+	assert.Equal(t, kSessionStateIdle, sessions[1].State)
+
+	metrics := h.SessionMetrics()
+	assert.Equal(t, 2, metrics.Connected)
+	assert.Equal(t, map[SessionStateKind]int{kSessionStateIdle: 1, kSessionStateSpeaking: 1}, metrics.States)
+	assert.Equal(t, map[SessionStateKind]int64{kSessionStateIdle: 2, kSessionStateSpeaking: 1}, metrics.Transitions)
+	assert.Equal(t, int64(1), metrics.InvalidEvents)
+}
@@ -0,0 +1,85 @@
+package src
+
+import (
+	"math"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+// speechOf returns the speech options saved in the settings of a device
+func speechOf(settings *types.DeviceSettings) tts.Options {
+	return tts.Options{
+		Rate:  settings.Rate,
+		Gain:  settings.Gain,
+		Pitch: settings.Pitch,
+	}.Clamp()
+}
+
+// ApplySpeech changes the speech of the device if it is connected, the
+// answers from the next one are spoken with opts
+func (h *Hub) ApplySpeech(deviceId string, opts tts.Options) {
+	if s, ok := h.sessionMap.Get(deviceId); ok {
+		s.setSpeech(opts)
+	}
+}
+
+func (s *Session) setSpeech(opts tts.Options) {
+	s.speechMu.Lock()
+	defer s.speechMu.Unlock()
+
+	s.speech = opts.Clamp()
+}
+
+func (s *Session) speechOptions() tts.Options {
+	s.speechMu.Lock()
+	defer s.speechMu.Unlock()
+
+	return s.speech
+}
+
+// adjustSpeech applies a voice command changing the speech, the result is
+// saved in the settings of the device so it survives reconnections
+func (s *Session) adjustSpeech(change *config.IntentSpeechConfig) error {
+	settings, err := s.hub.repo.FindDeviceSettings(repo.WhereCondition{
+		"device_id": s.deviceId,
+	})
+	if err == repo.ErrSettingsNotFound {
+		settings, err = &types.DeviceSettings{DeviceId: s.deviceId}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the repository may hand out the stored settings, which others read
+	updated := *settings
+	if change.Reset {
+		updated.Rate, updated.Gain, updated.Pitch = 0, 0, 0
+	} else {
+		opts := speechOf(&updated)
+		// rounded so repeated steps come back to exactly normal
+		opts.Rate = float32(math.Round(float64(opts.Speed()+change.Rate)*100) / 100)
+		opts.Gain += change.Gain
+		opts.Pitch += change.Pitch
+		opts = opts.Clamp()
+		if opts.Rate == 1 {
+			opts.Rate = 0 // normal
+		}
+		updated.Rate, updated.Gain, updated.Pitch = opts.Rate, opts.Gain, opts.Pitch
+	}
+	updated.UpdatedAt = time.Now()
+
+	if err := s.hub.repo.SaveDeviceSettings(&updated); err != nil {
+		return err
+	}
+
+	s.setSpeech(speechOf(&updated))
+	log.Info().Msgf("Speech of device %s changed to rate %g, gain %g, pitch %g", s.deviceId, updated.Rate, updated.Gain, updated.Pitch)
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package src
+
+import (
+	"context"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdjustSpeech(t *testing.T) {
+	h, err := New(config.DefaultConfig())
+	assert.NoError(t, err)
+
+	s := newSession(context.Background())
+	s.hub = h
+	s.deviceId = "device-1"
+	h.sessionMap.Set(s.deviceId, s)
+
+	assert.NoError(t, s.adjustSpeech(&config.IntentSpeechConfig{Rate: -0.2}))
+	assert.NoError(t, s.adjustSpeech(&config.IntentSpeechConfig{Rate: -0.2, Gain: -4}))
+	assert.Equal(t, tts.Options{Rate: 0.6, Gain: -4}, s.speechOptions())
+	assert.Equal(t, tts.Options{Rate: 0.6, Gain: -4}, h.resolvePersona(s.deviceId).Speech, "saved in the settings")
+
+	// limited to what providers accept
+	for range 5 {
+		assert.NoError(t, s.adjustSpeech(&config.IntentSpeechConfig{Rate: -0.2}))
+	}
+	assert.Equal(t, tts.MinRate, s.speechOptions().Rate)
+
+	assert.NoError(t, s.adjustSpeech(&config.IntentSpeechConfig{Reset: true}))
+	assert.Equal(t, tts.Options{}, s.speechOptions())
+
+	// the admin API changes the speech of the connected device
+	h.repo.SaveDeviceSettings(&types.DeviceSettings{DeviceId: s.deviceId, Gain: -6})
+	h.ApplySpeech(s.deviceId, tts.Options{Gain: -6})
+	assert.Equal(t, tts.Options{Gain: -6}, s.speechOptions())
+
+	// the settings read by others are replaced rather than changed
+	before, err := h.repo.FindDeviceSettings(repo.WhereCondition{"device_id": s.deviceId})
+	assert.NoError(t, err)
+	assert.NoError(t, s.adjustSpeech(&config.IntentSpeechConfig{Rate: -0.2}))
+	assert.Equal(t, float32(0), before.Rate)
+	assert.Equal(t, tts.Options{Rate: 0.8, Gain: -6}, s.speechOptions())
+}
+
+// speedTTS records the speed of the last call
+type speedTTS struct {
+	speed float32
+}
+
+func (s *speedTTS) GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error) {
+	s.speed = speed
+	return []byte{0xe8, 0x03}, nil
+}
+
+func TestTtsProcessorOptions(t *testing.T) {
+	stub := &speedTTS{}
+	processor := NewTtsProcessor(context.Background(), &config.TtsConfig{Concurrency: 1}, stub)
+
+	processor.SetOptions(tts.Options{Rate: 0.8})
+	_, err := speakAll(processor, "你好。")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.8, stub.speed, 0.001)
+
+	// gain is applied to the PCM of providers which can not apply it
+	pcm, err := tts.Stream(context.Background(), stub, "你好", tts.Options{Gain: -6.0206})
+	assert.NoError(t, err)
+	buf := make([]byte, 2)
+	n, _ := pcm.Read(buf)
+	assert.Equal(t, []byte{0xf4, 0x01}, buf[:n])
+	assert.InDelta(t, 1, stub.speed, 0.001)
+}
@@ -0,0 +1,63 @@
+package src
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxToolRounds bounds how many times LLM may call tools in one turn, the
+// last round is sent without tools so it has to answer
+const maxToolRounds = 4
+
+// ToolHandler runs a tool with JSON encoded arguments, the returned text is
+// sent back to LLM as the result
+type ToolHandler func(ctx context.Context, arguments string) (string, error)
+
+// ToolRegistry holds the tools LLM may call in a session
+type ToolRegistry struct {
+	tools    []llm.Tool
+	handlers map[string]ToolHandler
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		handlers: make(map[string]ToolHandler),
+	}
+}
+
+func (r *ToolRegistry) Register(tool llm.Tool, handler ToolHandler) {
+	if _, ok := r.handlers[tool.Name]; !ok {
+		r.tools = append(r.tools, tool)
+	}
+	r.handlers[tool.Name] = handler
+}
+
+func (r *ToolRegistry) Tools() []llm.Tool {
+	if r == nil {
+		return nil
+	}
+
+	return r.tools
+}
+
+// Call runs the tool requested by call, errors are reported to LLM as the
+// result so it can tell the user
+func (r *ToolRegistry) Call(ctx context.Context, call llm.ToolCall) string {
+	handler, ok := r.handlers[call.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %s", call.Name)
+	}
+
+	result, err := handler(ctx, call.Arguments)
+	if err != nil {
+		log.Error().Err(err).Msgf("Tool %s failed with arguments %s", call.Name, call.Arguments)
+		return fmt.Sprintf("error: %v", err)
+	}
+
+	log.Debug().Msgf("Tool %s called with arguments %s: %s", call.Name, call.Arguments, result)
+	return result
+}
@@ -0,0 +1,108 @@
+package src
+
+import (
+	"context"
+	"strings"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/cache"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+func newTtsCache(cfg *config.TtsCacheConfig) (*cache.Cache, error) {
+	if cfg == nil || !cfg.Enable {
+		return nil, nil
+	}
+
+	return cache.New(cache.Config{
+		Dir:       cfg.Dir,
+		MaxMemory: cfg.MaxMemory,
+		MaxDisk:   cfg.MaxDisk,
+		TTL:       cfg.TTL,
+	})
+}
+
+// ttsCacheScope identifies the provider and the voice audio is synthesized
+// with, so cached audio is never spoken with another voice
+func (h *Hub) ttsCacheScope(provider, voice string) string {
+	if len(provider) == 0 {
+		provider = TtsProviderCosyVoice
+	}
+
+	voice = h.resolveVoice(provider, voice)
+	cfg := h.cfgTts
+	switch provider {
+	case TtsProviderCosyVoice:
+		if len(voice) == 0 && cfg.CosyVoice != nil {
+			voice = cfg.CosyVoice.Voice
+		}
+	case TtsProviderOpenAI:
+		if cfg.OpenAI != nil {
+			if len(voice) == 0 {
+				voice = cfg.OpenAI.Voice
+			}
+			voice = cfg.OpenAI.Model + "/" + voice
+		}
+	case TtsProviderDoubao:
+		if len(voice) == 0 && cfg.Doubao != nil {
+			voice = cfg.Doubao.Speaker
+		}
+	case TtsProviderLocal:
+		// the model is given by the arguments
+		if cfg.Local != nil {
+			voice = strings.Join(append([]string{cfg.Local.Command}, cfg.Local.Args...), " ")
+		}
+	}
+
+	return provider + ":" + voice
+}
+
+// PrewarmTtsCache synthesizes phrases with the voices of the default and the
+// configured personas, so they are spoken from the cache the first time, and
+// returns how many were synthesized over all voices. The audio is encoded as
+// devices negotiating no audio params expect it.
+func (h *Hub) PrewarmTtsCache(ctx context.Context, phrases []string) (int, error) {
+	if h.ttsCache == nil {
+		return 0, errors.New("TTS cache is not enabled")
+	}
+
+	personas := append([]*Persona{h.resolvePersona("")}, h.Personas()...)
+	noop := func(string) error { return nil }
+	scopes := make(map[string]bool)
+	warmed := 0
+	var lastErr error
+	for _, persona := range personas {
+		provider := persona.Tts
+		if len(provider) == 0 {
+			provider = h.cfgTts.Provider
+		}
+
+		scope := h.ttsCacheScope(provider, persona.Voice)
+		if scopes[scope] {
+			continue
+		}
+		scopes[scope] = true
+
+		srv, err := h.newTtsService(provider, persona.Voice, "")
+		if err != nil {
+			return warmed, err
+		}
+
+		processor := NewTtsProcessor(ctx, h.cfgTts, srv)
+		processor.SetCache(h.ttsCache, scope)
+		for _, phrase := range phrases {
+			err := processor.Speak(ctx, phrase, noop, func([]byte) error { return nil })
+			if err != nil {
+				log.Error().Err(err).Msgf("Failed to prewarm %q with %s", phrase, scope)
+				lastErr = err
+				continue
+			}
+			warmed++
+		}
+		processor.Close()
+	}
+
+	return warmed, lastErr
+}
@@ -0,0 +1,98 @@
+package src
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/cache"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingTTS returns a frame of silence per sentence and counts the calls
+type countingTTS struct {
+	mu    sync.Mutex
+	calls int
+	fail  bool
+}
+
+func (c *countingTTS) GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	if c.fail {
+		return nil, errors.New("provider called")
+	}
+	return make([]byte, 1920), nil
+}
+
+func speakAll(processor *TtsProcessor, answer string) (int, error) {
+	frames := 0
+	err := processor.Speak(context.Background(), answer, func(string) error {
+		return nil
+	}, func([]byte) error {
+		frames++
+		return nil
+	})
+	return frames, err
+}
+
+func TestTtsProcessorCache(t *testing.T) {
+	c, err := cache.New(cache.Config{Dir: t.TempDir()})
+	assert.NoError(t, err)
+
+	stub := &countingTTS{}
+	processor := NewTtsProcessor(context.Background(), &config.TtsConfig{Concurrency: 2}, stub)
+	processor.SetCache(c, "cosyvoice:anna")
+
+	frames, err := speakAll(processor, "你好，我是小智。很高兴认识你！")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, frames)
+	assert.Equal(t, 2, stub.calls)
+
+	// hits skip the provider, whitespace does not matter
+	stub.fail = true
+	frames, err = speakAll(processor, "你好，我是小智。 很高兴认识你！")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, frames)
+	assert.Equal(t, 2, stub.calls)
+
+	// the same text in another voice is synthesized
+	processor.SetCache(c, "cosyvoice:alex")
+	_, err = speakAll(processor, "你好，我是小智。")
+	assert.Error(t, err)
+	assert.Equal(t, 3, stub.calls)
+}
+
+func TestPrewarmTtsCache(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Tts.Provider = "local"
+	cfg.Tts.Local = &config.LocalTtsConfig{Command: "cat"}
+	cfg.Tts.Cache = &config.TtsCacheConfig{Enable: true}
+
+	h, err := New(cfg)
+	assert.NoError(t, err)
+	defer h.Shutdown(context.Background())
+
+	warmed, err := h.PrewarmTtsCache(context.Background(), []string{"你好，有什么可以帮你？"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, warmed)
+
+	persona := h.resolvePersona("device-1")
+	processor := NewTtsProcessor(context.Background(), h.cfgTts, &countingTTS{fail: true})
+	processor.SetCache(h.ttsCache, h.ttsCacheScope(persona.Tts, persona.Voice))
+	frames, err := speakAll(processor, "你好，有什么可以帮你？")
+	assert.NoError(t, err, "spoken from the cache")
+	assert.Equal(t, 1, frames)
+
+	cfg.Tts.Cache.Enable = false
+	h, err = New(cfg)
+	assert.NoError(t, err)
+	defer h.Shutdown(context.Background())
+	_, err = h.PrewarmTtsCache(context.Background(), []string{"你好"})
+	assert.Error(t, err)
+}
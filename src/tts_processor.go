@@ -3,141 +3,378 @@ package src
 import (
 	"context"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/text"
 	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
-	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/cosyvoice"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/cache"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
 
-	opus "github.com/qrtc/opus-go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// PCM read from TTS at a time, providers usually deliver smaller chunks
+	ttsReadSize = 4096
+	// chunks of PCM of a sentence buffered ahead of playback, about 4 seconds
+	ttsSentenceChunks = 32
 )
 
 type TtsProcessor struct {
-	ctx       context.Context         // context for managing cancellation and timeouts
-	ttsConfig *config.CosyVoiceConfig // TTS configuration
+	ctx context.Context // context for managing cancellation and timeouts
+
+	ttsSrv      tts.TTS          // TTS service interface
+	segmenter   *text.Segmenter  // splits answers into sentences
+	normalizer  *text.Normalizer // nil if answers are read as is
+	concurrency int              // sentences synthesized in parallel
+
+	speakMu sync.Mutex // serializes answers, they share the encoder
+
+	mu       sync.Mutex   // guards the fields below, never held while speaking
+	encoder  *OpusEncoder // one per session, built from the hello params
+	speaking *OpusEncoder // encoder of the answer being spoken, closed by Speak once replaced
+
+	cache      *cache.Cache // nil if caching is disabled
+	cacheScope string       // provider and voice of ttsSrv
 
-	ttsSrv tts.TTS // TTS service interface
+	options tts.Options // rate, gain and pitch of the device
+}
+
+// ttsSpeech is what an answer is spoken with, taken when it starts so the
+// settings may change meanwhile
+type ttsSpeech struct {
+	encoder    *OpusEncoder
+	resampler  *utils.Resampler // nil if the device plays tts.SampleRate
+	options    tts.Options
+	cache      *cache.Cache
+	cacheScope string
 }
 
 func NewTtsProcessor(
 	ctx context.Context,
-	ttsConfig *config.CosyVoiceConfig, // TTS configuration
+	cfg *config.TtsConfig,
+	ttsSrv tts.TTS, // TTS of the provider selected for the device
 ) *TtsProcessor {
 	t := &TtsProcessor{
-		ctx:       ctx,
-		ttsConfig: ttsConfig, // Extracting CosyVoice configuration
+		ctx:         ctx,
+		ttsSrv:      ttsSrv,
+		segmenter:   text.NewSegmenter(cfg.SentenceMinRunes, cfg.SentenceMaxRunes),
+		concurrency: max(cfg.Concurrency, 1),
+	}
+	if cfg.Normalize {
+		t.normalizer = text.NewNormalizer(cfg.Pronunciations)
 	}
-
-	t.ttsSrv = cosyvoice.NewTts(ttsConfig.ApiKey,
-		ttsConfig.BaseUrl,
-		ttsConfig.Voice)
 
 	return t
 }
 
-func (t *TtsProcessor) Push(text string) ([][]byte, error) {
-	speed := 1
-	pcm, err := t.ttsSrv.GenerateAudio(t.ctx, text, (float32)(speed))
+// SetAudioParams replaces the encoder by one producing the audio negotiated
+// in hello, frameDuration is in milliseconds
+func (t *TtsProcessor) SetAudioParams(sampleRate, frameDuration int) error {
+	encoder, err := NewOpusEncoder(sampleRate, 1, frameDuration)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return t.pcmToOpusData([][]byte{pcm}, 16000, 1) // 假设采样率为16000Hz，单声道
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.replaceEncoder(encoder)
+	return nil
 }
 
-func (t *TtsProcessor) pcmToOpusData(pcmSlices [][]byte, sampleRate int, channels int) ([][]byte, error) {
-	if len(pcmSlices) == 0 {
-		return nil, fmt.Errorf("PCM数据切片为空")
+// replaceEncoder closes the encoder unless an answer is spoken with it
+func (t *TtsProcessor) replaceEncoder(encoder *OpusEncoder) {
+	if t.encoder != nil && t.encoder != t.speaking {
+		t.encoder.Close()
 	}
+	t.encoder = encoder
+}
 
-	// 检查采样率是否支持
-	supportedRates := map[int]bool{8000: true, 12000: true, 16000: true, 24000: true, 48000: true}
-	if !supportedRates[sampleRate] {
-		return nil, fmt.Errorf("采样率 %dHz 不被Opus支持，仅支持8000/12000/16000/24000/48000Hz", sampleRate)
-	}
+// SetCache makes Speak reuse the frames of sentences synthesized before with
+// the same scope, which identifies the provider and the voice of the TTS
+func (t *TtsProcessor) SetCache(c *cache.Cache, scope string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cache = c
+	t.cacheScope = scope
+}
+
+// SetOptions changes the rate, gain and pitch of the answers from the next one
+func (t *TtsProcessor) SetOptions(opts tts.Options) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.options = opts.Clamp()
+}
+
+// Close releases the encoder at the end of the session
+func (t *TtsProcessor) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.replaceEncoder(nil)
+}
+
+// ttsSentence is a sentence being synthesized, err is set before pcm is
+// closed, frames are set instead of pcm if the sentence is cached
+type ttsSentence struct {
+	text   string // shown on the device
+	spoken string // read by TTS
+	key    string // key of the cache, empty if caching is disabled
+	pcm    chan []byte
+	frames [][]byte
+	err    error
+}
 
-	// 创建Opus编码器
-	encoder, err := opus.CreateOpusEncoder(&opus.OpusEncoderConfig{
-		SampleRate:    sampleRate,
-		MaxChannels:   channels,
-		Application:   opus.AppVoIP,
-		FrameDuration: opus.Framesize60Ms, // 使用60ms帧长
-	})
+// Speak splits answer into sentences synthesized up to concurrency at a time,
+// onSentence is called before the frames of every sentence, sentences and
+// frames are delivered strictly in order whichever finishes first. Sentences
+// are shown without Markdown and read with numbers spelled out.
+func (t *TtsProcessor) Speak(ctx context.Context, answer string, onSentence func(sentence string) error, onFrame func(opus []byte) error) error {
+	t.speakMu.Lock()
+	defer t.speakMu.Unlock()
+
+	sp, err := t.begin()
 	if err != nil {
-		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
+		return err
 	}
-	defer encoder.Close()
+	defer t.end(sp)
 
-	// 所有编码后的Opus数据包
-	var allOpusPackets [][]byte
+	var wg sync.WaitGroup
+	defer wg.Wait() // nothing reads the speech once Speak returns
 
-	// 计算每帧样本数 (60ms帧)
-	samplesPerFrame := (sampleRate * 60) / 1000 // 60ms帧
-	// 每个样本的字节数 (16位 = 2字节)
-	bytesPerSample := 2 * channels
-	// 每帧字节数
-	bytesPerFrame := samplesPerFrame * bytesPerSample
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops synthesis of the following sentences on failure
 
-	for _, pcmSlice := range pcmSlices {
-		if len(pcmSlice) == 0 {
-			continue
-		}
+	sentences := t.segmenter.Split(t.normalizer.Clean(answer))
+	pending := make(chan *ttsSentence, len(sentences))
+	slots := make(chan struct{}, t.concurrency)
+	cacheKey := sp.cacheKey()
 
-		// 确保PCM数据长度是偶数
-		if len(pcmSlice)%2 != 0 {
-			pcmSlice = pcmSlice[:len(pcmSlice)-1] // 截断最后一个字节
-			if len(pcmSlice) == 0 {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		for _, sentence := range sentences {
+			spoken := t.normalizer.Spoken(sentence)
+			if len(strings.TrimSpace(spoken)) == 0 {
+				continue // nothing left to read
+			}
+
+			s := &ttsSentence{text: sentence, spoken: spoken, key: cacheKey(spoken)}
+			if frames, ok := sp.cached(s.key); ok {
+				s.frames = frames // no need to call the provider
+				pending <- s
 				continue
 			}
-		}
 
-		// 计算这个PCM片段可以分成多少帧
-		numFrames := len(pcmSlice) / bytesPerFrame
-		if len(pcmSlice)%bytesPerFrame != 0 {
-			numFrames++ // 如果有剩余数据，额外增加一帧
+			select {
+			case <-ctx.Done():
+				return
+			case slots <- struct{}{}:
+			}
+
+			s.pcm = make(chan []byte, ttsSentenceChunks)
+			pending <- s
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				defer close(s.pcm)
+
+				s.err = t.synthesize(ctx, s.spoken, sp.options, func(pcm []byte) error {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case s.pcm <- pcm:
+						return nil
+					}
+				})
+			}()
 		}
+	}()
 
-		// 逐帧处理PCM数据
-		for frameIdx := 0; frameIdx < numFrames; frameIdx++ {
-			frameStart := frameIdx * bytesPerFrame
-			frameEnd := frameStart + bytesPerFrame
+	for s := range pending {
+		if err := onSentence(s.text); err != nil {
+			return err
+		}
 
-			// 确保不越界
-			if frameEnd > len(pcmSlice) {
-				frameEnd = len(pcmSlice)
+		if s.frames != nil {
+			for _, opus := range s.frames {
+				if err := onFrame(opus); err != nil {
+					return err
+				}
 			}
+			continue
+		}
 
-			// 当前帧的PCM数据
-			framePcm := pcmSlice[frameStart:frameEnd]
+		// every sentence ends with a whole frame, so its frames can be cached
+		var frames [][]byte
+		collect := func(opus []byte) error {
+			frames = append(frames, opus)
+			return onFrame(opus)
+		}
 
-			// 如果最后一帧数据不足，需要填充静音数据到完整帧大小
-			if len(framePcm) < bytesPerFrame {
-				paddedFrame := make([]byte, bytesPerFrame)
-				copy(paddedFrame, framePcm)
-				framePcm = paddedFrame
+		for pcm := range s.pcm {
+			if err := sp.encode(pcm, collect); err != nil {
+				return err
 			}
+		}
 
-			// 分配输出缓冲区 (Opus编码后的数据通常比PCM小)
-			outBuf := make([]byte, len(framePcm))
+		if s.err != nil {
+			return s.err
+		}
 
-			// 编码这一帧PCM数据到Opus
-			n, err := encoder.Encode(framePcm, outBuf)
-			if err != nil {
-				continue // 跳过这一帧，继续处理下一帧
-			}
+		if err := sp.flush(collect); err != nil {
+			return err
+		}
+		sp.store(s.key, frames)
+	}
+
+	return ctx.Err()
+}
 
-			if n == 0 {
-				continue // 跳过空帧
+// begin takes what the answer is spoken with, it drops the samples left by an
+// interrupted answer. The encoder of tts.SampleRate and 60ms frames is used
+// until hello is received.
+func (t *TtsProcessor) begin() (*ttsSpeech, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.encoder == nil {
+		encoder, err := NewOpusEncoder(tts.SampleRate, 1, defaultOpusFrameDuration)
+		if err != nil {
+			return nil, err
+		}
+		t.encoder = encoder
+	}
+	t.encoder.Reset()
+	t.speaking = t.encoder
+
+	sp := &ttsSpeech{
+		encoder:    t.encoder,
+		options:    t.options,
+		cache:      t.cache,
+		cacheScope: t.cacheScope,
+	}
+	if sp.encoder.sampleRate != tts.SampleRate {
+		sp.resampler = utils.NewResampler(tts.SampleRate, sp.encoder.sampleRate)
+	}
+
+	return sp, nil
+}
+
+// end closes the encoder of the answer if it was replaced meanwhile
+func (t *TtsProcessor) end(sp *ttsSpeech) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.speaking = nil
+	if sp.encoder != t.encoder {
+		sp.encoder.Close()
+	}
+}
+
+// cacheKey returns the function mapping sentences to their key in the cache,
+// the key covers everything the frames depend on
+func (sp *ttsSpeech) cacheKey() func(sentence string) string {
+	if sp.cache == nil {
+		return func(string) string { return "" }
+	}
+
+	opts := fmt.Sprintf("%g,%g,%g", sp.options.Speed(), sp.options.Gain, sp.options.Pitch)
+	sampleRate := strconv.Itoa(sp.encoder.sampleRate)
+	frameDuration := strconv.Itoa(sp.encoder.frameDuration)
+	return func(sentence string) string {
+		return cache.Key(sp.cacheScope, opts, sampleRate, frameDuration, normalizeCacheText(sentence))
+	}
+}
+
+func (sp *ttsSpeech) cached(key string) ([][]byte, bool) {
+	if sp.cache == nil || len(key) == 0 {
+		return nil, false
+	}
+
+	return sp.cache.Get(key)
+}
+
+func (sp *ttsSpeech) store(key string, frames [][]byte) {
+	if sp.cache == nil || len(key) == 0 || len(frames) == 0 {
+		return
+	}
+
+	if err := sp.cache.Put(key, frames); err != nil {
+		log.Warn().Err(err).Msgf("Failed to cache TTS audio")
+	}
+}
+
+// normalizeCacheText collapses whitespace, which does not change the speech
+func normalizeCacheText(sentence string) string {
+	return strings.Join(strings.Fields(sentence), " ")
+}
+
+// synthesize calls onPCM with the PCM of text as it arrives from TTS
+func (t *TtsProcessor) synthesize(ctx context.Context, text string, opts tts.Options, onPCM func(pcm []byte) error) error {
+	pcm, err := tts.Stream(ctx, t.ttsSrv, text, opts)
+	if err != nil {
+		return err
+	}
+	defer pcm.Close()
+
+	for {
+		buf := make([]byte, ttsReadSize) // kept by onPCM
+		n, readErr := pcm.Read(buf)
+		if n > 0 {
+			if err := onPCM(buf[:n]); err != nil {
+				return err
 			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return errors.Wrap(readErr, "failed to read TTS audio")
+		}
+	}
+}
+
+func (sp *ttsSpeech) encode(pcm []byte, onFrame func(opus []byte) error) error {
+	if sp.resampler != nil {
+		pcm = sp.resampler.Resample(pcm)
+	}
 
-			// 将编码后的Opus数据添加到结果集
-			allOpusPackets = append(allOpusPackets, outBuf[:n])
+	packets, err := sp.encoder.Write(pcm)
+	if err != nil {
+		return err
+	}
+
+	for _, packet := range packets {
+		if err := onFrame(packet); err != nil {
+			return err
 		}
 	}
 
-	if len(allOpusPackets) == 0 {
-		return nil, fmt.Errorf("所有PCM切片编码后为空")
+	return nil
+}
+
+func (sp *ttsSpeech) flush(onFrame func(opus []byte) error) error {
+	packet, err := sp.encoder.Flush()
+	if err != nil {
+		return err
 	}
 
-	return allOpusPackets, nil
+	if len(packet) != 0 {
+		return onFrame(packet)
+	}
 
+	return nil
 }
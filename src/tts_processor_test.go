@@ -0,0 +1,153 @@
+package src
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowTTS takes longer for earlier sentences, so later ones finish first
+type slowTTS struct {
+	delays  map[string]time.Duration
+	frames  map[string]int // 60ms frames of PCM returned
+	mu      sync.Mutex
+	running int
+	peak    int // most sentences synthesized at once
+}
+
+func (s *slowTTS) GenerateAudio(ctx context.Context, text string, speed float32) ([]byte, error) {
+	s.mu.Lock()
+	s.running++
+	s.peak = max(s.peak, s.running)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(s.delays[text]):
+	}
+
+	if s.frames[text] == 0 {
+		return nil, errors.New("synthesis failed")
+	}
+	return make([]byte, 1920*s.frames[text]), nil
+}
+
+func TestTtsProcessorSpeaksInOrder(t *testing.T) {
+	stub := &slowTTS{
+		delays: map[string]time.Duration{
+			"第一句话比较长。": 60 * time.Millisecond,
+			"第二句话短一点。": 10 * time.Millisecond,
+			"第三句话最后说。": 0,
+		},
+		frames: map[string]int{"第一句话比较长。": 1, "第二句话短一点。": 2, "第三句话最后说。": 3},
+	}
+	processor := NewTtsProcessor(context.Background(), &config.TtsConfig{Concurrency: 2}, stub)
+
+	var sentences []string
+	frames := make(map[string]int)
+	err := processor.Speak(context.Background(), "第一句话比较长。第二句话短一点。第三句话最后说。", func(sentence string) error {
+		sentences = append(sentences, sentence)
+		return nil
+	}, func(opus []byte) error {
+		frames[sentences[len(sentences)-1]]++
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"第一句话比较长。", "第二句话短一点。", "第三句话最后说。"}, sentences)
+	assert.Equal(t, stub.frames, frames, "frames follow their own sentence")
+	assert.Equal(t, 2, stub.peak, "synthesis is bounded")
+}
+
+func TestTtsProcessorSpeakFails(t *testing.T) {
+	stub := &slowTTS{frames: map[string]int{"第一句话没问题。": 1}}
+	processor := NewTtsProcessor(context.Background(), &config.TtsConfig{Concurrency: 2}, stub)
+
+	var sentences []string
+	err := processor.Speak(context.Background(), "第一句话没问题。第二句话会失败。第三句话不会说。", func(sentence string) error {
+		sentences = append(sentences, sentence)
+		return nil
+	}, func(opus []byte) error {
+		return nil
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"第一句话没问题。", "第二句话会失败。"}, sentences)
+}
+
+func TestTtsProcessorAudioParams(t *testing.T) {
+	stub := &stubStreamTTS{chunks: [][]byte{make([]byte, 1920*2)}} // 120ms
+	processor := NewTtsProcessor(context.Background(), &config.TtsConfig{}, stub)
+	defer processor.Close()
+
+	assert.NoError(t, processor.SetAudioParams(24000, 20))
+	var frames int
+	err := processor.Speak(context.Background(), "你好", func(string) error { return nil }, func(opus []byte) error {
+		frames++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, frames, "120ms resampled to 24kHz are six 20ms frames")
+
+	assert.Error(t, processor.SetAudioParams(16000, 30))
+}
+
+func TestTtsProcessorSettingsWhileSpeaking(t *testing.T) {
+	stub := &stubStreamTTS{chunks: [][]byte{make([]byte, 1920*2)}} // 120ms
+	processor := NewTtsProcessor(context.Background(), &config.TtsConfig{Concurrency: 2}, stub)
+	defer processor.Close()
+
+	// hello may arrive in the middle of an answer, which keeps its audio params
+	var frames int
+	err := processor.Speak(context.Background(), "第一句。第二句。", func(string) error { return nil }, func(opus []byte) error {
+		if frames == 0 {
+			assert.NoError(t, processor.SetAudioParams(24000, 20))
+			processor.SetOptions(tts.Options{Rate: 1.5})
+		}
+		frames++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, frames, "two sentences of two 60ms frames")
+
+	frames = 0
+	err = processor.Speak(context.Background(), "第三句。", func(string) error { return nil }, func(opus []byte) error {
+		frames++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, frames, "the next answer uses the new params")
+}
+
+func TestTtsProcessorNormalizes(t *testing.T) {
+	stub := &slowTTS{frames: map[string]int{"天气": 1, "人工智能说气温二十五摄氏度，湿度百分之六十。": 2}}
+	cfg := &config.TtsConfig{Concurrency: 2, Normalize: true, Pronunciations: map[string]string{"AI": "人工智能"}}
+	processor := NewTtsProcessor(context.Background(), cfg, stub)
+
+	var sentences []string
+	frames := 0
+	err := processor.Speak(context.Background(), "## 天气☀️\nAI说气温**25℃**，湿度60%。\n```\ncode\n```", func(sentence string) error {
+		sentences = append(sentences, sentence)
+		return nil
+	}, func(opus []byte) error {
+		frames++
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"天气", "AI说气温25℃，湿度60%。"}, sentences, "shown without Markdown")
+	assert.Equal(t, 3, frames, "read with numbers spelled out")
+}
@@ -0,0 +1,149 @@
+package src
+
+import (
+	"sort"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/cosyvoice"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/doubao"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/local"
+	ttsopenai "github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/openai"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+const (
+	TtsProviderCosyVoice = "cosyvoice"
+	TtsProviderOpenAI    = "openai"
+	TtsProviderDoubao    = "doubao"
+	TtsProviderLocal     = "local"
+)
+
+// ttsFactory builds the TTS of a provider for a device, voice overrides the
+// configured one if not empty, nil is returned if the provider is not configured
+type ttsFactory func(h *Hub, deviceId, voice string) tts.TTS
+
+// ttsProviders are the TTS providers selectable by personas and devices, a new
+// provider only needs to be registered here
+var ttsProviders = map[string]ttsFactory{
+	TtsProviderCosyVoice: func(h *Hub, deviceId, voice string) tts.TTS {
+		cfg := h.cfgTts
+		if cfg.CosyVoice == nil {
+			return nil
+		}
+		return cosyvoice.NewTts(cfg.CosyVoice.ApiKey, cfg.CosyVoice.BaseUrl, lo.Ternary(len(voice) != 0, voice, cfg.CosyVoice.Voice))
+	},
+
+	TtsProviderOpenAI: func(h *Hub, deviceId, voice string) tts.TTS {
+		cfg := h.cfgTts
+		if cfg.OpenAI == nil {
+			return nil
+		}
+		return ttsopenai.NewSpeech(ttsopenai.SpeechConfig{
+			BaseURL:    cfg.OpenAI.BaseUrl,
+			APIKey:     cfg.OpenAI.ApiKey,
+			Model:      cfg.OpenAI.Model,
+			Voice:      lo.Ternary(len(voice) != 0, voice, cfg.OpenAI.Voice),
+			SampleRate: cfg.OpenAI.SampleRate,
+			Timeout:    cfg.OpenAI.Timeout,
+		})
+	},
+
+	TtsProviderDoubao: func(h *Hub, deviceId, voice string) tts.TTS {
+		cfg := h.cfgTts
+		if cfg.Doubao == nil {
+			return nil
+		}
+		return doubao.NewTts(doubao.TtsDoubaoConfig{
+			Endpoint:   cfg.Doubao.Endpoint,
+			AppId:      cfg.Doubao.AppId,
+			AccessKey:  cfg.Doubao.AccessKey,
+			ResourceId: cfg.Doubao.ResourceId,
+			Speaker:    lo.Ternary(len(voice) != 0, voice, cfg.Doubao.Speaker),
+			Uid:        deviceId,
+		})
+	},
+
+	// processes of the local engine are shared by devices, the voice is the
+	// model given by the arguments
+	TtsProviderLocal: func(h *Hub, deviceId, voice string) tts.TTS {
+		if h.localTts == nil {
+			return nil
+		}
+		return h.localTts
+	},
+}
+
+func newLocalTts(cfg *config.LocalTtsConfig) (*local.Tts, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	return local.NewTts(local.LocalTtsConfig{
+		Command:    cfg.Command,
+		Args:       cfg.Args,
+		Env:        cfg.Env,
+		Format:     cfg.Format,
+		SampleRate: cfg.SampleRate,
+		Workers:    cfg.Workers,
+		Timeout:    cfg.Timeout,
+	})
+}
+
+// newTtsService builds the TTS of a provider for a device, an empty name means
+// cosyvoice which was the only one supported at first, voice is a preset of
+// the provider or the name of a custom voice
+func (h *Hub) newTtsService(provider, voice, deviceId string) (tts.TTS, error) {
+	if len(provider) == 0 {
+		provider = TtsProviderCosyVoice
+	}
+
+	factory, ok := ttsProviders[provider]
+	if !ok {
+		return nil, errors.Errorf("unknown TTS provider %s", provider)
+	}
+
+	srv := factory(h, deviceId, h.resolveVoice(provider, voice))
+	if srv == nil {
+		return nil, errors.Errorf("%s TTS configuration cannot be nil", provider)
+	}
+
+	return srv, nil
+}
+
+// HasTtsProvider reports whether name is a registered and configured provider
+func (h *Hub) HasTtsProvider(name string) bool {
+	factory, ok := ttsProviders[name]
+	return ok && factory(h, "", "") != nil
+}
+
+// TtsProviders returns the names of the configured TTS providers
+func (h *Hub) TtsProviders() []string {
+	names := make([]string, 0, len(ttsProviders))
+	for name := range ttsProviders {
+		if h.HasTtsProvider(name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// checkTtsProviders makes sure the providers referenced by the configuration
+// exist, like checkLlmProfiles does for LLM
+func (h *Hub) checkTtsProviders() error {
+	if len(h.cfgTts.Provider) != 0 && !h.HasTtsProvider(h.cfgTts.Provider) {
+		return errors.Errorf("default TTS provider %s is not configured", h.cfgTts.Provider)
+	}
+
+	for name, cfg := range h.cfgPersonas {
+		if cfg != nil && len(cfg.Tts) != 0 && !h.HasTtsProvider(cfg.Tts) {
+			return errors.Errorf("TTS provider %s of persona %s is not configured", cfg.Tts, name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package src
+
+import (
+	"context"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/cosyvoice"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/doubao"
+	ttsopenai "github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/openai"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTtsProviders(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Personas = map[string]*config.PersonaConfig{
+		"english": {Tts: "openai"},
+	}
+
+	h, err := New(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cosyvoice", "doubao", "openai"}, h.TtsProviders())
+
+	persona := h.resolvePersona("device-1")
+	assert.Equal(t, "cosyvoice", persona.Tts)
+	srv, err := h.newTtsService(persona.Tts, persona.Voice, "device-1")
+	assert.NoError(t, err)
+	assert.IsType(t, &cosyvoice.Tts{}, srv)
+
+	h.repo.SaveDeviceSettings(&types.DeviceSettings{DeviceId: "device-1", Persona: "english"})
+	persona = h.resolvePersona("device-1")
+	assert.Equal(t, "openai", persona.Tts)
+	srv, err = h.newTtsService(persona.Tts, persona.Voice, "device-1")
+	assert.NoError(t, err)
+	assert.IsType(t, &ttsopenai.Speech{}, srv)
+
+	h.repo.SaveDeviceSettings(&types.DeviceSettings{DeviceId: "device-1", Persona: "english", Tts: "doubao"})
+	persona = h.resolvePersona("device-1")
+	assert.Equal(t, "doubao", persona.Tts, "device settings win")
+	srv, err = h.newTtsService(persona.Tts, persona.Voice, "device-1")
+	assert.NoError(t, err)
+	assert.IsType(t, &doubao.Tts{}, srv)
+
+	_, err = h.newTtsService("missing", "", "device-1")
+	assert.Error(t, err)
+}
+
+func TestTtsProvidersChecked(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Tts.Provider = "missing"
+	_, err := New(cfg)
+	assert.Error(t, err)
+
+	cfg = config.DefaultConfig()
+	cfg.Tts.Doubao = nil
+	cfg.Personas = map[string]*config.PersonaConfig{"teacher": {Tts: "doubao"}}
+	_, err = New(cfg)
+	assert.Error(t, err, "doubao is not configured")
+}
+
+func TestLocalTtsProvider(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Tts.Provider = "local"
+	cfg.Tts.Local = &config.LocalTtsConfig{Command: "cat"}
+
+	h, err := New(cfg)
+	assert.NoError(t, err)
+	defer h.Shutdown(context.Background())
+
+	assert.Contains(t, h.TtsProviders(), "local")
+	srv, err := h.newTtsService(h.resolvePersona("device-1").Tts, "", "device-1")
+	assert.NoError(t, err)
+
+	pcm, err := srv.GenerateAudio(context.Background(), "pcm", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "pcm\n", string(pcm))
+
+	cfg.Tts.Local = &config.LocalTtsConfig{Command: "/not/found"}
+	_, err = New(cfg)
+	assert.Error(t, err)
+}
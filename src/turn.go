@@ -0,0 +1,108 @@
+package src
+
+import (
+	"context"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// turn is one question and its answer, LLM and TTS of the turn run within its
+// context, so they stop as soon as the user interrupts
+type turn struct {
+	id     uint64
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	announcement *delivery // played instead of answering the user, nil if none
+}
+
+// responses are tagged with their turn, those of an aborted turn are dropped
+// by the session loop even if they were queued before the abort
+type llmTurnResponse struct {
+	turn uint64
+	*llm.LLMResponse
+}
+
+type ttsTurnResponse struct {
+	turn     uint64
+	sentence bool // Text begins to be spoken, announced with sentence_start
+	*tts.TTSResponse
+}
+
+// beginTurn aborts the current turn if any and starts a new one, it must only
+// be called from the session loop
+func (s *Session) beginTurn() *turn {
+	s.abortTurn("new_turn")
+
+	s.turnSeq++
+	t := &turn{id: s.turnSeq}
+	t.ctx, t.cancel = context.WithCancel(s.ctx)
+	s.turn = t
+	return t
+}
+
+// isCurrentTurn reports whether responses of turn id should still be handled
+func (s *Session) isCurrentTurn(id uint64) bool {
+	return s.turn != nil && s.turn.id == id && s.turn.ctx.Err() == nil
+}
+
+// abortTurn cancels in-flight LLM and TTS of the current turn, pauses the
+// media, stops playback on the device and returns to listening
+func (s *Session) abortTurn(reason string) error {
+	return s.endTurn(reason, false)
+}
+
+// failTurn ends the current turn which has nothing to speak, the device gets
+// a stop even though it is not speaking, so it leaves thinking and listens
+func (s *Session) failTurn(reason string) error {
+	return s.endTurn(reason, true)
+}
+
+// endTurn aborts the current turn, the stop is only sent to a device which
+// is speaking unless stop is set
+func (s *Session) endTurn(reason string, stop bool) error {
+	if err := s.interruptMedia(); err != nil {
+		return err
+	}
+
+	if s.turn == nil {
+		return nil
+	}
+
+	log.Info().Msgf("Turn %d of device %s aborted: %s", s.turn.id, s.deviceId, reason)
+	if d := s.turn.announcement; d != nil {
+		s.hub.announcer.finish(d, errors.Errorf("interrupted by %s", reason))
+	}
+	s.turn.cancel()
+	s.turn = nil
+	if s.scheduler != nil {
+		s.scheduler.Flush() // drop the audio not sent yet
+	}
+	// a stop not written yet is dropped too, so the device still needs one
+	dropped := s.outbox.DropSpeech()
+
+	if !stop && !s.speaking && dropped == 0 {
+		return nil
+	}
+
+	s.speaking = false
+	if err := s.cmdTTSAbort(); err != nil {
+		return err
+	}
+	s.fire(SessionEventAbort)
+	return nil
+}
+
+// sendTurn delivers v unless the turn has been aborted meanwhile
+func sendTurn[T any](t *turn, ch chan<- T, v T) bool {
+	select {
+	case <-t.ctx.Done():
+		return false
+	case ch <- v:
+		return true
+	}
+}
@@ -0,0 +1,107 @@
+package src
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTurnAbort(t *testing.T) {
+	s := newSession(context.Background())
+
+	first := s.beginTurn()
+	assert.True(t, s.isCurrentTurn(first.id))
+
+	// a new turn drops responses of the previous one
+	second := s.beginTurn()
+	assert.Error(t, first.ctx.Err())
+	assert.False(t, s.isCurrentTurn(first.id))
+	assert.True(t, s.isCurrentTurn(second.id))
+
+	ch := make(chan int)
+	assert.False(t, sendTurn(first, ch, 1))
+
+	assert.NoError(t, s.abortTurn("abort"))
+	assert.Error(t, second.ctx.Err())
+	assert.False(t, s.isCurrentTurn(second.id))
+}
+
+func TestLlmPushCancelled(t *testing.T) {
+	stub := &stubToolLLM{} // the aborted request fails
+	processor := NewLlmProcessor(context.Background(), &config.LlmConfig{}, stub)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := processor.Push(ctx, "第一个问题")
+	assert.Error(t, err)
+
+	// the unanswered question is not kept in the conversation
+	stub.answers = []llm.Dialogue{{Role: llm.RoleAssistant, Content: "你好"}}
+	answer, err := processor.Push(context.Background(), "你好")
+	assert.NoError(t, err)
+	assert.Equal(t, "你好", answer)
+	last := stub.dialogues[len(stub.dialogues)-1]
+	assert.Equal(t, "你好", last[len(last)-1].Content)
+	for _, d := range last {
+		assert.NotEqual(t, "第一个问题", d.Content)
+	}
+}
+
+func TestLlmPushFailedKeepsTrimmedTurns(t *testing.T) {
+	stub := &stubToolLLM{}
+	processor := NewLlmProcessor(context.Background(), &config.LlmConfig{
+		Context: &config.LlmContextConfig{MaxTokens: 130, KeepTurns: 1},
+	}, stub)
+
+	long := strings.Repeat("很长的问题", 10)
+	processor.Restore([]*types.Turn{{Question: long, Answer: "一"}, {Question: long, Answer: "二"}})
+	before := append([]llm.Dialogue(nil), processor.dialogues...)
+
+	// the oldest turn is trimmed from the request only
+	_, err := processor.Push(context.Background(), long)
+	assert.Error(t, err)
+	assert.Len(t, stub.dialogues[0], 3)
+	assert.Equal(t, before, processor.dialogues, "nothing is lost to a failed turn")
+
+	stub.answers = []llm.Dialogue{{Role: llm.RoleAssistant, Content: "三"}}
+	_, err = processor.Push(context.Background(), long)
+	assert.NoError(t, err)
+	assert.Equal(t, []llm.Dialogue{
+		{Role: llm.RoleUser, Content: long},
+		{Role: llm.RoleAssistant, Content: "二"},
+		{Role: llm.RoleUser, Content: long},
+		{Role: llm.RoleAssistant, Content: "三"},
+	}, processor.dialogues, "the trimmed turn is dropped once answered")
+}
+
+func TestTurnFail(t *testing.T) {
+	s := newSession(context.Background())
+
+	var written writtenLog
+	done := make(chan error)
+	go func() { done <- s.outbox.Run(written.write) }()
+
+	// the device is thinking, an aborted turn leaves it as is
+	s.beginTurn()
+	assert.NoError(t, s.abortTurn("abort"))
+
+	// a failed one stops it so it listens again
+	first := s.beginTurn()
+	assert.NoError(t, s.failTurn("llm_failed"))
+	assert.Error(t, first.ctx.Err())
+	assert.Nil(t, s.turn)
+
+	s.outbox.Close()
+	assert.NoError(t, <-done)
+	messages := written.get()
+	if assert.Len(t, messages, 1) {
+		assert.Contains(t, messages[0], `"state":"stop"`)
+	}
+}
@@ -0,0 +1,160 @@
+package src
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/llm/openai"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	VisionExplainPath = "/xiaozhi/vision/explain"
+
+	visionFileField     = "file"     // multipart field of the photo
+	visionQuestionField = "question" // multipart field of the question
+)
+
+// VisionResponse is the answer of the vision endpoint, the device speaks
+// Response
+type VisionResponse struct {
+	Success  bool   `json:"success"`
+	Action   string `json:"action,omitempty"`
+	Response string `json:"response,omitempty"`
+	Message  string `json:"message,omitempty"` // reason of failure
+}
+
+func newVisionLLM(cfg *config.VisionConfig) llm.VisionLLM {
+	if cfg == nil || !cfg.Enable {
+		return nil
+	}
+
+	return openai.NewOpenAIWithConfig(openai.OpenAIConfig{
+		ModelName: cfg.Model,
+		BaseURL:   cfg.BaseUrl,
+		APIKey:    cfg.ApiKey,
+		Generation: llm.GenerationConfig{
+			MaxTokens: cfg.MaxTokens,
+			Timeout:   cfg.Timeout,
+		},
+	})
+}
+
+// visionToken is the bearer token devices present to the vision endpoint
+func (h *Hub) visionToken() string {
+	if len(h.cfgVision.Token) != 0 {
+		return h.cfgVision.Token
+	}
+	return h.cfgOta.WsToken
+}
+
+// visionEnabled reports whether the vision endpoint is served and advertised
+func (h *Hub) visionEnabled() bool {
+	return h.vision != nil && len(h.cfgVision.Url) != 0
+}
+
+func visionFailure(ctx *app.RequestContext, code int, message string) {
+	ctx.JSON(code, VisionResponse{Success: false, Message: message})
+}
+
+func visionHandler(h *Hub) app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		if h.vision == nil {
+			utils.NotFound(ctx, "vision is not enabled")
+			return
+		}
+
+		token := strings.TrimPrefix(ctx.Request.Header.Get("Authorization"), "Bearer ")
+		if len(h.visionToken()) != 0 && token != h.visionToken() {
+			visionFailure(ctx, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		// devices are registered by the OTA request before they connect
+		deviceId := ctx.Request.Header.Get(DeviceIdHeader)
+		clientId := ctx.Request.Header.Get(ClientIdHeader)
+		if len(deviceId) == 0 || len(clientId) == 0 {
+			visionFailure(ctx, http.StatusBadRequest, "missing device id or client id")
+			return
+		}
+
+		if _, err := h.repo.FindDevice(repo.WhereCondition{"device_id": deviceId}); err != nil {
+			if repo.IsNotExists(err) {
+				visionFailure(ctx, http.StatusUnauthorized, "unknown device")
+				return
+			}
+			visionFailure(ctx, http.StatusInternalServerError, "failed to find device: "+err.Error())
+			return
+		}
+
+		question := strings.TrimSpace(ctx.PostForm(visionQuestionField))
+		if len(question) == 0 {
+			visionFailure(ctx, http.StatusBadRequest, "missing question")
+			return
+		}
+
+		fh, err := ctx.FormFile(visionFileField)
+		if err != nil {
+			visionFailure(ctx, http.StatusBadRequest, "missing image: "+err.Error())
+			return
+		}
+
+		if fh.Size > h.cfgVision.MaxImageSize {
+			visionFailure(ctx, http.StatusRequestEntityTooLarge, "image is too large")
+			return
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			visionFailure(ctx, http.StatusBadRequest, "failed to read image: "+err.Error())
+			return
+		}
+		defer f.Close()
+
+		image, err := io.ReadAll(io.LimitReader(f, h.cfgVision.MaxImageSize+1))
+		if err != nil {
+			visionFailure(ctx, http.StatusBadRequest, "failed to read image: "+err.Error())
+			return
+		}
+		if int64(len(image)) > h.cfgVision.MaxImageSize {
+			visionFailure(ctx, http.StatusRequestEntityTooLarge, "image is too large")
+			return
+		}
+
+		mimeType := http.DetectContentType(image)
+		if !strings.HasPrefix(mimeType, "image/") {
+			visionFailure(ctx, http.StatusUnsupportedMediaType, "unsupported image type "+mimeType)
+			return
+		}
+
+		if len(h.cfgVision.Prompt) != 0 {
+			question = h.cfgVision.Prompt + "\n" + question
+		}
+
+		startAt := time.Now()
+		answer, err := h.vision.Explain(c, question, image, mimeType)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to explain image of device %s: %v", deviceId, err)
+			visionFailure(ctx, http.StatusBadGateway, "failed to explain image")
+			return
+		}
+
+		log.Info().Str("device_id", deviceId).Int("image_size", len(image)).
+			Dur("latency", time.Since(startAt)).Msgf("Vision explained: %s", answer)
+
+		ctx.JSON(http.StatusOK, VisionResponse{
+			Success:  true,
+			Action:   "RESPONSE",
+			Response: answer,
+		})
+	}
+}
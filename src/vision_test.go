@@ -0,0 +1,88 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	hertzconfig "github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubVisionLLM struct {
+	question string
+	mimeType string
+}
+
+func (s *stubVisionLLM) Explain(ctx context.Context, question string, image []byte, mimeType string) (string, error) {
+	s.question, s.mimeType = question, mimeType
+	return "一只猫", nil
+}
+
+func visionRequest(t *testing.T, engine *route.Engine, token string, image []byte) (int, VisionResponse) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("question", "这是什么")
+	fw, err := w.CreateFormFile("file", "photo.png")
+	assert.NoError(t, err)
+	fw.Write(image)
+	w.Close()
+
+	resp := ut.PerformRequest(engine, http.MethodPost, VisionExplainPath, &ut.Body{Body: &body, Len: body.Len()},
+		ut.Header{Key: "Content-Type", Value: w.FormDataContentType()},
+		ut.Header{Key: "Authorization", Value: "Bearer " + token},
+		ut.Header{Key: DeviceIdHeader, Value: "device-1"},
+		ut.Header{Key: ClientIdHeader, Value: "client-1"},
+	).Result()
+
+	var answer VisionResponse
+	json.Unmarshal(resp.Body(), &answer)
+	return resp.StatusCode(), answer
+}
+
+func TestVisionExplain(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Vision.Enable = true
+	cfg.Vision.Token = "secret"
+	cfg.Vision.MaxImageSize = 64
+	h, err := New(cfg)
+	assert.NoError(t, err)
+
+	stub := &stubVisionLLM{}
+	h.vision = stub
+
+	engine := route.NewEngine(hertzconfig.NewOptions(nil))
+	engine.POST(VisionExplainPath, visionHandler(h))
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 16)...)
+
+	// devices have to request OTA first
+	code, _ := visionRequest(t, engine, "secret", png)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	assert.NoError(t, h.repo.CreateDevice(&types.Device{DeviceId: "device-1", ClientId: "client-1"}))
+
+	code, _ = visionRequest(t, engine, "wrong", png)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, answer := visionRequest(t, engine, "secret", png)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, answer.Success)
+	assert.Equal(t, "一只猫", answer.Response)
+	assert.Equal(t, "image/png", stub.mimeType)
+	assert.Contains(t, stub.question, "这是什么")
+
+	code, _ = visionRequest(t, engine, "secret", append(png, make([]byte, 64)...))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+
+	code, _ = visionRequest(t, engine, "secret", []byte("not an image"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, code)
+}
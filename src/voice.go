@@ -0,0 +1,144 @@
+package src
+
+import (
+	"context"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts/cosyvoice"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/samber/lo"
+)
+
+// Voices are the voices selectable by personas and devices
+type Voices struct {
+	Presets map[string][]string `json:"presets"` // provider -> preset voices
+	Custom  []*types.Voice      `json:"custom"`  // voices cloned from reference audio
+}
+
+// Voices returns the preset voices of the configured providers and the custom
+// voices of the repository
+func (h *Hub) Voices() (*Voices, error) {
+	voices := &Voices{Presets: make(map[string][]string)}
+	if h.HasTtsProvider(TtsProviderCosyVoice) {
+		voices.Presets[TtsProviderCosyVoice] = cosyvoice.VoiceList
+	}
+
+	custom, err := h.repo.ListVoices(nil)
+	if err != nil {
+		return nil, err
+	}
+	voices.Custom = custom
+
+	return voices, nil
+}
+
+// CloneVoice creates a custom CosyVoice voice from reference audio and its
+// transcript, a voice of the same name is replaced
+func (h *Hub) CloneVoice(ctx context.Context, name, text string, audio []byte, filename string) (*types.Voice, error) {
+	client := h.cosyVoiceClient()
+	if client == nil {
+		return nil, errors.New("cosyvoice TTS is not configured")
+	}
+
+	if lo.Contains(cosyvoice.VoiceList, name) {
+		return nil, errors.Errorf("voice %s is a preset voice", name)
+	}
+
+	uri, err := client.UploadVoice(ctx, name, text, audio, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := h.findVoice(name)
+	if err != nil && err != repo.ErrVoiceNotFound {
+		return nil, err
+	}
+
+	voice := &types.Voice{
+		Name:      name,
+		Provider:  TtsProviderCosyVoice,
+		Uri:       uri,
+		Text:      text,
+		CreatedAt: time.Now(),
+	}
+	if err := h.repo.SaveVoice(voice); err != nil {
+		return nil, err
+	}
+
+	if previous != nil && previous.Uri != uri {
+		if err := client.DeleteVoice(ctx, previous.Uri); err != nil {
+			log.Warn().Err(err).Msgf("Failed to delete replaced voice %s", previous.Uri)
+		}
+	}
+
+	return voice, nil
+}
+
+// RemoveVoice deletes a custom voice from the provider and the repository
+func (h *Hub) RemoveVoice(ctx context.Context, name string) error {
+	voice, err := h.findVoice(name)
+	if err != nil {
+		return err
+	}
+
+	if client := h.cosyVoiceClient(); client != nil && voice.Provider == TtsProviderCosyVoice {
+		if err := client.DeleteVoice(ctx, voice.Uri); err != nil {
+			return err
+		}
+	}
+
+	return h.repo.RemoveVoices(repo.WhereCondition{"name": name})
+}
+
+func (h *Hub) findVoice(name string) (*types.Voice, error) {
+	voices, err := h.repo.ListVoices(repo.WhereCondition{"name": name})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(voices) == 0 {
+		return nil, repo.ErrVoiceNotFound
+	}
+
+	return voices[0], nil
+}
+
+// resolveVoice maps the name of a custom voice of provider to its URI, other
+// voices are presets of the provider and kept as is
+func (h *Hub) resolveVoice(provider, voice string) string {
+	if len(voice) == 0 {
+		return voice
+	}
+
+	if len(provider) == 0 {
+		provider = TtsProviderCosyVoice
+	}
+
+	custom, err := h.findVoice(voice)
+	if err != nil {
+		if err != repo.ErrVoiceNotFound {
+			log.Error().Err(err).Msgf("Failed to find voice %s", voice)
+		}
+		return voice
+	}
+
+	if custom.Provider != provider {
+		log.Warn().Msgf("Voice %s of %s is not available to %s", voice, custom.Provider, provider)
+		return ""
+	}
+
+	return custom.Uri
+}
+
+func (h *Hub) cosyVoiceClient() *cosyvoice.Tts {
+	cfg := h.cfgTts.CosyVoice
+	if cfg == nil {
+		return nil
+	}
+
+	return cosyvoice.NewTts(cfg.ApiKey, cfg.BaseUrl, "")
+}
@@ -0,0 +1,62 @@
+package src
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/config"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomVoices(t *testing.T) {
+	deleted := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/uploads/audio/voice":
+			w.Write([]byte(`{"uri":"speech:` + r.FormValue("customName") + `:` + r.FormValue("text") + `"}`))
+		case "/v1/audio/voice/deletions":
+			deleted = append(deleted, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Tts.CosyVoice.BaseUrl = srv.URL
+	cfg.Personas = map[string]*config.PersonaConfig{
+		"mother": {Voice: "mama"},
+	}
+	h, err := New(cfg)
+	assert.NoError(t, err)
+
+	_, err = h.CloneVoice(context.Background(), "anna", "text", []byte("RIFF"), "anna.wav")
+	assert.Error(t, err, "presets can not be replaced")
+
+	voice, err := h.CloneVoice(context.Background(), "mama", "v1", []byte("RIFF"), "mama.wav")
+	assert.NoError(t, err)
+	assert.Equal(t, "speech:mama:v1", voice.Uri)
+
+	_, err = h.CloneVoice(context.Background(), "mama", "v2", []byte("RIFF"), "mama.wav")
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 1, "the replaced voice is deleted")
+
+	voices, err := h.Voices()
+	assert.NoError(t, err)
+	assert.Contains(t, voices.Presets["cosyvoice"], "anna")
+	assert.Len(t, voices.Custom, 1)
+
+	h.repo.SaveDeviceSettings(&types.DeviceSettings{DeviceId: "device-1", Persona: "mother"})
+	persona := h.resolvePersona("device-1")
+	assert.Equal(t, "mama", persona.Voice)
+	assert.Equal(t, "speech:mama:v2", h.resolveVoice(persona.Tts, persona.Voice))
+	assert.Equal(t, "", h.resolveVoice(TtsProviderOpenAI, persona.Voice), "voices belong to their provider")
+	assert.Equal(t, "anna", h.resolveVoice(persona.Tts, "anna"))
+
+	assert.NoError(t, h.RemoveVoice(context.Background(), "mama"))
+	assert.Len(t, deleted, 2)
+	assert.ErrorIs(t, h.RemoveVoice(context.Background(), "mama"), repo.ErrVoiceNotFound)
+}
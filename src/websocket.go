@@ -28,7 +28,7 @@ func wsProtocolHandler(ctx context.Context, rctx *app.RequestContext, h *Hub) we
 		s := newSession(ctx)
 
 		defer func() {
-			h.sessionMap.Del(rctx.Request.Header.Get("Device-Id"))
+			h.removeSession(s)
 			conn.Close()
 		}()
 
@@ -67,7 +67,7 @@ func wsProtocolHandler(ctx context.Context, rctx *app.RequestContext, h *Hub) we
 		// 	log.Error().Err(err).Msgf("Failed to populate session context err: %+v", err)
 		// 	return
 		// }
-		h.sessionMap.Set(rctx.Request.Header.Get("Device-Id"), s)
+		h.addSession(s)
 
 		if err := s.loop(); err != nil {
 			log.Error().Err(err).Msgf("Session loop error: %+v", err)
@@ -1,3 +1,243 @@
 package utils
 
-import ()
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Resampler converts 16-bit little endian mono PCM between sample rates by
+// linear interpolation, it keeps state between calls so a stream can be
+// converted chunk by chunk
+type Resampler struct {
+	from, to int
+	step     float64 // input samples per output sample
+	pos      float64 // position of the next output sample, 0 is prev
+	prev     int16   // last sample of the previous chunk
+	started  bool
+	odd      []byte // trailing byte of a chunk of odd length
+}
+
+func NewResampler(from, to int) *Resampler {
+	return &Resampler{
+		from: from,
+		to:   to,
+		step: float64(from) / float64(to),
+	}
+}
+
+// Resample converts pcm and returns the samples available so far
+func (r *Resampler) Resample(pcm []byte) []byte {
+	if r.from == r.to || r.from <= 0 || r.to <= 0 {
+		return pcm
+	}
+
+	if len(r.odd) != 0 {
+		pcm = append(r.odd, pcm...)
+		r.odd = nil
+	}
+	if len(pcm)%2 != 0 {
+		r.odd = []byte{pcm[len(pcm)-1]}
+		pcm = pcm[:len(pcm)-1]
+	}
+
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+
+	if !r.started && len(samples) != 0 {
+		r.prev, samples = samples[0], samples[1:]
+		r.started = true
+	}
+
+	// x[0] is prev and x[1:] are samples
+	at := func(i int) float64 {
+		if i == 0 {
+			return float64(r.prev)
+		}
+		return float64(samples[i-1])
+	}
+
+	n := len(samples)
+	out := make([]byte, 0, int(float64(n)/r.step+1)*2)
+	// a sample falling on the last input sample is produced with the next chunk
+	for int(r.pos) < n {
+		i := int(r.pos)
+		frac := r.pos - float64(i)
+		v := at(i)*(1-frac) + at(i+1)*frac
+		out = binary.LittleEndian.AppendUint16(out, uint16(int16(v)))
+		r.pos += r.step
+	}
+
+	if n != 0 {
+		r.pos -= float64(n)
+		r.prev = samples[n-1]
+	}
+
+	return out
+}
+
+// ResamplePCM converts a whole buffer of 16-bit little endian mono PCM
+func ResamplePCM(pcm []byte, from, to int) []byte {
+	return NewResampler(from, to).Resample(pcm)
+}
+
+type resampleReader struct {
+	src       io.ReadCloser
+	resampler *Resampler
+	buf       []byte // read from src
+	out       []byte // resampled but not yet read
+}
+
+// NewResampleReader converts the 16-bit little endian mono PCM read from src,
+// src is returned as is if the rates are equal
+func NewResampleReader(src io.ReadCloser, from, to int) io.ReadCloser {
+	if from == to {
+		return src
+	}
+
+	return &resampleReader{
+		src:       src,
+		resampler: NewResampler(from, to),
+		buf:       make([]byte, 4096),
+	}
+}
+
+func (r *resampleReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		n, err := r.src.Read(r.buf)
+		if n > 0 {
+			r.out = r.resampler.Resample(r.buf[:n])
+		}
+		if err != nil && len(r.out) == 0 {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *resampleReader) Close() error {
+	return r.src.Close()
+}
+
+// ApplyGain scales 16-bit little endian PCM by gain dB in place, samples out
+// of range are clipped
+func ApplyGain(pcm []byte, gain float32) {
+	applyGain(pcm, math.Pow(10, float64(gain)/20))
+}
+
+func applyGain(pcm []byte, factor float64) {
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := float64(int16(binary.LittleEndian.Uint16(pcm[i:]))) * factor
+		v = max(math.MinInt16, min(math.MaxInt16, math.Round(v)))
+		binary.LittleEndian.PutUint16(pcm[i:], uint16(int16(v)))
+	}
+}
+
+type gainReader struct {
+	src    io.ReadCloser
+	factor float64
+	buf    []byte // read from src
+	odd    []byte // trailing byte of a read of odd length
+	out    []byte // scaled but not yet read
+}
+
+// NewGainReader scales the 16-bit little endian PCM read from src by gain dB
+func NewGainReader(src io.ReadCloser, gain float32) io.ReadCloser {
+	return &gainReader{
+		src:    src,
+		factor: math.Pow(10, float64(gain)/20),
+		buf:    make([]byte, 4096),
+	}
+}
+
+func (r *gainReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		n, err := r.src.Read(r.buf)
+		if n > 0 {
+			data := append(r.odd, r.buf[:n]...)
+			even := len(data) - len(data)%2
+			r.odd = append([]byte(nil), data[even:]...)
+			applyGain(data[:even], r.factor)
+			r.out = data[:even]
+		}
+		if err != nil && len(r.out) == 0 {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *gainReader) Close() error {
+	return r.src.Close()
+}
+
+// WavFormat is the format of the samples of a WAV stream
+type WavFormat struct {
+	AudioFormat   uint16 // 1 is PCM
+	Channels      uint16
+	SampleRate    uint32
+	BitsPerSample uint16
+}
+
+// ReadWavHeader reads r up to the samples of the data chunk, the sizes in the
+// header are ignored since streaming encoders can not know them in advance
+func ReadWavHeader(r io.Reader) (*WavFormat, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, errors.Wrap(err, "failed to read RIFF header")
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV stream")
+	}
+
+	var format *WavFormat
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, errors.Wrap(err, "failed to read chunk header")
+		}
+		id, size := string(chunk[0:4]), binary.LittleEndian.Uint32(chunk[4:8])
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.Errorf("fmt chunk of %d bytes is too short", size)
+			}
+			var fmtChunk [16]byte
+			if _, err := io.ReadFull(r, fmtChunk[:]); err != nil {
+				return nil, errors.Wrap(err, "failed to read fmt chunk")
+			}
+			format = &WavFormat{
+				AudioFormat:   binary.LittleEndian.Uint16(fmtChunk[0:2]),
+				Channels:      binary.LittleEndian.Uint16(fmtChunk[2:4]),
+				SampleRate:    binary.LittleEndian.Uint32(fmtChunk[4:8]),
+				BitsPerSample: binary.LittleEndian.Uint16(fmtChunk[14:16]),
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(size-16+size%2)); err != nil {
+				return nil, errors.Wrap(err, "failed to skip fmt chunk")
+			}
+
+		case "data":
+			if format == nil {
+				return nil, errors.New("data chunk before fmt chunk")
+			}
+			return format, nil
+
+		default:
+			// chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, r, int64(size+size%2)); err != nil {
+				return nil, errors.Wrapf(err, "failed to skip %s chunk", id)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pcmOf(samples ...int16) []byte {
+	var buf []byte
+	for _, s := range samples {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(s))
+	}
+	return buf
+}
+
+func TestResamplePCM(t *testing.T) {
+	// 24kHz to 16kHz keeps 2 of every 3 samples, interpolated
+	out := ResamplePCM(pcmOf(0, 300, 600, 900, 1200, 1500, 1800), 24000, 16000)
+	assert.Equal(t, pcmOf(0, 450, 900, 1350), out)
+
+	// upsampling doubles the samples
+	out = ResamplePCM(pcmOf(0, 100, 200), 8000, 16000)
+	assert.Equal(t, pcmOf(0, 50, 100, 150), out)
+
+	same := pcmOf(1, 2, 3)
+	assert.Equal(t, same, ResamplePCM(same, 16000, 16000))
+}
+
+func TestResamplerChunks(t *testing.T) {
+	pcm := pcmOf(0, 300, 600, 900, 1200, 1500, 1800, 2100, 2400)
+	whole := ResamplePCM(pcm, 24000, 16000)
+
+	// chunks of odd length give the same result as the whole buffer
+	r := NewResampler(24000, 16000)
+	var chunked []byte
+	for i := 0; i < len(pcm); i += 3 {
+		end := min(i+3, len(pcm))
+		chunked = append(chunked, r.Resample(pcm[i:end])...)
+	}
+	assert.Equal(t, whole, chunked)
+
+	reader := NewResampleReader(io.NopCloser(bytes.NewReader(pcm)), 24000, 16000)
+	read, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, whole, read)
+}
+
+func TestReadWavHeader(t *testing.T) {
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(0xFFFFFFFF)) // unknown size of a stream
+	wav.WriteString("WAVE")
+	wav.WriteString("fmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(22050), uint32(44100), uint16(2), uint16(16)} {
+		binary.Write(&wav, binary.LittleEndian, v)
+	}
+	wav.WriteString("LIST")
+	binary.Write(&wav, binary.LittleEndian, uint32(3))
+	wav.Write([]byte{1, 2, 3, 0}) // padded
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(4))
+	wav.Write(pcmOf(7, 8))
+
+	format, err := ReadWavHeader(&wav)
+	assert.NoError(t, err)
+	assert.Equal(t, &WavFormat{AudioFormat: 1, Channels: 1, SampleRate: 22050, BitsPerSample: 16}, format)
+	assert.Equal(t, pcmOf(7, 8), wav.Bytes(), "samples are left unread")
+
+	_, err = ReadWavHeader(bytes.NewReader([]byte("not a wav stream")))
+	assert.Error(t, err)
+}
+
+func TestApplyGain(t *testing.T) {
+	pcm := pcmOf(1000, -1000, 30000)
+	ApplyGain(pcm, 6.0206) // doubles the amplitude
+	assert.Equal(t, pcmOf(2000, -2000, 32767), pcm)
+
+	// odd reads are scaled once the sample is complete
+	src := io.NopCloser(iotestOneByte(pcmOf(1000, -1000)))
+	out, err := io.ReadAll(NewGainReader(src, -6.0206))
+	assert.NoError(t, err)
+	assert.Equal(t, pcmOf(500, -500), out)
+}
+
+func iotestOneByte(b []byte) io.Reader {
+	return iotest.OneByteReader(bytes.NewReader(b))
+}
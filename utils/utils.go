@@ -23,3 +23,8 @@ func InternalServerError(ctx *app.RequestContext, message string) {
 	ctx.Header("Content-Type", "application/json")
 	ctx.JSON(http.StatusInternalServerError, map[string]string{"error": message})
 }
+
+func NotFound(ctx *app.RequestContext, message string) {
+	ctx.Header("Content-Type", "application/json")
+	ctx.JSON(http.StatusNotFound, map[string]string{"error": message})
+}
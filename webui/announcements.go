@@ -0,0 +1,49 @@
+package webui
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/src"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// announce pushes an announcement to devices, its status is returned right
+// away and can be polled as devices play it
+func announce(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var a src.Announcement
+		if err := c.BindJSON(&a); err != nil {
+			utils.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		status, err := w.hub.Announce(a)
+		if err != nil {
+			utils.BadRequest(c, "Invalid announcement: "+err.Error())
+			return
+		}
+
+		c.JSON(http.StatusAccepted, status)
+	}
+}
+
+func listAnnouncements(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, w.hub.Announcements())
+	}
+}
+
+func getAnnouncement(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		status, ok := w.hub.Announcement(c.Param("id"))
+		if !ok {
+			utils.NotFound(c, "Announcement not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, status)
+	}
+}
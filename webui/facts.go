@@ -0,0 +1,56 @@
+package webui
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+func listFacts(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		facts, err := w.hub.Repository().ListFacts(repo.WhereCondition{
+			"device_id": c.Param("device_id"),
+		})
+		if err != nil {
+			utils.InternalServerError(c, "Failed to list facts: "+err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, facts)
+	}
+}
+
+// removeFacts deletes a single fact if id is given, or all facts of the device
+func removeFacts(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		where := repo.WhereCondition{
+			"device_id": c.Param("device_id"),
+		}
+
+		if id := c.Param("id"); len(id) != 0 {
+			where["id"] = id
+
+			facts, err := w.hub.Repository().ListFacts(where)
+			if err != nil {
+				utils.InternalServerError(c, "Failed to find fact: "+err.Error())
+				return
+			}
+
+			if len(facts) == 0 {
+				utils.NotFound(c, repo.ErrFactNotFound.Error())
+				return
+			}
+		}
+
+		if err := w.hub.Repository().RemoveFacts(where); err != nil {
+			utils.InternalServerError(c, "Failed to remove facts: "+err.Error())
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -1,15 +1,26 @@
 package webui
 
 import (
-	"context"
-
-	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/route"
 )
 
 func handleInternalAPI(w *WebUI, group *route.RouterGroup) {
-	// Define your API endpoints here
-	group.GET("/devices", func(ctx context.Context, c *app.RequestContext) {
-		// Handle endpoint1
-	})
+	group.GET("/devices", listDevices(w))
+	group.GET("/metrics/sessions", sessionMetrics(w))
+
+	group.GET("/devices/:device_id/settings", getDeviceSettings(w))
+	group.PUT("/devices/:device_id/settings", saveDeviceSettings(w))
+	group.GET("/devices/:device_id/facts", listFacts(w))
+	group.DELETE("/devices/:device_id/facts", removeFacts(w))
+	group.DELETE("/devices/:device_id/facts/:id", removeFacts(w))
+	group.GET("/personas", listPersonas(w))
+	group.GET("/tts/providers", listTtsProviders(w))
+	group.GET("/tts/voices", listVoices(w))
+	group.POST("/tts/voices", cloneVoice(w))
+	group.DELETE("/tts/voices/:name", removeVoice(w))
+	group.POST("/announcements", announce(w))
+	group.GET("/announcements", listAnnouncements(w))
+	group.GET("/announcements/:id", getAnnouncement(w))
+
+	handleKnowledge(w, group.Group("/knowledge"))
 }
@@ -0,0 +1,216 @@
+package webui
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/kb"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/pkg/errors"
+)
+
+const maxDocumentSize = 4 << 20 // 4MB
+
+type knowledgeBaseResponse struct {
+	Name    string      `json:"name"`
+	Sources []kb.Source `json:"sources"`
+}
+
+type createKnowledgeBaseRequest struct {
+	Name string `json:"name"` // also the directory of the base under the knowledge root
+}
+
+type ingestDocumentRequest struct {
+	Source  string `json:"source"`  // e.g. faq.md
+	Content string `json:"content"` // markdown or text
+}
+
+func handleKnowledge(w *WebUI, group *route.RouterGroup) {
+	group.GET("", listKnowledgeBases(w))
+	group.POST("", createKnowledgeBase(w))
+	group.DELETE("/:name", removeKnowledgeBase(w))
+	group.GET("/:name/documents", listDocuments(w))
+	group.POST("/:name/documents", ingestDocument(w))
+	group.DELETE("/:name/documents", removeDocument(w))
+	group.GET("/:name/search", searchKnowledgeBase(w))
+}
+
+func listKnowledgeBases(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		bases := make([]knowledgeBaseResponse, 0)
+		for _, base := range w.hub.Knowledge().List() {
+			bases = append(bases, knowledgeBaseResponse{
+				Name:    base.Name(),
+				Sources: base.Sources(),
+			})
+		}
+
+		c.JSON(http.StatusOK, bases)
+	}
+}
+
+func createKnowledgeBase(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var req createKnowledgeBaseRequest
+		if err := c.BindJSON(&req); err != nil || len(req.Name) == 0 {
+			utils.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		// the name must not lead out of the knowledge root
+		if !filepath.IsLocal(req.Name) || filepath.Base(req.Name) != req.Name {
+			utils.BadRequest(c, "Invalid knowledge base name")
+			return
+		}
+
+		dir, chunkSize := "", 0
+		if cfg := w.hub.KnowledgeConfig(); cfg != nil {
+			chunkSize = cfg.ChunkSize
+			if len(cfg.Root) != 0 {
+				dir = filepath.Join(cfg.Root, req.Name)
+			}
+		}
+
+		base := kb.NewKnowledgeBase(req.Name, dir, chunkSize)
+		if err := base.Load(); err != nil {
+			utils.BadRequest(c, "Failed to load knowledge base: "+err.Error())
+			return
+		}
+
+		if err := w.hub.Knowledge().Add(base); err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusCreated, knowledgeBaseResponse{
+			Name:    base.Name(),
+			Sources: base.Sources(),
+		})
+	}
+}
+
+func removeKnowledgeBase(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if err := w.hub.Knowledge().Remove(c.Param("name")); err != nil {
+			utils.NotFound(c, err.Error())
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func listDocuments(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		base, ok := w.knowledgeBase(c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, base.Sources())
+	}
+}
+
+// ingestDocument accepts either a multipart file named file, or a JSON body
+// with source and content
+func ingestDocument(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		base, ok := w.knowledgeBase(c)
+		if !ok {
+			return
+		}
+
+		var req ingestDocumentRequest
+		if file, err := c.FormFile("file"); err == nil {
+			if file.Size > maxDocumentSize {
+				utils.BadRequest(c, "Document is too large")
+				return
+			}
+
+			f, err := file.Open()
+			if err != nil {
+				utils.BadRequest(c, "Failed to open document: "+err.Error())
+				return
+			}
+			defer f.Close()
+
+			content, err := io.ReadAll(f)
+			if err != nil {
+				utils.BadRequest(c, "Failed to read document: "+err.Error())
+				return
+			}
+
+			req.Source = file.Filename
+			req.Content = string(content)
+		} else if err := c.BindJSON(&req); err != nil {
+			utils.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		if len(req.Content) > maxDocumentSize {
+			utils.BadRequest(c, "Document is too large")
+			return
+		}
+
+		if err := base.Ingest(req.Source, []byte(req.Content)); err != nil {
+			if errors.Is(err, kb.ErrInvalidSource) || errors.Is(err, kb.ErrUnsupportedDocument) {
+				utils.BadRequest(c, err.Error())
+				return
+			}
+
+			utils.InternalServerError(c, "Failed to ingest document: "+err.Error())
+			return
+		}
+
+		c.JSON(http.StatusCreated, base.Sources())
+	}
+}
+
+func removeDocument(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		base, ok := w.knowledgeBase(c)
+		if !ok {
+			return
+		}
+
+		if err := base.Remove(c.Query("source")); err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func searchKnowledgeBase(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		base, ok := w.knowledgeBase(c)
+		if !ok {
+			return
+		}
+
+		topK, err := strconv.Atoi(c.DefaultQuery("top_k", "3"))
+		if err != nil {
+			utils.BadRequest(c, "Invalid top_k")
+			return
+		}
+
+		c.JSON(http.StatusOK, base.Search(c.Query("q"), topK, 0))
+	}
+}
+
+func (w *WebUI) knowledgeBase(c *app.RequestContext) (*kb.KnowledgeBase, bool) {
+	base, err := w.hub.Knowledge().Get(c.Param("name"))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return nil, false
+	}
+
+	return base, true
+}
@@ -0,0 +1,21 @@
+package webui
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// listDevices returns the connected devices and the state of their session
+func listDevices(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, w.hub.Sessions())
+	}
+}
+
+func sessionMetrics(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, w.hub.SessionMetrics())
+	}
+}
@@ -0,0 +1,118 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/tts"
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/types"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/pkg/errors"
+)
+
+func getDeviceSettings(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		deviceId := c.Param("device_id")
+		settings, err := w.hub.Repository().FindDeviceSettings(repo.WhereCondition{
+			"device_id": deviceId,
+		})
+		if errors.Is(err, repo.ErrSettingsNotFound) {
+			// devices without settings use the defaults
+			settings, err = &types.DeviceSettings{DeviceId: deviceId}, nil
+		}
+
+		if err != nil {
+			utils.InternalServerError(c, "Failed to find device settings: "+err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// saveDeviceSettings replaces the settings of a device, they take effect on
+// its next connection except the speech, which a connected device uses from
+// its next answer
+func saveDeviceSettings(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var settings types.DeviceSettings
+		if err := c.BindJSON(&settings); err != nil {
+			utils.BadRequest(c, "Invalid request body")
+			return
+		}
+		settings.DeviceId = c.Param("device_id")
+		settings.UpdatedAt = time.Now()
+
+		if len(settings.Persona) != 0 && !w.hasPersona(settings.Persona) {
+			utils.BadRequest(c, "Unknown persona: "+settings.Persona)
+			return
+		}
+
+		if len(settings.Profile) != 0 && !w.hub.HasLlmProfile(settings.Profile) {
+			utils.BadRequest(c, "Unknown LLM profile: "+settings.Profile)
+			return
+		}
+
+		if len(settings.Tts) != 0 && !w.hub.HasTtsProvider(settings.Tts) {
+			utils.BadRequest(c, "Unknown TTS provider: "+settings.Tts)
+			return
+		}
+
+		if settings.Rate != 0 && (settings.Rate < tts.MinRate || settings.Rate > tts.MaxRate) {
+			utils.BadRequest(c, fmt.Sprintf("Rate must be 0 or between %g and %g", tts.MinRate, tts.MaxRate))
+			return
+		}
+
+		if settings.Gain < tts.MinGain || settings.Gain > tts.MaxGain {
+			utils.BadRequest(c, fmt.Sprintf("Gain must be between %g and %g dB", tts.MinGain, tts.MaxGain))
+			return
+		}
+
+		if settings.Pitch < tts.MinPitch || settings.Pitch > tts.MaxPitch {
+			utils.BadRequest(c, fmt.Sprintf("Pitch must be between %g and %g semitones", tts.MinPitch, tts.MaxPitch))
+			return
+		}
+
+		for _, name := range settings.Knowledge {
+			if _, err := w.hub.Knowledge().Get(name); err != nil {
+				utils.BadRequest(c, "Unknown knowledge base: "+name)
+				return
+			}
+		}
+
+		if err := w.hub.Repository().SaveDeviceSettings(&settings); err != nil {
+			utils.InternalServerError(c, "Failed to save device settings: "+err.Error())
+			return
+		}
+		w.hub.ApplySpeech(settings.DeviceId, tts.Options{Rate: settings.Rate, Gain: settings.Gain, Pitch: settings.Pitch})
+
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+func listPersonas(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, w.hub.Personas())
+	}
+}
+
+func listTtsProviders(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, w.hub.TtsProviders())
+	}
+}
+
+func (w *WebUI) hasPersona(name string) bool {
+	for _, p := range w.hub.Personas() {
+		if p.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package webui
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/huairu-tech-com/xiaozhi-gogo/pkg/repo"
+	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/pkg/errors"
+)
+
+const maxVoiceSampleSize = 10 << 20 // 10MB
+
+func listVoices(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		voices, err := w.hub.Voices()
+		if err != nil {
+			utils.InternalServerError(c, "Failed to list voices: "+err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, voices)
+	}
+}
+
+// cloneVoice creates a custom voice from the multipart fields name, text and
+// file, text is the transcript of the reference audio in file
+func cloneVoice(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		name := string(c.FormValue("name"))
+		text := string(c.FormValue("text"))
+		if len(name) == 0 || len(text) == 0 {
+			utils.BadRequest(c, "Name and text of the voice are required")
+			return
+		}
+
+		fh, err := c.FormFile("file")
+		if err != nil {
+			utils.BadRequest(c, "Missing reference audio: "+err.Error())
+			return
+		}
+
+		if fh.Size > maxVoiceSampleSize {
+			utils.BadRequest(c, "Reference audio is too large")
+			return
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			utils.BadRequest(c, "Failed to open reference audio: "+err.Error())
+			return
+		}
+		defer f.Close()
+
+		audio, err := io.ReadAll(f)
+		if err != nil {
+			utils.BadRequest(c, "Failed to read reference audio: "+err.Error())
+			return
+		}
+
+		voice, err := w.hub.CloneVoice(ctx, name, text, audio, fh.Filename)
+		if err != nil {
+			utils.BadRequest(c, "Failed to clone voice: "+err.Error())
+			return
+		}
+
+		c.JSON(http.StatusCreated, voice)
+	}
+}
+
+func removeVoice(w *WebUI) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		err := w.hub.RemoveVoice(ctx, c.Param("name"))
+		if errors.Is(err, repo.ErrVoiceNotFound) {
+			utils.NotFound(c, err.Error())
+			return
+		}
+
+		if err != nil {
+			utils.InternalServerError(c, "Failed to remove voice: "+err.Error())
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -6,14 +6,18 @@ import (
 
 	"github.com/cloudwego/hertz/pkg/app/server"
 
+	"github.com/huairu-tech-com/xiaozhi-gogo/src"
 	"github.com/huairu-tech-com/xiaozhi-gogo/utils"
 )
 
 type WebUI struct {
+	hub *src.Hub
 }
 
-func New() *WebUI {
-	return &WebUI{}
+func New(hub *src.Hub) *WebUI {
+	return &WebUI{
+		hub: hub,
+	}
 }
 
 func (w *WebUI) Run(ctx context.Context) error {